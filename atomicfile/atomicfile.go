@@ -0,0 +1,151 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+
+// Package atomicfile は、書き込み途中でクラッシュや電源断が起きても
+// 途中までしか書かれていないファイルが最終的なパスに残らないようにファイルを書き込みます。
+// 同じディレクトリの一時ファイルに書き込み、fsync してから最終的なパスに rename します。
+package atomicfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TempPrefix は一時ファイルの名前の接頭辞です。
+// 起動時に CleanupTemp でこの接頭辞を持つファイル (前回の書き込み途中で残ったもの) を削除します。
+const TempPrefix = ".atomic-tmp-"
+
+// processStart はこのプロセスの起動時刻です。
+// これ以降に更新されたファイルは、このプロセスが書き込み中のものである可能性があります。
+var processStart = time.Now()
+
+// IsStale はファイルがこのプロセスの起動前に最後に更新されたかどうかを返します。
+// 起動時の後始末で、実行中の書き込みのファイルを削除しないために使用します。
+func IsStale(info fs.FileInfo) bool {
+	return info.ModTime().Before(processStart)
+}
+
+// File は書き込み中の一時ファイルです。Commit で最終的なパスに置き換えるか、Abort で破棄します。
+type File struct {
+	*os.File
+	path string // 最終的なパス
+	done bool
+}
+
+// Create は path と同じディレクトリに一時ファイルを作成します。
+// 同じファイルシステム上に作成するため、Commit の rename はアトミックに行われます。
+func Create(path string, perm os.FileMode) (*File, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), TempPrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	// CreateTemp は 0600 で作成するため、最終的なファイルの権限に合わせる
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", f.Name(), err)
+	}
+	return &File{File: f, path: path}, nil
+}
+
+// Commit は一時ファイルの内容をディスクに書き出し (fsync)、最終的なパスに rename します。
+// 最終的なパスに既存のファイルがある場合は置き換えます。
+func (f *File) Commit() error {
+	if f.done {
+		return fmt.Errorf("atomicfile: %s already committed or aborted", f.path)
+	}
+	f.done = true
+	tmp := f.File.Name()
+	if err := f.File.Sync(); err != nil {
+		f.File.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync %s: %w", tmp, err)
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename %s to %s: %w", tmp, f.path, err)
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// Abort は一時ファイルを閉じて削除します。Commit 後に呼び出しても何もしません (defer での使用を想定)。
+func (f *File) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.File.Close()
+	os.Remove(f.File.Name())
+}
+
+// WriteFile は data を path にアトミックに書き込みます。os.WriteFile の代わりに使用します。
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	f, err := Create(path, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	return f.Commit()
+}
+
+// IsTemp は name が一時ファイルの名前かどうかを返します。
+func IsTemp(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), TempPrefix)
+}
+
+// CleanupTemp は dir 以下 (サブディレクトリを含む) に残っている一時ファイルを削除し、削除したパスを返します。
+// このプロセスの起動後に更新された一時ファイルは書き込み中の可能性があるため削除しません。
+// dir が存在しない場合は何もしません。
+func CleanupTemp(dir string) ([]string, error) {
+	var removed []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !IsTemp(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) { // 書き込みが完了して rename された
+				return nil
+			}
+			return err
+		}
+		if !IsStale(info) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove temporary file %s: %w", path, err)
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	return removed, err
+}
+
+// syncDir は rename をディスクに反映させるためにディレクトリを fsync します。
+// ディレクトリの fsync をサポートしない OS (Windows) もあるため、エラーは無視します。
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -9,6 +9,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"myscreenshot-tool/atomicfile"
 )
 
 // Config はアプリケーションの設定を保持する構造体です。
@@ -17,17 +19,173 @@ type Config struct {
 	IntervalMs      int    `json:"interval_ms"`      // スクリーンショット取得間隔（ミリ秒）
 	CaptureDuration int    `json:"capture_duration"` // 撮影継続時間（分、0で手動停止）
 
+	// 撮影対象: "window" (選択されたウィンドウ), "all_monitors" (全モニター), "monitor" (MonitorIndex のモニター)
+	CaptureTarget string `json:"capture_target"`
+	MonitorIndex  int    `json:"monitor_index"` // CaptureTarget が "monitor" の場合のモニター番号 (0から)
+
+	// 撮影領域 (有効な場合は撮影対象のうちこの矩形だけを保存する)
+	Region RegionSetting `json:"region"`
+
 	// 選択されたウィンドウの情報を保持する構造体
-	SelectedWindow struct {
-		HWND  uintptr `json:"hwnd"`
-		Title string  `json:"title"`
-	} `json:"selected_window"`
+	SelectedWindow WindowSetting `json:"selected_window"`
+
+	// 保存する画像の形式
+	Output OutputSetting `json:"output"`
+
+	// 撮影したフレームのエンコードと書き込みを行うワーカーの設定
+	Pipeline PipelineSetting `json:"pipeline"`
+
+	// 保存先に残すスクリーンショットの上限と、ディスクの空き容量の下限
+	Retention RetentionSetting `json:"retention"`
+
+	// 変化のないフレームの保存を省略する設定
+	Dedup DedupSetting `json:"dedup"`
+
+	// 撮影中に対象のウィンドウが撮影できない状態になった場合の動作
+	WindowPolicy WindowPolicySetting `json:"window_policy"`
+
+	// 保存する前に隠す領域 (顧客情報が表示される欄など)
+	Redaction RedactionSetting `json:"redaction"`
+
+	// 保存する前に画像を縮小する設定
+	Scale ScaleSetting `json:"scale"`
+
+	// 保存する画像に描き込む撮影時刻などのテキスト
+	Overlay OverlaySetting `json:"overlay"`
+
+	// 撮影した画像のアルファ (不透明度) の扱い (Windows のみ)
+	Alpha AlphaSetting `json:"alpha"`
+
+	// xdg-desktop-portal が返した撮影許可の復元トークン (Wayland のみ)
+	PortalRestoreToken string `json:"portal_restore_token,omitempty"`
 }
 
 // WindowSetting は選択されたウィンドウの識別情報を保持します。
+// HWND は再起動後には無効になるため、起動時と撮影開始時に Title・ClassName・ProcessName で
+// 現在のウィンドウを探し直します (HWND は複数一致した場合の優先順位にのみ使用し、
+// PID は MatchPID が true の場合のみ条件に加えます)。
 type WindowSetting struct {
-	HWND  uintptr `json:"hwnd"`  // ウィンドウハンドル
-	Title string  `json:"title"` // ウィンドウタイトル
+	HWND        uintptr `json:"hwnd"`                   // ウィンドウハンドル (前回選択時の値)
+	Title       string  `json:"title"`                  // ウィンドウタイトル
+	TitleRegex  bool    `json:"title_regex,omitempty"`  // true の場合 Title を正規表現として照合
+	ClassName   string  `json:"class_name,omitempty"`   // ウィンドウクラス名
+	ProcessName string  `json:"process_name,omitempty"` // 実行ファイル名 (例: notepad.exe)
+	PID         uint32  `json:"pid,omitempty"`          // 前回選択時のプロセス ID
+	MatchPID    bool    `json:"match_pid,omitempty"`    // true の場合 PID が一致するウィンドウのみを対象にする
+}
+
+// OutputSetting は保存する画像の形式を保持します。
+type OutputSetting struct {
+	// 保存先ディレクトリからの相対パスのテンプレート (拡張子は Format で決まる)。"/" でサブディレクトリに分けられる。
+	// 使用できるプレースホルダー: {window} {process} {session} {date} {time} {yyyy} {mm} {dd} {hh} {min} {ss}
+	// {ms} {utc} {iso} {counter} {frame} {monitor}
+	FilenameTemplate string `json:"filename_template"`
+	Format           string `json:"format"`       // "png", "jpeg", "bmp", "tiff", "qoi" のいずれか (ファイルの拡張子もこれで決まる)
+	JPEGQuality      int    `json:"jpeg_quality"` // Format が "jpeg" の場合の品質 (1-100)
+	// Format が "png" の場合の圧縮レベル: "default", "best_speed", "best_compression", "none"
+	// (圧縮するほど CPU 時間が増え、ファイルサイズが小さくなる)
+	PNGCompression string `json:"png_compression"`
+	// 色の表現: "rgba" (そのまま), "rgb" (アルファを捨てる), "gray" (グレースケール), "palette" (最大 PaletteColors 色)
+	// (PNG では色数に応じた小さい形式で保存される)
+	ColorMode     string `json:"color_mode"`
+	PaletteColors int    `json:"palette_colors"` // "palette" の最大の色数 (2-256)
+	Dither        bool   `json:"dither"`         // "palette" で誤差拡散を行う
+}
+
+// PipelineSetting は撮影と保存の間のキューとワーカーの設定です。
+type PipelineSetting struct {
+	Workers    int    `json:"workers"`     // エンコードと書き込みを並行して行うワーカーの数
+	QueueSize  int    `json:"queue_size"`  // 保存を待つフレームの最大数
+	DropPolicy string `json:"drop_policy"` // キューが一杯のとき: "drop_oldest", "drop_newest", "block" (撮影を待たせる)
+}
+
+// RetentionSetting は保存先のスクリーンショットの上限の設定です。上限の項目は 0 で無制限になります。
+// 上限を超えた場合は古いスクリーンショットから削除します。
+type RetentionSetting struct {
+	MaxTotalMB  int  `json:"max_total_mb"`  // 合計サイズの上限 (MB)
+	MaxFiles    int  `json:"max_files"`     // ファイル数の上限
+	MaxAgeHours int  `json:"max_age_hours"` // 保存してからの時間の上限 (時間)
+	PerSession  bool `json:"per_session"`   // true: 現在のセッションで保存したファイルのみ対象、false: 保存先のうちファイル名のテンプレートに一致する画像が対象
+	MinFreeMB   int  `json:"min_free_mb"`   // ディスクの空き容量がこれを下回ったら撮影を停止する (MB、0 で無効)
+}
+
+// DedupSetting は直前に保存したフレームから変化のないフレームを省略するための設定です。
+type DedupSetting struct {
+	Mode             string  `json:"mode"`              // "off", "exact" (完全一致), "tolerance" (ピクセルごとの許容差), "phash" (知覚ハッシュ)
+	Tolerance        int     `json:"tolerance"`         // "tolerance": 変化していないとみなす各チャンネルの差 (0-255)
+	ChangedRatio     float64 `json:"changed_ratio"`     // "tolerance": 重複とみなす変化したピクセルの割合 (0-1)
+	HashDistance     int     `json:"hash_distance"`     // "phash": 重複とみなすハッシュの距離 (0-64)
+	HeartbeatMinutes int     `json:"heartbeat_minutes"` // 変化がなくても少なくともこの間隔 (分) で保存する (0 で無効)
+}
+
+// WindowPolicySetting はウィンドウの状態ごとの撮影ループの動作を保持します。
+// 値は "skip" (その回の撮影を飛ばす), "placeholder" (代わりの画像を保存する),
+// "pause" (撮影できる状態に戻るまで一時停止する), "stop" (撮影を終了する) のいずれかです。
+type WindowPolicySetting struct {
+	Minimized string `json:"minimized"` // ウィンドウが最小化された場合
+	Gone      string `json:"gone"`      // ウィンドウが閉じられた場合
+}
+
+// AlphaSetting は撮影した画像のアルファの扱いの設定です。
+// どの設定でも、すべてのピクセルのアルファが 0 の画像 (アルファが設定されていない画像) は不透明にして保存します。
+type AlphaSetting struct {
+	Policy     string `json:"policy"`     // "opaque" (不透明にする), "keep" (そのまま), "premultiply" (背景色の上に重ねる)
+	Background string `json:"background"` // "premultiply" の背景色 (#RRGGBB)
+}
+
+// RedactionSetting は保存する前に隠す領域の設定です。隠す前のピクセルはファイルに書き込まれません。
+type RedactionSetting struct {
+	Masks []MaskSetting `json:"masks"`
+	// マスクを設定したときのウィンドウの大きさ。撮影時のウィンドウの大きさが異なる場合は、マスクを同じ比率で拡大・縮小する
+	// (0 の場合は拡大・縮小しない)
+	ReferenceWidth  int `json:"reference_width"`
+	ReferenceHeight int `json:"reference_height"`
+}
+
+// MaskSetting は隠す領域 1 つの設定です。座標はウィンドウの左上を原点とします。
+type MaskSetting struct {
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Mode       string `json:"mode"`                  // "solid" (塗りつぶし), "pixelate" (モザイク), "blur" (ぼかし)
+	Color      string `json:"color,omitempty"`       // "solid" の色 (#RRGGBB、省略時は黒)
+	BlockSize  int    `json:"block_size,omitempty"`  // "pixelate" のブロックの大きさ (ピクセル)
+	BlurRadius int    `json:"blur_radius,omitempty"` // "blur" の半径 (ピクセル)
+}
+
+// ScaleSetting は保存する前の縮小の設定です。Factor で縮小した後、幅と高さの上限に収まるよう縦横比を保って縮小します。
+type ScaleSetting struct {
+	Factor    float64 `json:"factor"`     // 縮小率 (0-1、1 で縮小しない)
+	MaxWidth  int     `json:"max_width"`  // 幅の上限 (0 で制限しない)
+	MaxHeight int     `json:"max_height"` // 高さの上限 (0 で制限しない)
+	Kernel    string  `json:"kernel"`     // 補間の方法: "nearest", "bilinear", "catmull_rom"
+}
+
+// OverlaySetting は保存する画像に描き込むテキストの帯の設定です。
+type OverlaySetting struct {
+	Enabled   bool   `json:"enabled"`
+	ShowTime  bool   `json:"show_time"`  // 撮影時刻
+	ShowTitle bool   `json:"show_title"` // ウィンドウのタイトル
+	ShowFrame bool   `json:"show_frame"` // フレーム番号
+	Label     string `json:"label"`      // 任意のテキスト
+
+	Position          string  `json:"position"`           // "top", "bottom", "top_left", "top_right", "bottom_left", "bottom_right"
+	FontSize          float64 `json:"font_size"`          // 文字の大きさ (ピクセル)
+	FontFile          string  `json:"font_file"`          // TrueType/OpenType フォントのファイル (空の場合は組み込みのフォント、日本語は表示できない)
+	TextColor         string  `json:"text_color"`         // 文字の色 (#RRGGBB)
+	BackgroundColor   string  `json:"background_color"`   // 背景の色 (#RRGGBB)
+	BackgroundOpacity float64 `json:"background_opacity"` // 背景の不透明度 (0-1)
+}
+
+// RegionSetting は撮影領域の矩形とその座標の基準を保持します。
+type RegionSetting struct {
+	Enabled bool   `json:"enabled"`
+	Anchor  string `json:"anchor"` // "screen" (画面の座標) または "window" (選択ウィンドウの左上が原点)
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
 }
 
 // NewDefaultConfig はデフォルトの設定値を返します。
@@ -43,6 +201,53 @@ func NewDefaultConfig() *Config {
 		SaveDirectory:   filepath.Join(homeDir, "screenshots"), // ユーザーのホームディレクトリに"screenshots"フォルダ
 		IntervalMs:      1000,                                  // 1秒 (1000ミリ秒)
 		CaptureDuration: 60,                                    // 1時間 (60分)
+		CaptureTarget:   "window",                              // デフォルトではウィンドウを撮影
+		Region: RegionSetting{
+			Enabled: false, // デフォルトでは撮影対象全体を保存
+			Anchor:  "window",
+		},
+		Output: OutputSetting{
+			FilenameTemplate: "screenshot_{date}_{time}_{counter}",
+			Format:           "png",
+			JPEGQuality:      90,
+			PNGCompression:   "default",
+			ColorMode:        "rgba",
+			PaletteColors:    256,
+		},
+		Pipeline: PipelineSetting{
+			Workers:    2,
+			QueueSize:  8,
+			DropPolicy: "block", // フレームを失わない
+		},
+		Dedup: DedupSetting{
+			Mode:         "off", // デフォルトではすべてのフレームを保存
+			Tolerance:    8,
+			ChangedRatio: 0.001,
+			HashDistance: 2,
+		},
+		WindowPolicy: WindowPolicySetting{
+			Minimized: "pause", // 元に戻されたら撮影を再開
+			Gone:      "stop",
+		},
+		Scale: ScaleSetting{
+			Factor: 1, // デフォルトでは縮小しない
+			Kernel: "bilinear",
+		},
+		Alpha: AlphaSetting{
+			Policy:     "opaque", // PrintWindow はアルファを設定しないことが多いため
+			Background: "#FFFFFF",
+		},
+		Overlay: OverlaySetting{
+			Enabled:           false,
+			ShowTime:          true,
+			ShowTitle:         true,
+			ShowFrame:         true,
+			Position:          "bottom",
+			FontSize:          16,
+			TextColor:         "#FFFFFF",
+			BackgroundColor:   "#000000",
+			BackgroundOpacity: 0.6,
+		},
 		SelectedWindow: WindowSetting{
 			HWND:  0, // デフォルトでは未選択
 			Title: "",
@@ -72,6 +277,11 @@ func LoadConfig() (*Config, error) {
 
 	cfg := NewDefaultConfig() // まずデフォルト設定をロード
 
+	// 前回の保存中に残った一時ファイルを削除
+	if _, err := atomicfile.CleanupTemp(filepath.Dir(cfgPath)); err != nil {
+		log.Printf("Warning: failed to clean up temporary config files: %v", err)
+	}
+
 	data, err := os.ReadFile(cfgPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -83,7 +293,13 @@ func LoadConfig() (*Config, error) {
 	}
 
 	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config data: %w", err)
+		// 壊れた設定ファイルで起動できなくならないよう、退避してデフォルト設定で起動する
+		broken := fmt.Sprintf("%s.broken-%s", cfgPath, time.Now().Format("20060102-150405"))
+		if renameErr := os.Rename(cfgPath, broken); renameErr != nil {
+			return nil, fmt.Errorf("failed to unmarshal config data: %w", err)
+		}
+		log.Printf("Warning: config file %s is corrupted (%v). Moved it to %s and using default settings.", cfgPath, err, broken)
+		return NewDefaultConfig(), nil
 	}
 	fmt.Printf("Config loaded from %s\n", cfgPath)
 	return cfg, nil
@@ -101,7 +317,8 @@ func SaveConfig(cfg *Config) error {
 		return fmt.Errorf("failed to marshal config data: %w", err)
 	}
 
-	if err := os.WriteFile(cfgPath, data, 0644); err != nil {
+	// 書き込み途中でクラッシュしても config.json が壊れないよう、一時ファイルに書き込んでから置き換える
+	if err := atomicfile.WriteFile(cfgPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config file %s: %w", cfgPath, err)
 	}
 	fmt.Printf("Config saved to %s\n", cfgPath)
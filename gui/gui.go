@@ -4,11 +4,18 @@ package gui
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
 	"log"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -22,11 +29,26 @@ import (
 	"myscreenshot-tool/screenshot"
 )
 
+// 撮影領域の基準セレクターの表示文字列
+const (
+	regionAnchorWindowLabel = "Relative to Window"
+	regionAnchorScreenLabel = "Relative to Screen"
+)
+
+// 撮影対象のウィンドウが撮影できない状態になった場合の動作 (config.WindowPolicySetting の値)
+const (
+	policySkip        = "skip"
+	policyPlaceholder = "placeholder"
+	policyPause       = "pause"
+	policyStop        = "stop"
+)
+
 // AppContext はアプリケーションの状態と設定、Fyneのウィンドウなどを保持します。
 type AppContext struct {
 	App         fyne.App
 	Window      fyne.Window
-	Config      *config.Config // アプリケーション設定
+	Config      *config.Config      // アプリケーション設定
+	Capturer    screenshot.Capturer // ウィンドウ列挙と撮影を行うバックエンド
 	CaptureCtx  context.Context
 	CaptureStop context.CancelFunc // 撮影停止用のキャンセル関数
 	IsCapturing bool               // 撮影中かどうかを示すフラグ
@@ -37,6 +59,16 @@ type AppContext struct {
 	intervalEntry     *widget.Entry
 	durationEntry     *widget.Entry
 	windowSelect      *widget.Select // ウィンドウタイトル一覧からの選択
+	titlePatternEntry *widget.Entry  // ウィンドウタイトルの正規表現 (空欄の場合は選択したウィンドウのタイトルと完全一致)
+	titlePatternError *widget.Label  // タイトルの正規表現が正しくない場合の警告
+	matchPIDCheck     *widget.Check  // 選択したウィンドウと同じプロセスのウィンドウのみを対象にする
+	targetSelect      *widget.Select // 撮影対象 (ウィンドウ / 全モニター / 各モニター) の選択
+	regionEntry       *widget.Entry  // 撮影領域 (x,y,width,height)
+	regionAnchor      *widget.Select // 撮影領域の座標の基準 (ウィンドウ / 画面)
+	filenameEntry     *widget.Entry  // ファイル名のテンプレート
+	formatSelect      *widget.Select // 保存する画像の形式
+	qualityEntry      *widget.Entry  // JPEG の品質 (1-100)
+	colorSelect       *widget.Select // 保存する画像の色の表現
 	startButton       *widget.Button
 	stopButton        *widget.Button
 	statusLabel       *widget.Label
@@ -44,25 +76,55 @@ type AppContext struct {
 	countdownLabel    *widget.Label
 
 	selectedWindowInfo screenshot.WindowInfo // ユーザーが選択したウィンドウのHWNDとタイトル
+	literalTitle       string                // 正規表現を使用する前の、完全一致で識別するウィンドウのタイトル
+	targetOptions      []targetOption        // targetSelect の選択肢と対応する撮影対象
+}
+
+// targetOption は撮影対象セレクターの 1 項目です。
+type targetOption struct {
+	Label   string
+	Kind    screenshot.TargetKind
+	Monitor int
 }
 
 // NewApp は新しいアプリケーションコンテキストを作成し、GUIを初期化します。
-func NewApp(cfg *config.Config) *AppContext {
+// capturer はウィンドウの列挙と撮影に使用するバックエンドです。
+func NewApp(cfg *config.Config, capturer screenshot.Capturer) *AppContext {
 	a := app.New()
 	w := a.NewWindow("Go Screenshot Tool")
 
 	appCtx := &AppContext{
-		App:    a,
-		Window: w,
-		Config: cfg,
+		App:      a,
+		Window:   w,
+		Config:   cfg,
+		Capturer: capturer,
+	}
+
+	// 保存済みの撮影許可トークンをバックエンドに渡し、新しいトークンを受け取るたびに設定を保存する (対応しているバックエンドのみ)
+	if tr, ok := capturer.(screenshot.TokenRestorer); ok {
+		if cfg.PortalRestoreToken != "" {
+			tr.SetRestoreToken(cfg.PortalRestoreToken)
+		}
+		tr.OnRestoreToken(func(token string) {
+			fyne.Do(func() {
+				appCtx.Config.PortalRestoreToken = token
+				if err := config.SaveConfig(appCtx.Config); err != nil {
+					log.Printf("Failed to save the portal restore token: %v", err)
+				}
+			})
+		})
 	}
 
 	appCtx.createUI()       // UIコンポーネントを構築
 	appCtx.loadConfigToUI() // 設定をUIにロード
 	appCtx.updateControlButtons()
 
+	// 前回のセッションが中断された場合の後始末 (保存先に大量のファイルがある場合に備えてバックグラウンドで行う)。
+	// 起動後に書き込まれたファイルは対象にならないため、後始末の途中で撮影を開始してもよい
+	go appCtx.recoverSaveDirectory(cfg.SaveDirectory, cfg.Output.FilenameTemplate)
+
 	w.SetFixedSize(true)             // ウィンドウサイズを固定 (必要に応じて調整)
-	w.Resize(fyne.NewSize(500, 450)) // ウィンドウの初期サイズ
+	w.Resize(fyne.NewSize(500, 600)) // ウィンドウの初期サイズ
 
 	// ウィンドウが閉じられたときの処理
 	w.SetOnClosed(func() {
@@ -81,6 +143,40 @@ func NewApp(cfg *config.Config) *AppContext {
 	return appCtx
 }
 
+// recoverSaveDirectory は保存先に残った一時ファイルを削除し、途中までしか書かれていない画像があれば通知します。
+// 画像はファイル名のテンプレート tmpl に一致するもののみを対象にします。
+func (ac *AppContext) recoverSaveDirectory(dir, tmpl string) {
+	matcher, err := screenshot.MatchTemplate(tmpl)
+	if err != nil {
+		log.Printf("Skipping save directory check: invalid filename template: %v", err)
+		return
+	}
+	report, err := screenshot.RecoverSaveDirectory(dir, matcher)
+	if err != nil {
+		log.Printf("Failed to check save directory %s: %v", dir, err)
+	}
+	for _, err := range report.Errors {
+		log.Printf("Save directory check: %v", err)
+	}
+	for _, path := range report.RemovedTemp {
+		log.Printf("Removed leftover temporary file: %s", path)
+	}
+	for _, path := range report.RemovedEmpty {
+		log.Printf("Removed empty screenshot from an interrupted session: %s", path)
+	}
+	if len(report.Truncated) == 0 {
+		return
+	}
+	for _, path := range report.Truncated {
+		log.Printf("Truncated screenshot from an interrupted session: %s", path)
+	}
+	fyne.Do(func() {
+		dialog.ShowInformation("Interrupted Session",
+			fmt.Sprintf("%d incomplete screenshot(s) from an interrupted session were found in %s.\nFirst: %s",
+				len(report.Truncated), dir, report.Truncated[0]), ac.Window)
+	})
+}
+
 // createUI はGUIコンポーネントを構築し、ウィンドウに配置します。
 func (ac *AppContext) createUI() {
 	// --- 保存先設定 ---
@@ -159,9 +255,151 @@ func (ac *AppContext) createUI() {
 		ac.showWindowSelectionDialog()
 	})
 
+	// --- 撮影対象の選択 (ウィンドウ / 全モニター / モニター N) ---
+	ac.targetOptions = ac.buildTargetOptions()
+	var targetLabels []string
+	for _, opt := range ac.targetOptions {
+		targetLabels = append(targetLabels, opt.Label)
+	}
+	ac.targetSelect = widget.NewSelect(targetLabels, func(s string) {
+		for _, opt := range ac.targetOptions {
+			if opt.Label == s {
+				ac.Config.CaptureTarget = string(opt.Kind)
+				ac.Config.MonitorIndex = opt.Monitor
+				return
+			}
+		}
+	})
+
 	windowSelectionContainer := container.New(layout.NewGridWrapLayout(fyne.NewSize(450, 35)),
 		ac.windowSelect,
 		selectWindowButton,
+		ac.targetSelect,
+	)
+
+	// --- ウィンドウの識別条件 (タイトルの正規表現、プロセス ID) ---
+	ac.titlePatternEntry = widget.NewEntry()
+	ac.titlePatternEntry.SetPlaceHolder("Title pattern (regular expression, empty = exact title)")
+	ac.titlePatternEntry.Validator = func(s string) error {
+		_, err := regexp.Compile(s)
+		return err
+	}
+	ac.titlePatternError = widget.NewLabel("")
+	ac.titlePatternError.Importance = widget.WarningImportance
+	ac.titlePatternError.Hide()
+	ac.titlePatternEntry.OnChanged = func(s string) {
+		if s == "" {
+			// 選択したウィンドウのタイトルとの完全一致に戻す (ウィンドウをまだ選択していない場合は以前のタイトル)
+			if ac.selectedWindowInfo.Title != "" {
+				ac.literalTitle = ac.selectedWindowInfo.Title
+			}
+			ac.Config.SelectedWindow.Title = ac.literalTitle
+			ac.Config.SelectedWindow.TitleRegex = false
+			ac.titlePatternError.Hide()
+			return
+		}
+		if _, err := regexp.Compile(s); err != nil {
+			// 正しくない正規表現は設定に反映せず、直前の条件のまま撮影する
+			ac.titlePatternError.SetText(fmt.Sprintf("Invalid title pattern (the previous condition is used): %v", err))
+			ac.titlePatternError.Show()
+			return
+		}
+		if !ac.Config.SelectedWindow.TitleRegex {
+			ac.literalTitle = ac.Config.SelectedWindow.Title
+		}
+		ac.Config.SelectedWindow.Title = s
+		ac.Config.SelectedWindow.TitleRegex = true
+		ac.titlePatternError.Hide()
+	}
+	ac.matchPIDCheck = widget.NewCheck("Same process only (PID)", func(b bool) {
+		ac.Config.SelectedWindow.MatchPID = b
+	})
+
+	matchContainer := container.NewVBox(
+		container.New(layout.NewGridWrapLayout(fyne.NewSize(450, 35)),
+			ac.titlePatternEntry,
+			ac.matchPIDCheck,
+		),
+		ac.titlePatternError,
+	)
+
+	// --- 撮影領域 (空欄の場合は撮影対象全体) ---
+	ac.regionEntry = widget.NewEntry()
+	ac.regionEntry.SetPlaceHolder("Region x,y,width,height (empty = whole target)")
+	ac.regionEntry.Validator = func(s string) error {
+		if strings.TrimSpace(s) == "" {
+			return nil
+		}
+		_, err := parseRegion(s)
+		return err
+	}
+	ac.regionEntry.OnChanged = func(s string) {
+		if strings.TrimSpace(s) == "" {
+			ac.Config.Region.Enabled = false
+			return
+		}
+		r, err := parseRegion(s)
+		if err == nil {
+			ac.Config.Region.Enabled = true
+			ac.Config.Region.X = r.Min.X
+			ac.Config.Region.Y = r.Min.Y
+			ac.Config.Region.Width = r.Dx()
+			ac.Config.Region.Height = r.Dy()
+		}
+	}
+
+	ac.regionAnchor = widget.NewSelect([]string{regionAnchorWindowLabel, regionAnchorScreenLabel}, func(s string) {
+		if s == regionAnchorScreenLabel {
+			ac.Config.Region.Anchor = string(screenshot.AnchorScreen)
+		} else {
+			ac.Config.Region.Anchor = string(screenshot.AnchorWindow)
+		}
+	})
+
+	regionContainer := container.New(layout.NewGridWrapLayout(fyne.NewSize(450, 35)),
+		ac.regionEntry,
+		ac.regionAnchor,
+	)
+
+	// --- ファイル名のテンプレート ---
+	ac.filenameEntry = widget.NewEntry()
+	ac.filenameEntry.SetPlaceHolder("e.g. {date}/{window}/{hh}/shot_{frame}")
+	ac.filenameEntry.Validator = screenshot.ValidateTemplate
+	ac.filenameEntry.OnChanged = func(s string) {
+		ac.Config.Output.FilenameTemplate = s
+	}
+
+	// --- 保存形式 ---
+	ac.formatSelect = widget.NewSelect(screenshot.Formats(), func(s string) {
+		ac.Config.Output.Format = s
+		// 品質は JPEG の場合のみ使用する
+		ac.updateControlButtons()
+	})
+
+	ac.qualityEntry = widget.NewEntry()
+	ac.qualityEntry.SetPlaceHolder("JPEG quality (1-100)")
+	ac.qualityEntry.Validator = func(s string) error {
+		val, err := strconv.Atoi(s)
+		if err != nil || val < 1 || val > 100 {
+			return fmt.Errorf("quality must be between 1 and 100")
+		}
+		return nil
+	}
+	ac.qualityEntry.OnChanged = func(s string) {
+		val, err := strconv.Atoi(s)
+		if err == nil {
+			ac.Config.Output.JPEGQuality = val
+		}
+	}
+
+	ac.colorSelect = widget.NewSelect(screenshot.ColorModes(), func(s string) {
+		ac.Config.Output.ColorMode = s
+	})
+
+	formatContainer := container.New(layout.NewGridWrapLayout(fyne.NewSize(450, 35)),
+		ac.formatSelect,
+		ac.qualityEntry,
+		ac.colorSelect,
 	)
 
 	// --- コントロールボタン ---
@@ -194,6 +432,10 @@ func (ac *AppContext) createUI() {
 			widget.NewLabel("Interval (ms):"), ac.intervalEntry,
 			widget.NewLabel("Duration (min):"), ac.durationEntry,
 			widget.NewLabel("Target Window:"), windowSelectionContainer,
+			widget.NewLabel("Match:"), matchContainer,
+			widget.NewLabel("Region:"), regionContainer,
+			widget.NewLabel("File Name:"), ac.filenameEntry,
+			widget.NewLabel("Format:"), formatContainer,
 		),
 		widget.NewSeparator(),
 		controlButtons,
@@ -204,20 +446,111 @@ func (ac *AppContext) createUI() {
 	ac.Window.SetContent(content)
 }
 
+// buildTargetOptions はバックエンドが列挙したモニターから撮影対象の選択肢を作成します。
+func (ac *AppContext) buildTargetOptions() []targetOption {
+	options := []targetOption{
+		{Label: "Target: Window", Kind: screenshot.TargetWindow},
+		{Label: "Target: All Monitors", Kind: screenshot.TargetAllMonitors},
+	}
+	monitors, err := ac.Capturer.ListMonitors()
+	if err != nil {
+		log.Printf("Failed to list monitors: %v", err)
+		return options
+	}
+	for _, m := range monitors {
+		label := fmt.Sprintf("Target: Monitor %d (%s, %dx%d)", m.Index+1, m.Name, m.Bounds.Dx(), m.Bounds.Dy())
+		if m.Primary {
+			label += " *"
+		}
+		options = append(options, targetOption{Label: label, Kind: screenshot.TargetMonitor, Monitor: m.Index})
+	}
+	return options
+}
+
 // loadConfigToUI はConfig構造体の値をUI要素にロードします。
 func (ac *AppContext) loadConfigToUI() {
 	ac.saveDirEntry.SetText(ac.Config.SaveDirectory)
 	ac.intervalEntry.SetText(strconv.Itoa(ac.Config.IntervalMs))
 	ac.durationEntry.SetText(strconv.Itoa(ac.Config.CaptureDuration))
+	ac.filenameEntry.SetText(ac.Config.Output.FilenameTemplate)
+	ac.formatSelect.SetSelected(ac.Config.Output.Format)
+	ac.qualityEntry.SetText(strconv.Itoa(ac.Config.Output.JPEGQuality))
+	ac.colorSelect.SetSelected(ac.Config.Output.ColorMode)
+
+	if ac.Config.Region.Enabled {
+		ac.regionEntry.SetText(fmt.Sprintf("%d,%d,%d,%d", ac.Config.Region.X, ac.Config.Region.Y, ac.Config.Region.Width, ac.Config.Region.Height))
+	}
+	if screenshot.RegionAnchor(ac.Config.Region.Anchor) == screenshot.AnchorScreen {
+		ac.regionAnchor.SetSelected(regionAnchorScreenLabel)
+	} else {
+		ac.regionAnchor.SetSelected(regionAnchorWindowLabel)
+	}
 
-	if ac.Config.SelectedWindow.HWND != 0 {
-		ac.selectedWindowInfo = screenshot.WindowInfo{
-			HWND:  screenshot.HWND(ac.Config.SelectedWindow.HWND),
-			Title: ac.Config.SelectedWindow.Title,
+	if ac.Config.SelectedWindow.TitleRegex {
+		ac.titlePatternEntry.SetText(ac.Config.SelectedWindow.Title)
+	} else {
+		ac.literalTitle = ac.Config.SelectedWindow.Title
+	}
+	ac.matchPIDCheck.SetChecked(ac.Config.SelectedWindow.MatchPID)
+
+	for _, opt := range ac.targetOptions {
+		kind := screenshot.TargetKind(ac.Config.CaptureTarget)
+		if opt.Kind == kind && (kind != screenshot.TargetMonitor || opt.Monitor == ac.Config.MonitorIndex) {
+			ac.targetSelect.SetSelected(opt.Label)
+			break
 		}
+	}
+
+	// 保存されている HWND は再起動後には無効なため、識別条件から現在のウィンドウを探し直す
+	if !ac.windowMatcher().IsZero() {
+		if _, err := ac.resolveSelectedWindow(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
 
-		ac.windowSelect.PlaceHolder = fmt.Sprintf("Selected: %s", ac.Config.SelectedWindow.Title) // 修正
+// windowMatcher は設定に保存されたウィンドウの識別条件を返します。
+func (ac *AppContext) windowMatcher() screenshot.WindowMatcher {
+	w := ac.Config.SelectedWindow
+	return screenshot.WindowMatcher{
+		Title:       w.Title,
+		TitleRegex:  w.TitleRegex,
+		ClassName:   w.ClassName,
+		ProcessName: w.ProcessName,
+		PID:         w.PID,
+		MatchPID:    w.MatchPID,
+		HWND:        screenshot.HWND(w.HWND),
+	}
+}
+
+// resolveSelectedWindow は識別条件に一致する現在のウィンドウを探し、選択状態と表示を更新します。
+// 戻り値は一致したウィンドウの数です。一致するウィンドウがない場合はエラーを返します。
+// 複数一致した場合は優先度が最も高いウィンドウを選択します。
+func (ac *AppContext) resolveSelectedWindow() (int, error) {
+	matcher := ac.windowMatcher()
+	matches, err := screenshot.ResolveWindow(ac.Capturer, matcher)
+	if err != nil {
+		return 0, err
+	}
+	if len(matches) == 0 {
+		ac.selectedWindowInfo = screenshot.WindowInfo{}
+		ac.windowSelect.PlaceHolder = fmt.Sprintf("Not found: %s", matcher.Title)
+		ac.windowSelect.Refresh()
+		return 0, fmt.Errorf("no window matches %q", matcher.Title)
+	}
+
+	win := matches[0]
+	ac.selectedWindowInfo = win
+	ac.Config.SelectedWindow.HWND = uintptr(win.HWND)
+	ac.Config.SelectedWindow.PID = win.PID
+	if len(matches) > 1 {
+		log.Printf("Warning: %d windows match %q. Using HWND %d.", len(matches), matcher.Title, win.HWND)
+		ac.windowSelect.PlaceHolder = fmt.Sprintf("Selected: %s (%d matches)", win.Title, len(matches))
+	} else {
+		ac.windowSelect.PlaceHolder = fmt.Sprintf("Selected: %s", win.Title)
 	}
+	ac.windowSelect.Refresh()
+	return len(matches), nil
 }
 
 // updateControlButtons は現在の撮影状態に基づいてボタンの有効/無効を切り替えます。
@@ -231,35 +564,55 @@ func (ac *AppContext) updateControlButtons() {
 		ac.saveDirEntry.Disable()
 		ac.intervalEntry.Disable()
 		ac.durationEntry.Disable()
+		ac.targetSelect.Disable()
+		ac.titlePatternEntry.Disable()
+		ac.matchPIDCheck.Disable()
+		ac.regionEntry.Disable()
+		ac.regionAnchor.Disable()
+		ac.filenameEntry.Disable()
+		ac.formatSelect.Disable()
+		ac.qualityEntry.Disable()
+		ac.colorSelect.Disable()
 	} else {
 		ac.startButton.Enable()
 		ac.stopButton.Disable()
 		ac.saveDirEntry.Enable()
 		ac.intervalEntry.Enable()
 		ac.durationEntry.Enable()
+		ac.targetSelect.Enable()
+		ac.titlePatternEntry.Enable()
+		ac.matchPIDCheck.Enable()
+		ac.regionEntry.Enable()
+		ac.regionAnchor.Enable()
+		ac.filenameEntry.Enable()
+		ac.formatSelect.Enable()
+		ac.colorSelect.Enable()
+		if ac.Config.Output.Format == screenshot.FormatJPEG {
+			ac.qualityEntry.Enable()
+		} else {
+			ac.qualityEntry.Disable()
+		}
 	}
 }
 
 // showWindowSelectionDialog は利用可能なウィンドウ一覧を表示し、ユーザーに選択させます。
 func (ac *AppContext) showWindowSelectionDialog() {
-	windows, err := screenshot.GetWindowList()
+	allWindows, err := screenshot.ListWindowsFiltered(ac.Capturer, screenshot.DefaultWindowFilter)
 	if err != nil {
 		dialog.ShowError(fmt.Errorf("failed to get window list: %w", err), ac.Window)
 		return
 	}
 
-	if len(windows) == 0 {
+	if len(allWindows) == 0 {
 		dialog.ShowInformation("No Windows Found", "No visible application windows were found.", ac.Window)
 		return
 	}
 
-	// 表示用の文字列スライスと、HWNDへのマッピング
+	// 表示中のウィンドウと表示用の文字列 (フィルタの入力に応じて更新する)
+	windows := allWindows
 	var titles []string
-	hwndMap := make(map[string]screenshot.WindowInfo)
 	for _, win := range windows {
-		title := fmt.Sprintf("[%d] %s", win.HWND, win.Title) // HWNDも表示に含める
-		titles = append(titles, title)
-		hwndMap[title] = win
+		titles = append(titles, windowLabel(win))
 	}
 
 	// 選択ダイアログを作成
@@ -271,21 +624,59 @@ func (ac *AppContext) showWindowSelectionDialog() {
 		},
 	)
 
+	// --- 絞り込み (タイトルの正規表現、実行ファイル名、最小化されたウィンドウの除外) ---
+	titleFilterEntry := widget.NewEntry()
+	titleFilterEntry.SetPlaceHolder("Filter by title (regular expression)")
+	processFilterEntry := widget.NewEntry()
+	processFilterEntry.SetPlaceHolder("Filter by process (e.g. notepad.exe)")
+	hideMinimizedCheck := widget.NewCheck("Hide minimized windows", nil)
+
+	applyFilter := func() {
+		filter := screenshot.WindowFilter{
+			TitleRegex:       titleFilterEntry.Text,
+			ProcessName:      processFilterEntry.Text,
+			ExcludeMinimized: hideMinimizedCheck.Checked,
+		}
+		filtered, err := filter.Apply(allWindows)
+		if err != nil {
+			return // 入力途中の正規表現は無視して、前回の結果を表示したままにする
+		}
+		windows = filtered
+		titles = titles[:0]
+		for _, win := range windows {
+			titles = append(titles, windowLabel(win))
+		}
+		list.Refresh()
+	}
+	titleFilterEntry.OnChanged = func(string) { applyFilter() }
+	processFilterEntry.OnChanged = func(string) { applyFilter() }
+	hideMinimizedCheck.OnChanged = func(bool) { applyFilter() }
+
 	// 選択されたときの処理
 	list.OnSelected = func(id widget.ListItemID) {
-		selectedTitle := titles[id]
-		selectedWinInfo := hwndMap[selectedTitle]
+		selectedWinInfo := windows[id]
 		ac.selectedWindowInfo = selectedWinInfo
+		ac.literalTitle = selectedWinInfo.Title
 		ac.windowSelect.PlaceHolder = fmt.Sprintf("Selected: %s", selectedWinInfo.Title) // Selectのプレースホルダーを更新
-		ac.Config.SelectedWindow.HWND = uintptr(selectedWinInfo.HWND)
-		ac.Config.SelectedWindow.Title = selectedWinInfo.Title
+		ac.Config.SelectedWindow = config.WindowSetting{
+			HWND:        uintptr(selectedWinInfo.HWND),
+			Title:       selectedWinInfo.Title,
+			ClassName:   selectedWinInfo.ClassName,
+			ProcessName: selectedWinInfo.ProcessName,
+			PID:         selectedWinInfo.PID,
+			MatchPID:    ac.matchPIDCheck.Checked,
+		}
+		// タイトルの正規表現が入力されている場合は、新しく選択したウィンドウにもそのまま適用する
+		if pattern := ac.titlePatternEntry.Text; pattern != "" {
+			ac.Config.SelectedWindow.Title = pattern
+			ac.Config.SelectedWindow.TitleRegex = true
+		}
 	}
 
 	// 既存の選択があればスクロールして表示 (id の問題修正)
 	if ac.selectedWindowInfo.HWND != 0 {
-		for i, title := range titles {
-			// 表示文字列が HWND を含んでいるので、それと照合
-			if title == fmt.Sprintf("[%d] %s", ac.selectedWindowInfo.HWND, ac.selectedWindowInfo.Title) {
+		for i, win := range windows {
+			if win.HWND == ac.selectedWindowInfo.HWND {
 				list.ScrollTo(widget.ListItemID(i))
 				break
 			}
@@ -293,15 +684,38 @@ func (ac *AppContext) showWindowSelectionDialog() {
 	}
 
 	// ダイアログとして表示
-	confirmDialog := dialog.NewCustomConfirm("Select Window", "Select", "Cancel", container.NewScroll(list), func(b bool) {
+	filters := container.NewVBox(titleFilterEntry, processFilterEntry, hideMinimizedCheck)
+	content := container.NewBorder(filters, nil, nil, nil, container.NewScroll(list))
+	confirmDialog := dialog.NewCustomConfirm("Select Window", "Select", "Cancel", content, func(b bool) {
 		// ダイアログが閉じられたときの処理 (ここでは特に何もしない)
 	}, ac.Window)
 
 	// リストが小さすぎる場合があるため、最低限のサイズを設定
-	confirmDialog.Resize(fyne.NewSize(400, 300))
+	confirmDialog.Resize(fyne.NewSize(600, 450))
 	confirmDialog.Show()
 }
 
+// windowLabel はウィンドウ選択ダイアログに表示する文字列を作成します。
+// 同じタイトルのウィンドウを区別できるよう、プロセス名・クラス名・サイズ・状態も含めます。
+func windowLabel(win screenshot.WindowInfo) string {
+	label := fmt.Sprintf("[%d] %s", win.HWND, win.Title) // HWNDも表示に含める
+	if win.ProcessName != "" {
+		label += fmt.Sprintf(" - %s (PID %d)", win.ProcessName, win.PID)
+	}
+	if win.ClassName != "" {
+		label += fmt.Sprintf(" <%s>", win.ClassName)
+	}
+	switch {
+	case win.Minimized:
+		label += " [minimized]"
+	case win.Maximized:
+		label += fmt.Sprintf(" %dx%d [maximized]", win.Rect.Dx(), win.Rect.Dy())
+	default:
+		label += fmt.Sprintf(" %dx%d", win.Rect.Dx(), win.Rect.Dy())
+	}
+	return label
+}
+
 // startCapture はスクリーンショット撮影を開始します。
 func (ac *AppContext) startCapture() {
 	ac.CaptureMu.Lock()
@@ -317,62 +731,267 @@ func (ac *AppContext) startCapture() {
 	ac.captureCountLabel.SetText("Screenshots: 0")
 	ac.countdownLabel.SetText("Remaining: calculating...")
 
-	if ac.selectedWindowInfo.HWND == 0 {
-		dialog.ShowError(fmt.Errorf("Please select a window to capture."), ac.Window)
-		ac.stopCapture() // エラーの場合は停止状態に戻す
-		return
+	if needsWindow(ac.captureTarget()) {
+		if ac.windowMatcher().IsZero() {
+			dialog.ShowError(fmt.Errorf("Please select a window to capture."), ac.Window)
+			ac.finishCapture("Status: Stopped") // エラーの場合は停止状態に戻す
+			return
+		}
+		// セッションごとに対象ウィンドウを探し直す (前回のセッション後に閉じられている可能性がある)
+		matches, err := ac.resolveSelectedWindow()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("target window not found: %w", err), ac.Window)
+			ac.finishCapture("Status: Stopped")
+			return
+		}
+		if matches > 1 {
+			ac.statusLabel.SetText(fmt.Sprintf("Status: Capturing... (warning: %d windows match, using the first)", matches))
+		}
 	}
 
 	// コンテキストを再作成 (以前のキャンセル関数をクリア)
 	ac.CaptureCtx, ac.CaptureStop = context.WithCancel(context.Background())
 
-	go ac.runCaptureLoop() // 別Goroutineで撮影ループを実行
+	go ac.runCaptureLoop(ac.Capturer) // 別Goroutineで撮影ループを実行
 }
 
-// stopCapture はスクリーンショット撮影を停止します。
+// stopCapture はスクリーンショット撮影の停止を撮影ゴルーチンに通知します。
+// キューに残っているフレームの保存が終わるまでは撮影中のままとし、撮影ゴルーチンが finishCapture で停止状態にします。
 func (ac *AppContext) stopCapture() {
 	ac.CaptureMu.Lock()
 	if !ac.IsCapturing {
 		ac.CaptureMu.Unlock()
 		return // 撮影中でない
 	}
-	ac.IsCapturing = false
 	if ac.CaptureStop != nil {
 		ac.CaptureStop() // 撮影Goroutineに停止を通知
 	}
 	ac.CaptureMu.Unlock()
 
-	ac.updateControlButtons()
-	ac.statusLabel.SetText("Status: Stopped")
-	ac.countdownLabel.SetText("Remaining: --:--:--")
+	ac.stopButton.Disable() // Start は保存が終わるまで無効のまま
+	ac.statusLabel.SetText("Status: Stopping...")
+}
+
+// finishCapture は撮影中の状態を解除し、ボタンを元に戻してステータスを status にします。
+// 撮影ゴルーチンからも呼び出すため、UI の更新は fyne.Do で行います。
+func (ac *AppContext) finishCapture(status string) {
+	ac.CaptureMu.Lock()
+	ac.IsCapturing = false
+	ac.CaptureMu.Unlock()
+
+	fyne.Do(func() {
+		ac.updateControlButtons()
+		ac.statusLabel.SetText(status)
+		ac.countdownLabel.SetText("Remaining: --:--:--")
+	})
 }
 
 // runCaptureLoop は実際のスクリーンショット撮影ループを実行します。
-func (ac *AppContext) runCaptureLoop() {
+// 撮影には引数で渡された capturer を使用します。
+func (ac *AppContext) runCaptureLoop(capturer screenshot.Capturer) {
+	var stopReason string // 撮影が自動的に停止した理由 (終了後もステータスに表示する)
+	// マニフェストに記録する停止の理由 (ループを抜ける箇所で設定する)
+	stopCode, stopDetail := screenshot.StopError, ""
+	// 最初に登録するため、キューの保存とマニフェストの終了 (後で登録する defer) の後に実行される
 	defer func() {
-		ac.CaptureMu.Lock()
-		ac.IsCapturing = false // ループ終了時にフラグをリセット
-		ac.CaptureMu.Unlock()
-		ac.updateControlButtons() // UIを更新
-		ac.statusLabel.SetText("Status: Idle")
+		switch {
+		case stopReason != "":
+			ac.finishCapture(fmt.Sprintf("Status: Stopped (%s)", stopReason))
+		case stopCode == screenshot.StopUser:
+			ac.finishCapture("Status: Stopped")
+		default:
+			ac.finishCapture("Status: Idle")
+		}
 	}()
 
 	interval := ac.Config.GetIntervalDuration()
 	captureDuration := ac.Config.GetCaptureDuration()
-	targetHWND := ac.selectedWindowInfo.HWND
+	target := ac.captureTarget()
 	saveDir := ac.Config.SaveDirectory
 
 	if interval <= 0 {
 		log.Println("Invalid interval specified. Stopping capture.")
-		dialog.ShowError(fmt.Errorf("capture interval must be positive"), ac.Window)
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("capture interval must be positive"), ac.Window) })
 		return
 	}
 
 	if err := os.MkdirAll(saveDir, 0755); err != nil {
-		dialog.ShowError(fmt.Errorf("failed to create save directory %s: %w", saveDir, err), ac.Window)
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("failed to create save directory %s: %w", saveDir, err), ac.Window)
+		})
 		return
 	}
 
+	if err := screenshot.ValidateTemplate(ac.Config.Output.FilenameTemplate); err != nil {
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("invalid file name template: %w", err), ac.Window) })
+		return
+	}
+
+	compression, err := screenshot.ParsePNGCompression(ac.Config.Output.PNGCompression)
+	if err != nil {
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("invalid output settings: %w", err), ac.Window) })
+		return
+	}
+	// エンコーダーはセッションごとに 1 つ作成し、作業バッファを全フレームで再利用する
+	encoder, err := screenshot.NewEncoder(ac.Config.Output.Format, screenshot.EncoderOptions{
+		JPEGQuality:    ac.Config.Output.JPEGQuality,
+		PNGCompression: compression,
+	})
+	if err != nil {
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("invalid output format: %w", err), ac.Window) })
+		return
+	}
+
+	dedup, err := screenshot.NewDuplicateFilter(screenshot.DedupOptions{
+		Mode:         screenshot.DedupMode(ac.Config.Dedup.Mode),
+		Tolerance:    ac.Config.Dedup.Tolerance,
+		ChangedRatio: ac.Config.Dedup.ChangedRatio,
+		HashDistance: ac.Config.Dedup.HashDistance,
+		Heartbeat:    time.Duration(ac.Config.Dedup.HeartbeatMinutes) * time.Minute,
+	})
+	if err != nil {
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("invalid dedup settings: %w", err), ac.Window) })
+		return
+	}
+
+	processors, err := ac.frameProcessors(target)
+	if err != nil {
+		fyne.Do(func() { dialog.ShowError(err, ac.Window) })
+		return
+	}
+
+	// ループが自動的に終了した場合にも、バックグラウンドの処理を止める。
+	// 撮影時間が過ぎた場合も、保存のキューの空きを待っている Submit を中断できるようにする
+	ctx, cancel := context.WithCancel(ac.CaptureCtx)
+	defer cancel()
+	if captureDuration > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, captureDuration)
+		defer cancelTimeout()
+	}
+
+	// 保存先の容量の管理
+	retention := ac.Config.Retention
+	janitor := screenshot.NewJanitor(saveDir, screenshot.RetentionOptions{
+		MaxBytes:   int64(retention.MaxTotalMB) << 20,
+		MaxFiles:   retention.MaxFiles,
+		MaxAge:     time.Duration(retention.MaxAgeHours) * time.Hour,
+		PerSession: retention.PerSession,
+		Template:   ac.Config.Output.FilenameTemplate,
+	})
+	minFree := uint64(retention.MinFreeMB) << 20
+	// lowDiskSpace は空き容量が下限を下回っている場合に、その説明を返します
+	lowDiskSpace := func() string {
+		if minFree == 0 {
+			return ""
+		}
+		free, err := screenshot.FreeSpace(saveDir)
+		if err != nil || free >= minFree {
+			return ""
+		}
+		return fmt.Sprintf("low disk space: %d MB free, minimum %d MB", free>>20, retention.MinFreeMB)
+	}
+	if reason := lowDiskSpace(); reason != "" {
+		log.Printf("Not starting capture: %s\n", reason)
+		stopReason = reason
+		return
+	}
+
+	startTime := time.Now()
+	sessionID := startTime.Format("20060102-150405")
+
+	// 保存したフレームの記録
+	manifest, err := screenshot.OpenManifest(saveDir, sessionID)
+	if err != nil {
+		fyne.Do(func() { dialog.ShowError(err, ac.Window) })
+		return
+	}
+	log.Printf("Writing manifest to %s\n", manifest.Path())
+
+	// エンコードと書き込みはワーカーで行い、このゴルーチンは撮影だけを行う
+	var skipped atomic.Int64 // 変化がなかったため保存を省略したフレームの数
+	var pipeline *screenshot.Pipeline
+	currentStats := func() captureStats {
+		st := pipeline.Stats()
+		return captureStats{
+			Saved:   st.Saved,
+			Skipped: int(skipped.Load()),
+			Failed:  st.Failed,
+			Dropped: st.Dropped,
+			Queued:  st.QueueDepth,
+		}
+	}
+	// showStats はワーカーのゴルーチンからも呼び出されるため、UI の更新は fyne.Do で行う
+	showStats := func() {
+		fyne.Do(func() {
+			ac.captureCountLabel.SetText(currentStats().String())
+		})
+	}
+	pipeline, err = screenshot.NewPipeline(screenshot.PipelineOptions{
+		Workers:    ac.Config.Pipeline.Workers,
+		QueueSize:  ac.Config.Pipeline.QueueSize,
+		Drop:       screenshot.DropPolicy(ac.Config.Pipeline.DropPolicy),
+		SaveDir:    saveDir,
+		Template:   ac.Config.Output.FilenameTemplate,
+		Encoder:    encoder,
+		Processors: processors,
+		OnSaved: func(job screenshot.Job, saved screenshot.SavedFile, err error) {
+			if err != nil {
+				log.Printf("Error saving screenshot: %v\n", err)
+			} else {
+				janitor.Track(saved.Path)
+				if err := manifest.WriteFrame(job.Frame, saved); err != nil {
+					log.Printf("Error writing manifest: %v\n", err)
+				}
+			}
+			showStats()
+		},
+	})
+	if err != nil {
+		manifest.Close()
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("invalid pipeline settings: %w", err), ac.Window) })
+		return
+	}
+	// 設定は値をコピーして、セッション開始時のスナップショットとして記録する (復元トークンは含めない)
+	snapshot := *ac.Config
+	snapshot.PortalRestoreToken = ""
+	if err := manifest.WriteHeader(startTime, describeTarget(target), snapshot); err != nil {
+		log.Printf("Error writing manifest: %v\n", err)
+	}
+	// 停止時はキューに残っているフレームをすべて保存してからセッションを終了する
+	defer func() {
+		if n := pipeline.Stats().QueueDepth; n > 0 {
+			fyne.Do(func() {
+				ac.statusLabel.SetText(fmt.Sprintf("Status: Saving %d queued screenshot(s)...", n))
+			})
+		}
+		pipeline.Close()
+		// 最後に保存した分も含めて上限を適用する
+		if _, err := janitor.Sweep(time.Now()); err != nil {
+			log.Printf("Retention sweep failed: %v\n", err)
+		}
+		showStats()
+		stats := currentStats()
+		log.Printf("Capture session finished. %s\n", stats)
+		// フッターはすべてのフレームを記録した後に書き込む
+		if err := manifest.WriteFooter(screenshot.ManifestFooter{
+			Time:    time.Now(),
+			Reason:  stopCode,
+			Detail:  stopDetail,
+			Saved:   stats.Saved,
+			Skipped: stats.Skipped,
+			Failed:  stats.Failed,
+			Dropped: stats.Dropped,
+		}); err != nil {
+			log.Printf("Error writing manifest: %v\n", err)
+		}
+		if err := manifest.Close(); err != nil {
+			log.Printf("Error closing manifest: %v\n", err)
+		}
+	}()
+
+	go janitor.Run(ctx, time.Minute)
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -382,28 +1001,36 @@ func (ac *AppContext) runCaptureLoop() {
 		defer timer.Stop()
 	}
 
-	captureCount := 0
-	fileSequenceCounter := 0 // スクリーンショットを保存するたびに増加
+	frameIndex := 0                                 // セッション全体の通し番号 (保存を試みるたびに増加し、リセットしない)
+	fileSequenceCounter := 0                        // 同じ秒に撮影したフレームの連番
+	var lastSecond time.Time                        // 前回のフレームの撮影時刻 (秒単位)
+	paused := false                                 // ウィンドウの状態により一時停止中かどうか
+	var lastSize image.Point                        // 最後に撮影できた画像のサイズ (代わりの画像に使用)
+	recter, _ := capturer.(screenshot.WindowRecter) // ウィンドウの位置をマニフェストに記録する (対応するバックエンドのみ)
 
-	startTime := time.Now()
-	lastSecond := startTime.Second() // 追加: 前回の秒を記録
+	// ファイル名のテンプレートに使用する撮影対象の情報
+	window := ac.selectedWindowInfo
+	monitor := -1
+	if target.Kind == screenshot.TargetMonitor {
+		monitor = target.Monitor
+	}
 
 	go func() {
 		for {
 			select {
-			case <-ac.CaptureCtx.Done():
+			case <-ctx.Done():
 				return // 撮影が停止された
 			case <-time.After(time.Second): // 1秒ごとにカウントダウンを更新
+				text := "Remaining: Manual Stop"
 				if captureDuration > 0 {
 					elapsed := time.Since(startTime)
 					remaining := captureDuration - elapsed
 					if remaining < 0 {
 						remaining = 0
 					}
-					ac.countdownLabel.SetText(fmt.Sprintf("Remaining: %s", formatDuration(remaining)))
-				} else {
-					ac.countdownLabel.SetText("Remaining: Manual Stop")
+					text = fmt.Sprintf("Remaining: %s", formatDuration(remaining))
 				}
+				fyne.Do(func() { ac.countdownLabel.SetText(text) })
 			}
 		}
 	}()
@@ -412,6 +1039,7 @@ func (ac *AppContext) runCaptureLoop() {
 		select {
 		case <-ac.CaptureCtx.Done():
 			log.Println("Capture loop finished due to cancellation.")
+			stopCode = screenshot.StopUser
 			return
 		case <-func() <-chan time.Time {
 			if timer != nil {
@@ -421,31 +1049,317 @@ func (ac *AppContext) runCaptureLoop() {
 		}():
 			if captureDuration > 0 {
 				log.Println("Capture duration elapsed. Stopping capture.")
+				stopCode = screenshot.StopDurationElapsed
 				return
 			}
-		case t := <-ticker.C: // ticker.C から現在の時刻を取得
-			// 秒が更新されたかチェックし、カウンターをリセット
-			currentSecond := t.Second()
-			if currentSecond != lastSecond {
+		case <-ticker.C:
+			if reason := lowDiskSpace(); reason != "" {
+				log.Printf("Stopping capture: %s\n", reason)
+				stopReason = reason
+				stopCode, stopDetail = screenshot.StopError, reason
+				return
+			}
+
+			// 撮影時刻はフレームごとに 1 回だけ取得し、ファイル名とメタデータのすべてでこの値を使用する
+			// (別々に time.Now() を呼ぶと秒の境界で連番とファイル名の時刻が食い違うため)
+			capturedAt := time.Now()
+			if second := capturedAt.Truncate(time.Second); !second.Equal(lastSecond) {
 				fileSequenceCounter = 0 // 秒が変わったらカウンターをリセット
-				lastSecond = currentSecond
+				lastSecond = second
 			}
 
-			img, err := screenshot.CaptureWindow(targetHWND)
+			img, err := screenshot.Capture(capturer, target)
+			latency := time.Since(capturedAt)
+			var windowRect image.Rectangle
+			if err == nil && recter != nil && needsWindow(target) {
+				windowRect, _ = recter.WindowRect(target.HWND)
+			}
 			if err != nil {
-				log.Printf("Error capturing screenshot for HWND %d: %v\n", targetHWND, err)
+				policy, state := ac.windowPolicy(err)
+				switch policy {
+				case policyPlaceholder:
+					log.Printf("Window is %s. Saving a placeholder frame: %v\n", state, err)
+					// 保存の前に加工されることがあるため、毎回新しい画像を作成する
+					img = placeholderFrame(lastSize)
+				case policyPause:
+					if !paused {
+						log.Printf("Window is %s. Pausing capture until it is restored: %v\n", state, err)
+						paused = true
+						fyne.Do(func() { ac.statusLabel.SetText(fmt.Sprintf("Status: Paused (window %s)", state)) })
+					}
+					if errors.Is(err, screenshot.ErrWindowGone) {
+						// 同じアプリケーションが再び開かれた場合に備えて、ウィンドウを探し直す
+						if windows, err := screenshot.ResolveWindow(capturer, ac.windowMatcher()); err == nil && len(windows) > 0 {
+							log.Printf("Window reappeared as HWND %d.\n", windows[0].HWND)
+							window = windows[0]
+							target.HWND = window.HWND
+						}
+					}
+					continue
+				case policyStop:
+					log.Printf("Window is %s. Stopping capture: %v\n", state, err)
+					fyne.Do(func() {
+						dialog.ShowInformation("Capture Stopped", fmt.Sprintf("The target window is %s.", state), ac.Window)
+					})
+					stopReason = fmt.Sprintf("window %s", state)
+					stopCode, stopDetail = screenshot.StopWindow, err.Error()
+					return
+				default: // policySkip または ウィンドウの状態以外のエラー
+					log.Printf("Error capturing screenshot for %s: %v\n", describeTarget(target), err)
+					continue
+				}
+			} else {
+				lastSize = img.Bounds().Size()
+			}
+			if paused {
+				log.Println("Window restored. Resuming capture.")
+				paused = false
+				fyne.Do(func() { ac.statusLabel.SetText("Status: Capturing...") })
+			}
+
+			// 前回保存したフレームから変化がなければ保存しない
+			if dedup.Check(img, capturedAt) {
+				screenshot.ReleaseImage(img)
+				skipped.Add(1)
+				showStats()
 				continue
 			}
 
-			_, err = screenshot.SaveScreenshotWithCounter(img, saveDir, fileSequenceCounter)
-			if err != nil {
-				log.Printf("Error saving screenshot: %v\n", err)
+			// 画像の解放はワーカーが保存後 (またはキューから捨てたとき) に行う
+			accepted := pipeline.Submit(ctx, screenshot.Job{Image: img, Frame: screenshot.FrameInfo{
+				Time:        capturedAt,
+				Counter:     fileSequenceCounter,
+				Frame:       frameIndex,
+				SessionID:   sessionID,
+				WindowTitle: window.Title,
+				ProcessName: window.ProcessName,
+				Monitor:     monitor,
+				WindowRect:  windowRect,
+				Latency:     latency,
+			}})
+			if accepted {
+				// 保存の完了を待たずに次の比較の基準にする
+				dedup.Saved(capturedAt)
+			} else if ctx.Err() != nil {
+				// キューの空きを待つ間に停止された。ループの先頭で停止の理由を判定する
+				log.Println("Capture stopped while waiting for the save queue. Dropped the frame.")
 			} else {
-				captureCount++
-				fileSequenceCounter++ // カウンターをインクリメント
-				ac.captureCountLabel.SetText(fmt.Sprintf("Screenshots: %d", captureCount))
+				// キューが一杯で捨てられた (パイプラインの Dropped に数えられる)。保存されないため比較の基準にはしない
+				log.Println("Save queue is full. Dropped the frame.")
 			}
+			// キューから捨てられたり保存に失敗したりしても番号は再利用しない
+			frameIndex++
+			fileSequenceCounter++
+			showStats()
+		}
+	}
+}
+
+// frameProcessors は設定に応じて保存の前にフレームに適用する処理を作成します。
+// マスクで隠した部分にテキストが重ならないよう、マスクはオーバーレイより先に適用します。
+func (ac *AppContext) frameProcessors(target screenshot.Target) ([]screenshot.FrameProcessor, error) {
+	var processors []screenshot.FrameProcessor
+	if redaction := ac.Config.Redaction; len(redaction.Masks) > 0 {
+		opts := screenshot.RedactionOptions{
+			Reference: image.Pt(redaction.ReferenceWidth, redaction.ReferenceHeight),
+		}
+		if target.Region != nil && target.Region.Anchor == screenshot.AnchorWindow {
+			opts.Origin = target.Region.Rect.Min // 切り出した領域の左上のウィンドウ上の位置
+		}
+		for i, m := range redaction.Masks {
+			rule := screenshot.MaskRule{
+				Rect:       image.Rect(m.X, m.Y, m.X+m.Width, m.Y+m.Height),
+				Mode:       screenshot.MaskMode(m.Mode),
+				BlockSize:  m.BlockSize,
+				BlurRadius: m.BlurRadius,
+			}
+			if m.Color != "" {
+				c, err := screenshot.ParseHexColor(m.Color)
+				if err != nil {
+					return nil, fmt.Errorf("invalid mask %d: %w", i+1, err)
+				}
+				rule.Color = c
+			}
+			opts.Rules = append(opts.Rules, rule)
+		}
+		redactor, err := screenshot.NewRedactor(opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction settings: %w", err)
+		}
+		processors = append(processors, redactor)
+	}
+	// マスクの座標は撮影した大きさの画像に対するものなので、縮小はマスクの後に行う
+	scaler, err := screenshot.NewScaler(screenshot.ScaleOptions{
+		Factor:    ac.Config.Scale.Factor,
+		MaxWidth:  ac.Config.Scale.MaxWidth,
+		MaxHeight: ac.Config.Scale.MaxHeight,
+		Kernel:    screenshot.ScaleKernel(ac.Config.Scale.Kernel),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid scale settings: %w", err)
+	}
+	if !scaler.IsNoop() {
+		processors = append(processors, scaler)
+	}
+	if o := ac.Config.Overlay; o.Enabled {
+		textColor, err := screenshot.ParseHexColor(o.TextColor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid overlay settings: %w", err)
+		}
+		bgColor, err := screenshot.ParseHexColor(o.BackgroundColor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid overlay settings: %w", err)
 		}
+		overlay, err := screenshot.NewOverlay(screenshot.OverlayOptions{
+			ShowTime:          o.ShowTime,
+			ShowTitle:         o.ShowTitle,
+			ShowFrame:         o.ShowFrame,
+			Label:             o.Label,
+			Position:          screenshot.OverlayPosition(o.Position),
+			FontSize:          o.FontSize,
+			FontFile:          o.FontFile,
+			TextColor:         textColor,
+			BackgroundColor:   bgColor,
+			BackgroundOpacity: o.BackgroundOpacity,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid overlay settings: %w", err)
+		}
+		processors = append(processors, overlay)
+	}
+	// 色数の削減はオーバーレイの文字も含めて行うため最後に適用する
+	reducer, err := screenshot.NewColorReducer(screenshot.ColorOptions{
+		Mode:          screenshot.ColorMode(ac.Config.Output.ColorMode),
+		PaletteColors: ac.Config.Output.PaletteColors,
+		Dither:        ac.Config.Output.Dither,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid output settings: %w", err)
+	}
+	if !reducer.IsNoop() {
+		processors = append(processors, reducer)
+	}
+	return processors, nil
+}
+
+// captureStats は撮影セッションの統計です。
+type captureStats struct {
+	Saved   int // 保存したフレーム
+	Skipped int // 変化がなかったため保存を省略したフレーム
+	Failed  int // 保存に失敗したフレーム
+	Dropped int // 保存が追いつかずキューから捨てたフレーム
+	Queued  int // 保存を待っているフレーム
+}
+
+// String は統計をステータス表示用の文字列にします。
+func (s captureStats) String() string {
+	text := fmt.Sprintf("Screenshots: %d", s.Saved)
+	if s.Skipped > 0 {
+		text += fmt.Sprintf(" (unchanged: %d skipped)", s.Skipped)
+	}
+	if s.Failed > 0 {
+		text += fmt.Sprintf(" (failed: %d)", s.Failed)
+	}
+	if s.Dropped > 0 {
+		text += fmt.Sprintf(" (dropped: %d)", s.Dropped)
+	}
+	if s.Queued > 0 {
+		text += fmt.Sprintf(" (queued: %d)", s.Queued)
+	}
+	return text
+}
+
+// windowPolicy は撮影エラーがウィンドウの状態によるものであれば、設定された動作と状態の説明を返します。
+// それ以外のエラーの場合は policySkip を返します。
+func (ac *AppContext) windowPolicy(err error) (policy, state string) {
+	switch {
+	case errors.Is(err, screenshot.ErrWindowMinimized):
+		policy, state = ac.Config.WindowPolicy.Minimized, "minimized"
+	case errors.Is(err, screenshot.ErrWindowGone):
+		policy, state = ac.Config.WindowPolicy.Gone, "closed"
+	default:
+		return policySkip, ""
+	}
+	if policy == "" {
+		policy = policySkip
+	}
+	return policy, state
+}
+
+// placeholderFrame はウィンドウを撮影できない間に保存する、灰色で塗りつぶした画像を作成します。
+// size が空の場合 (一度も撮影できていない場合) は 640x480 の画像を作成します。
+func placeholderFrame(size image.Point) *image.RGBA {
+	if size.X <= 0 || size.Y <= 0 {
+		size = image.Pt(640, 480)
+	}
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff}), image.Point{}, draw.Src)
+	return img
+}
+
+// captureTarget は現在の設定と選択されたウィンドウから撮影対象を組み立てます。
+func (ac *AppContext) captureTarget() screenshot.Target {
+	kind := screenshot.TargetKind(ac.Config.CaptureTarget)
+	if kind == "" {
+		kind = screenshot.TargetWindow
+	}
+	target := screenshot.Target{
+		Kind:    kind,
+		HWND:    ac.selectedWindowInfo.HWND,
+		Monitor: ac.Config.MonitorIndex,
+	}
+	if r := ac.Config.Region; r.Enabled {
+		target.Region = &screenshot.Region{
+			Anchor: screenshot.RegionAnchor(r.Anchor),
+			Rect:   image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height),
+		}
+	}
+	return target
+}
+
+// needsWindow は撮影対象にウィンドウの選択が必要かどうかを返します。
+func needsWindow(t screenshot.Target) bool {
+	if t.Region != nil {
+		return t.Region.Anchor == screenshot.AnchorWindow
+	}
+	return t.Kind == screenshot.TargetWindow
+}
+
+// parseRegion は "x,y,width,height" 形式の文字列を矩形に変換します。
+func parseRegion(s string) (image.Rectangle, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("region must be x,y,width,height")
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("region must be x,y,width,height")
+		}
+		v[i] = n
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return image.Rectangle{}, fmt.Errorf("region width and height must be positive")
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// describeTarget はログ表示用に撮影対象を文字列にします。
+func describeTarget(t screenshot.Target) string {
+	if t.Region != nil {
+		if t.Region.Anchor == screenshot.AnchorScreen {
+			return fmt.Sprintf("screen region %v", t.Region.Rect)
+		}
+		return fmt.Sprintf("region %v of HWND %d", t.Region.Rect, t.HWND)
+	}
+	switch t.Kind {
+	case screenshot.TargetAllMonitors:
+		return "all monitors"
+	case screenshot.TargetMonitor:
+		return fmt.Sprintf("monitor %d", t.Monitor)
+	default:
+		return fmt.Sprintf("HWND %d", t.HWND)
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"log"
 	"myscreenshot-tool/config"
 	"myscreenshot-tool/gui" // guiパッケージをインポート
+	"myscreenshot-tool/screenshot"
 )
 
 func main() {
@@ -15,9 +16,33 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// プラットフォームに応じた撮影バックエンドの選択
+	opts, err := capturerOptions(cfg.Alpha)
+	if err != nil {
+		log.Printf("Warning: invalid alpha settings, using the default: %v", err)
+	}
+	capturer, err := screenshot.NewCapturer(opts)
+	if err != nil {
+		log.Fatalf("Failed to initialize capture backend: %v", err)
+	}
+
 	// GUIアプリケーションの初期化と実行
-	appCtx := gui.NewApp(cfg)
+	appCtx := gui.NewApp(cfg, capturer)
 	appCtx.Run()
 
 	// アプリケーションが終了すると、SetOnClosed で設定を保存する処理が実行される
 }
+
+// capturerOptions は設定から撮影バックエンドのオプションを作成します。
+// 設定が正しくない場合は、既定のオプションとエラーを返します。
+func capturerOptions(alpha config.AlphaSetting) (screenshot.CapturerOptions, error) {
+	background, err := screenshot.ParseHexColor(alpha.Background)
+	if err != nil {
+		return screenshot.CapturerOptions{}, err
+	}
+	opts := screenshot.CapturerOptions{Alpha: screenshot.AlphaPolicy(alpha.Policy), Background: background}
+	if err := opts.Validate(); err != nil {
+		return screenshot.CapturerOptions{}, err
+	}
+	return opts, nil
+}
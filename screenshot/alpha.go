@@ -0,0 +1,98 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// AlphaPolicy は撮影した画像のアルファ (不透明度) の扱いです。値は config.AlphaSetting.Policy にそのまま保存されます。
+// GDI の PrintWindow や BitBlt はアルファを設定しないことが多く、そのまま保存すると透明な画像になるため、
+// 通常は AlphaOpaque を使用します。
+type AlphaPolicy string
+
+const (
+	AlphaOpaque AlphaPolicy = "opaque" // アルファを捨ててすべてのピクセルを不透明にする
+	AlphaKeep   AlphaPolicy = "keep"   // 取得したアルファをそのまま保存する
+	// AlphaPremultiply は背景色の上に重ねて不透明にします (アルファが乗算済みのピクセルとして合成します)。
+	// 半透明のウィンドウを見た目に近い色で保存する場合に使用します。
+	AlphaPremultiply AlphaPolicy = "premultiply"
+)
+
+// CapturerOptions は NewCapturer で作成するバックエンドの設定です。作成後は変更できません。
+// 対応していないバックエンドでは無視されます。
+type CapturerOptions struct {
+	// Alpha は撮影した画像のアルファの扱いです (GDI バックエンドのみ)。空の場合は AlphaOpaque です。
+	Alpha AlphaPolicy
+	// Background は AlphaPremultiply で重ねる背景色です。nil の場合は白です。
+	Background color.Color
+}
+
+// Validate は設定が正しい値かどうかを確認します。
+func (o CapturerOptions) Validate() error {
+	if o.Alpha == "" {
+		return nil
+	}
+	return validateAlphaPolicy(o.Alpha)
+}
+
+// validateAlphaPolicy はアルファの扱いが正しい値かどうかを確認します。
+func validateAlphaPolicy(policy AlphaPolicy) error {
+	switch policy {
+	case AlphaOpaque, AlphaKeep, AlphaPremultiply:
+		return nil
+	}
+	return fmt.Errorf("unknown alpha policy %q", policy)
+}
+
+// ApplyAlphaPolicy は撮影した画像のアルファを policy に従ってその場で書き換えます。
+// どの policy でも、すべてのピクセルのアルファが 0 の場合はアルファが設定されていないものとみなし、不透明にします
+// (そのまま保存すると何も見えない画像になるため)。
+func ApplyAlphaPolicy(img *image.RGBA, policy AlphaPolicy, background color.Color) {
+	if policy == AlphaOpaque || allAlphaZero(img) {
+		dropAlpha(img)
+		return
+	}
+	if policy == AlphaPremultiply {
+		compositeOver(img, background)
+	}
+}
+
+// allAlphaZero はすべてのピクセルのアルファが 0 かどうかを返します。
+// 通常の画像では最初のピクセルで判定が終わるため、ほとんど時間はかかりません。
+func allAlphaZero(img *image.RGBA) bool {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):img.PixOffset(img.Rect.Max.X, y)]
+		for i := 3; i < len(row); i += 4 {
+			if row[i] != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compositeOver はアルファが乗算済みのピクセルを不透明な背景色の上に重ねます。
+func compositeOver(img *image.RGBA, background color.Color) {
+	if background == nil {
+		background = color.White
+	}
+	bg := color.NRGBAModel.Convert(background).(color.NRGBA)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):img.PixOffset(img.Rect.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			a := row[i+3]
+			if a == 0xff {
+				continue
+			}
+			inv := 255 - uint32(a)
+			// 乗算済みでない (アルファより大きい) 値が入っている場合もあるため 255 で打ち切る
+			row[i] = uint8(min(uint32(row[i])+(uint32(bg.R)*inv+127)/255, 255))
+			row[i+1] = uint8(min(uint32(row[i+1])+(uint32(bg.G)*inv+127)/255, 255))
+			row[i+2] = uint8(min(uint32(row[i+2])+(uint32(bg.B)*inv+127)/255, 255))
+			row[i+3] = 0xff
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestApplyAlphaPolicyAllZeroAlpha(t *testing.T) {
+	// アルファが設定されていない画像は、どの扱いでも色をそのままにして不透明にする
+	for _, policy := range []AlphaPolicy{AlphaOpaque, AlphaKeep, AlphaPremultiply} {
+		img := filledRGBA(image.Rect(0, 0, 3, 2), color.RGBA{0x10, 0x20, 0x30, 0})
+		ApplyAlphaPolicy(img, policy, color.Black)
+		for i := 0; i < len(img.Pix); i += 4 {
+			if got := (color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}); got != (color.RGBA{0x10, 0x20, 0x30, 0xff}) {
+				t.Fatalf("%s: pixel %d = %v, want opaque with the same color", policy, i/4, got)
+			}
+		}
+	}
+}
+
+func TestApplyAlphaPolicy(t *testing.T) {
+	translucent := color.RGBA{0x40, 0x20, 0x00, 0x80} // アルファが乗算済みの半透明のピクセル
+	overflow := color.RGBA{0xff, 0x00, 0x00, 0x80}    // 乗算済みでない (アルファより大きい) 値
+	opaque := color.RGBA{0x01, 0x02, 0x03, 0xff}
+	tests := []struct {
+		policy     AlphaPolicy
+		background color.Color
+		want       []color.RGBA // translucent, overflow, opaque の順
+	}{
+		{AlphaOpaque, nil, []color.RGBA{{0x40, 0x20, 0x00, 0xff}, {0xff, 0x00, 0x00, 0xff}, opaque}},
+		{AlphaKeep, nil, []color.RGBA{translucent, overflow, opaque}},
+		// 背景の寄与は背景色 * (255 - 128) / 255
+		{AlphaPremultiply, color.RGBA{0xff, 0x00, 0x80, 0xff}, []color.RGBA{{0x40 + 127, 0x20, 0x00 + 64, 0xff}, {0xff, 0x00, 64, 0xff}, opaque}},
+		{AlphaPremultiply, nil, []color.RGBA{{0x40 + 127, 0x20 + 127, 127, 0xff}, {0xff, 127, 127, 0xff}, opaque}}, // 既定の背景は白
+	}
+	for _, tt := range tests {
+		img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+		for x, c := range []color.RGBA{translucent, overflow, opaque} {
+			img.SetRGBA(x, 0, c)
+		}
+		ApplyAlphaPolicy(img, tt.policy, tt.background)
+		for x, want := range tt.want {
+			if got := img.RGBAAt(x, 0); got != want {
+				t.Errorf("%s over %v: pixel %d = %v, want %v", tt.policy, tt.background, x, got, want)
+			}
+		}
+	}
+}
+
+func TestApplyAlphaPolicySubImage(t *testing.T) {
+	// 部分画像に適用した場合は、その範囲のピクセルだけを書き換える
+	img := filledRGBA(image.Rect(0, 0, 4, 4), color.RGBA{0, 0, 0, 0x80})
+	sub := img.SubImage(image.Rect(1, 1, 3, 3)).(*image.RGBA)
+	ApplyAlphaPolicy(sub, AlphaPremultiply, color.White)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := color.RGBA{0, 0, 0, 0x80}
+			if image.Pt(x, y).In(sub.Rect) {
+				want = color.RGBA{127, 127, 127, 0xff}
+			}
+			if got := img.RGBAAt(x, y); got != want {
+				t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestCapturerOptionsValidate(t *testing.T) {
+	for _, opts := range []CapturerOptions{{}, {Alpha: AlphaKeep}, {Alpha: AlphaPremultiply, Background: color.Black}} {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+	if err := (CapturerOptions{Alpha: "translucent"}).Validate(); err == nil {
+		t.Error("expected an error for an unknown alpha policy")
+	}
+}
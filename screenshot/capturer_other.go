@@ -0,0 +1,11 @@
+//go:build !windows && !linux
+
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+// NewCapturer は実行中のプラットフォームのデフォルトバックエンドを返します。
+// このプラットフォームには実装がないため ErrUnsupportedPlatform を返します。
+func NewCapturer(opts CapturerOptions) (Capturer, error) {
+	return nil, ErrUnsupportedPlatform
+}
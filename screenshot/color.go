@@ -0,0 +1,353 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+)
+
+// ColorMode は保存する画像の色の表現です。値は config.OutputSetting.ColorMode にそのまま保存されます。
+// PNG は画像の種類に応じて、RGB (不透明な場合)、8 ビットのグレースケール、パレットの形式で書き込まれます。
+type ColorMode string
+
+const (
+	ColorRGBA    ColorMode = "rgba"    // 撮影したまま (アルファを含む 32 ビット)
+	ColorRGB     ColorMode = "rgb"     // アルファを捨てて不透明にする (24 ビット)
+	ColorGray    ColorMode = "gray"    // 8 ビットのグレースケール
+	ColorPalette ColorMode = "palette" // 画像ごとに作成した最大 N 色のパレット (8 ビット以下)
+)
+
+// ColorModes は選択できる色の表現の一覧を返します。
+func ColorModes() []string {
+	return []string{string(ColorRGBA), string(ColorRGB), string(ColorGray), string(ColorPalette)}
+}
+
+// DefaultPaletteColors は PaletteColors が指定されていない場合のパレットの色数です。
+const DefaultPaletteColors = 256
+
+// ColorOptions は ColorReducer の設定です。
+type ColorOptions struct {
+	Mode          ColorMode
+	PaletteColors int  // ColorPalette の最大の色数 (2-256、0 の場合は DefaultPaletteColors)
+	Dither        bool // ColorPalette で誤差拡散 (Floyd-Steinberg) を行う
+}
+
+// ColorReducer は保存の前に画像の色数を減らす FrameProcessor です。
+// 文字の多いウィンドウは色数を減らすとファイルサイズが大きく減ります。
+type ColorReducer struct {
+	opts ColorOptions
+}
+
+// NewColorReducer は設定を確認して ColorReducer を作成します。
+func NewColorReducer(opts ColorOptions) (*ColorReducer, error) {
+	switch opts.Mode {
+	case "":
+		opts.Mode = ColorRGBA
+	case ColorRGBA, ColorRGB, ColorGray:
+	case ColorPalette:
+		if opts.PaletteColors == 0 {
+			opts.PaletteColors = DefaultPaletteColors
+		}
+		if opts.PaletteColors < 2 || opts.PaletteColors > 256 {
+			return nil, fmt.Errorf("palette colors must be between 2 and 256: %d", opts.PaletteColors)
+		}
+	default:
+		return nil, fmt.Errorf("unknown color mode %q", opts.Mode)
+	}
+	return &ColorReducer{opts: opts}, nil
+}
+
+// IsNoop は設定が画像を変換しないかどうかを返します。
+func (c *ColorReducer) IsNoop() bool {
+	return c.opts.Mode == ColorRGBA
+}
+
+// Process は画像を設定された色の表現に変換します。
+// ColorRGBA 以外では新しい画像を返し、img は書き換えません (後の処理が元の画像を参照しても問題ありません)。
+func (c *ColorReducer) Process(img image.Image, frame FrameInfo) (image.Image, error) {
+	switch c.opts.Mode {
+	case ColorRGB:
+		return toOpaque(asRGBA(img)), nil
+	case ColorGray:
+		return toGray(asRGBA(img)), nil
+	case ColorPalette:
+		return quantize(asRGBA(img), c.opts.PaletteColors, c.opts.Dither), nil
+	default: // ColorRGBA
+		return img, nil
+	}
+}
+
+// dropAlpha はすべてのピクセルを不透明にします。
+// ピクセルはアルファを乗算済みなので、RGB の値はアルファが 0 の部分では黒になります。
+func dropAlpha(img *image.RGBA) {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):img.PixOffset(img.Rect.Max.X, y)]
+		for i := 3; i < len(row); i += 4 {
+			row[i] = 0xff
+		}
+	}
+}
+
+// toOpaque はアルファを捨てて不透明にした画像のコピーを返します (dropAlpha と同じく RGB の値はそのまま使用します)。
+func toOpaque(src *image.RGBA) *image.RGBA {
+	b := src.Rect
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()*4]
+		copy(out, src.Pix[y*src.Stride:])
+		for i := 3; i < len(out); i += 4 {
+			out[i] = 0xff
+		}
+	}
+	return dst
+}
+
+// toGray は画像を 8 ビットのグレースケールに変換します (color.GrayModel と同じ係数)。
+func toGray(src *image.RGBA) *image.Gray {
+	b := src.Rect
+	dst := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+b.Dx()*4]
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+b.Dx()]
+		for x := range out {
+			p := row[x*4 : x*4+3]
+			out[x] = uint8((19595*uint32(p[0]) + 38470*uint32(p[1]) + 7471*uint32(p[2]) + 1<<15) >> 16)
+		}
+	}
+	return dst
+}
+
+// パレットの作成には、各チャンネルの上位 5 ビットでまとめた色のヒストグラムを使用する
+const (
+	quantBits    = 5
+	quantShift   = 8 - quantBits
+	quantBuckets = 1 << (3 * quantBits)
+)
+
+// bucketOf は色のヒストグラムの位置を返します。
+func bucketOf(r, g, b uint8) int {
+	return int(r>>quantShift)<<(2*quantBits) | int(g>>quantShift)<<quantBits | int(b>>quantShift)
+}
+
+// colorBucket はヒストグラムの 1 つの位置に含まれるピクセルの集計です。
+type colorBucket struct {
+	count   int
+	r, g, b int      // 色の合計 (平均の色の計算に使用)
+	key     [3]uint8 // 各チャンネルの上位ビット (ヒストグラムの位置)
+}
+
+// colorBox はメディアンカットで分割する色の範囲です。
+type colorBox struct {
+	buckets []colorBucket
+	count   int
+}
+
+// quantize はメディアンカット法で最大 n 色のパレットを作成し、パレット画像に変換します。
+// 画像の色 (アルファを除く) が n 色以下の場合は、その色をそのままパレットにして色を変えずに変換します。
+// パレットの色は不透明です。
+func quantize(src *image.RGBA, n int, dither bool) *image.Paletted {
+	size := src.Rect.Size()
+	if dst, ok := quantizeExact(src, n); ok {
+		return dst
+	}
+	histogram := make([]colorBucket, quantBuckets)
+	for y := 0; y < size.Y; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+size.X*4]
+		for i := 0; i < len(row); i += 4 {
+			h := &histogram[bucketOf(row[i], row[i+1], row[i+2])]
+			h.count++
+			h.r += int(row[i])
+			h.g += int(row[i+1])
+			h.b += int(row[i+2])
+		}
+	}
+	var used []colorBucket
+	for i, h := range histogram {
+		if h.count > 0 {
+			h.key = [3]uint8{uint8(i >> (2 * quantBits)), uint8(i >> quantBits & (1<<quantBits - 1)), uint8(i & (1<<quantBits - 1))}
+			used = append(used, h)
+		}
+	}
+
+	palette := medianCut(used, n)
+	dst := image.NewPaletted(image.Rect(0, 0, size.X, size.Y), palette)
+	if len(palette) == 0 {
+		return dst // 空の画像
+	}
+
+	// ヒストグラムの位置ごとに最も近いパレットの色を必要になったときに求めて記録する
+	lookup := make([]int16, quantBuckets)
+	for i := range lookup {
+		lookup[i] = -1
+	}
+	nearest := func(r, g, b uint8) uint8 {
+		k := bucketOf(r, g, b)
+		if lookup[k] < 0 {
+			lookup[k] = int16(palette.Index(color.RGBA{R: r | 1<<(quantShift-1), G: g | 1<<(quantShift-1), B: b | 1<<(quantShift-1), A: 0xff}))
+		}
+		return uint8(lookup[k])
+	}
+
+	if !dither {
+		for y := 0; y < size.Y; y++ {
+			row := src.Pix[y*src.Stride : y*src.Stride+size.X*4]
+			out := dst.Pix[y*dst.Stride : y*dst.Stride+size.X]
+			for x := range out {
+				out[x] = nearest(row[x*4], row[x*4+1], row[x*4+2])
+			}
+		}
+		return dst
+	}
+
+	// Floyd-Steinberg の誤差拡散: 量子化の誤差を右と下の行のピクセルに 7:3:5:1 の比率で分配する
+	cur := make([][3]int32, size.X+2)
+	next := make([][3]int32, size.X+2)
+	for y := 0; y < size.Y; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+size.X*4]
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+size.X]
+		for x := range out {
+			var v [3]uint8
+			for c := 0; c < 3; c++ {
+				v[c] = clampUint8(int32(row[x*4+c]) + cur[x+1][c]/16)
+			}
+			idx := nearest(v[0], v[1], v[2])
+			out[x] = idx
+			pc := palette[idx].(color.RGBA)
+			p := [3]uint8{pc.R, pc.G, pc.B}
+			for c := 0; c < 3; c++ {
+				e := int32(v[c]) - int32(p[c])
+				cur[x+2][c] += e * 7
+				next[x][c] += e * 3
+				next[x+1][c] += e * 5
+				next[x+2][c] += e * 1
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+	return dst
+}
+
+// quantizeExact は画像の色が n 色以下の場合に、その色をパレットにしたパレット画像を返します。
+// n 色を超える場合は、それがわかった時点で走査をやめて false を返します。
+func quantizeExact(src *image.RGBA, n int) (*image.Paletted, bool) {
+	size := src.Rect.Size()
+	dst := image.NewPaletted(image.Rect(0, 0, size.X, size.Y), nil)
+	index := make(map[[3]uint8]uint8, n)
+	// 同じ色が続くことが多いため、直前のピクセルの色の位置を覚えておく
+	var last [3]uint8
+	var lastIndex uint8
+	hasLast := false
+	for y := 0; y < size.Y; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+size.X*4]
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+size.X]
+		for x := range out {
+			c := [3]uint8{row[x*4], row[x*4+1], row[x*4+2]}
+			if !hasLast || c != last {
+				i, ok := index[c]
+				if !ok {
+					if len(dst.Palette) == n {
+						return nil, false
+					}
+					i = uint8(len(dst.Palette))
+					index[c] = i
+					dst.Palette = append(dst.Palette, color.RGBA{R: c[0], G: c[1], B: c[2], A: 0xff})
+				}
+				last, lastIndex, hasLast = c, i, true
+			}
+			out[x] = lastIndex
+		}
+	}
+	return dst, true
+}
+
+// medianCut は色の範囲が最も広い箱をピクセル数の中央で分割することを繰り返し、最大 n 色のパレットを作成します。
+func medianCut(buckets []colorBucket, n int) color.Palette {
+	if len(buckets) == 0 {
+		return nil
+	}
+	boxes := []colorBox{newColorBox(buckets)}
+	for len(boxes) < n {
+		// 分割できる箱のうち、ピクセル数と色の範囲の積が最も大きいものを分割する
+		best, bestScore, bestChannel := -1, 0, 0
+		for i, box := range boxes {
+			if len(box.buckets) < 2 {
+				continue
+			}
+			channel, span := box.widestChannel()
+			if score := span * box.count; score > bestScore {
+				best, bestScore, bestChannel = i, score, channel
+			}
+		}
+		if best < 0 {
+			break // すべての箱が 1 色だけになった
+		}
+		a, b := boxes[best].split(bestChannel)
+		boxes[best] = a
+		boxes = append(boxes, b)
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var r, g, b int
+		for _, h := range box.buckets {
+			r += h.r
+			g += h.g
+			b += h.b
+		}
+		palette[i] = color.RGBA{R: uint8(r / box.count), G: uint8(g / box.count), B: uint8(b / box.count), A: 0xff}
+	}
+	return palette
+}
+
+// newColorBox はヒストグラムの位置の集合から箱を作成します。
+func newColorBox(buckets []colorBucket) colorBox {
+	box := colorBox{buckets: buckets}
+	for _, h := range buckets {
+		box.count += h.count
+	}
+	return box
+}
+
+// widestChannel は箱の中で値の範囲が最も広いチャンネルとその範囲を返します。
+func (b colorBox) widestChannel() (channel, span int) {
+	for c := 0; c < 3; c++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, h := range b.buckets {
+			lo = min(lo, h.key[c])
+			hi = max(hi, h.key[c])
+		}
+		if s := int(hi - lo); s > span || c == 0 {
+			channel, span = c, s
+		}
+	}
+	return channel, span
+}
+
+// split は箱を指定されたチャンネルで、ピクセル数が半分になる位置で 2 つに分割します。
+func (b colorBox) split(channel int) (colorBox, colorBox) {
+	sort.Slice(b.buckets, func(i, j int) bool { return b.buckets[i].key[channel] < b.buckets[j].key[channel] })
+	half, sum, cut := b.count/2, 0, 1
+	for i, h := range b.buckets[:len(b.buckets)-1] {
+		sum += h.count
+		cut = i + 1
+		if sum >= half {
+			break
+		}
+	}
+	return newColorBox(b.buckets[:cut]), newColorBox(b.buckets[cut:])
+}
+
+// clampUint8 は値を 0-255 に収めます。
+func clampUint8(v int32) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// noiseRGBA は乱数の色で埋めた画像を作成します (ほぼすべてのピクセルが異なる色になります)。
+func noiseRGBA(width, height int) *image.RGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rnd.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+func TestQuantizePaletteSize(t *testing.T) {
+	src := noiseRGBA(64, 64)
+	for _, n := range []int{2, 16, 256} {
+		for _, dither := range []bool{false, true} {
+			dst := quantize(src, n, dither)
+			if len(dst.Palette) == 0 || len(dst.Palette) > n {
+				t.Errorf("n=%d dither=%v: palette has %d colors", n, dither, len(dst.Palette))
+			}
+			if dst.Bounds().Size() != src.Bounds().Size() {
+				t.Errorf("n=%d dither=%v: bounds = %v", n, dither, dst.Bounds())
+			}
+			for i, idx := range dst.Pix {
+				if int(idx) >= len(dst.Palette) {
+					t.Fatalf("n=%d dither=%v: pixel %d uses index %d outside the palette", n, dither, i, idx)
+				}
+			}
+		}
+	}
+}
+
+func TestQuantizeExactColors(t *testing.T) {
+	// 上位ビットが同じ (メディアンカットのヒストグラムでは同じ位置になる) 色も含める
+	colors := []color.RGBA{
+		{0, 0, 0, 0xff}, {1, 1, 1, 0xff}, {0xff, 0xff, 0xff, 0xff},
+		{0x12, 0x34, 0x56, 0xff}, {0x13, 0x34, 0x56, 0xff},
+	}
+	src := image.NewRGBA(image.Rect(10, 20, 27, 25)) // 原点以外から始まる画像
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			src.SetRGBA(x, y, colors[(x*7+y)%len(colors)])
+		}
+	}
+
+	for _, n := range []int{len(colors), 256} {
+		for _, dither := range []bool{false, true} {
+			dst := quantize(src, n, dither)
+			if len(dst.Palette) != len(colors) {
+				t.Errorf("n=%d dither=%v: palette has %d colors, want %d", n, dither, len(dst.Palette), len(colors))
+			}
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					want := src.RGBAAt(b.Min.X+x, b.Min.Y+y)
+					if got := color.RGBAModel.Convert(dst.At(x, y)); got != want {
+						t.Fatalf("n=%d dither=%v: pixel (%d, %d) = %v, want %v", n, dither, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+
+	// 色数が n を超える場合はメディアンカットで n 色に減らす
+	if dst := quantize(src, 2, false); len(dst.Palette) > 2 {
+		t.Errorf("palette has %d colors, want at most 2", len(dst.Palette))
+	}
+}
+
+func TestQuantizeEmpty(t *testing.T) {
+	for _, dither := range []bool{false, true} {
+		dst := quantize(image.NewRGBA(image.Rectangle{}), 16, dither)
+		if !dst.Bounds().Empty() || len(dst.Pix) != 0 {
+			t.Errorf("dither=%v: got %v with %d pixels, want an empty image", dither, dst.Bounds(), len(dst.Pix))
+		}
+	}
+	if palette := medianCut(nil, 16); len(palette) != 0 {
+		t.Errorf("medianCut of no colors = %v, want an empty palette", palette)
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	// 32 個のヒストグラムの位置に、ピクセル数の異なる色を置く
+	var buckets []colorBucket
+	for i := 0; i < 32; i++ {
+		v := uint8(i * 8)
+		count := i + 1
+		buckets = append(buckets, colorBucket{
+			count: count,
+			r:     int(v) * count, g: int(255-v) * count, b: int(v/2) * count,
+			key: [3]uint8{v >> quantShift, (255 - v) >> quantShift, (v / 2) >> quantShift},
+		})
+	}
+	for _, n := range []int{1, 2, 5, 32, 64} {
+		palette := medianCut(append([]colorBucket(nil), buckets...), n)
+		if want := min(n, len(buckets)); len(palette) != want {
+			t.Errorf("n=%d: palette has %d colors, want %d", n, len(palette), want)
+		}
+		for _, c := range palette {
+			if c.(color.RGBA).A != 0xff {
+				t.Errorf("n=%d: palette color %v is not opaque", n, c)
+			}
+		}
+	}
+}
+
+func TestColorReducerRGBDoesNotModifyInput(t *testing.T) {
+	reducer, err := NewColorReducer(ColorOptions{Mode: ColorRGB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{0x10, 0x20, 0x30, 0x80})
+	out, err := reducer.Process(src, FrameInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.RGBAAt(0, 0); got.A != 0x80 {
+		t.Errorf("input pixel was changed to %v", got)
+	}
+	if got := color.RGBAModel.Convert(out.At(0, 0)); got != (color.RGBA{0x10, 0x20, 0x30, 0xff}) {
+		t.Errorf("output pixel = %v, want opaque", got)
+	}
+}
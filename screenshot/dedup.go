@@ -0,0 +1,205 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"hash/maphash"
+	"image"
+	"image/draw"
+	"math/bits"
+	"time"
+)
+
+// DedupMode は変化のないフレームを判定する方法です。値は config.DedupSetting.Mode にそのまま保存されます。
+type DedupMode string
+
+const (
+	DedupOff        DedupMode = "off"       // すべてのフレームを保存する
+	DedupExact      DedupMode = "exact"     // ピクセルが完全に一致する場合に重複とみなす (ハッシュで比較)
+	DedupTolerance  DedupMode = "tolerance" // 許容差を超えて変化したピクセルの割合が閾値以下の場合に重複とみなす
+	DedupPerceptual DedupMode = "phash"     // 知覚ハッシュ (dHash) の距離が閾値以下の場合に重複とみなす
+)
+
+// DedupOptions は DuplicateFilter の設定です。
+type DedupOptions struct {
+	Mode DedupMode
+	// Tolerance は DedupTolerance で、変化していないとみなす各チャンネルの差の最大値です (0-255)。
+	Tolerance int
+	// ChangedRatio は DedupTolerance で、重複とみなす変化したピクセルの割合の最大値です (0-1)。
+	ChangedRatio float64
+	// HashDistance は DedupPerceptual で、重複とみなすハッシュのハミング距離の最大値です (0-64)。
+	HashDistance int
+	// Heartbeat が正の場合、前回の保存からこの時間が経過したフレームは変化がなくても保存します
+	// (ウィンドウが動作していたことの記録として)。
+	Heartbeat time.Duration
+}
+
+// DuplicateFilter は直前に保存したフレームと比較して、変化のないフレームを判定します。
+// 比較に必要な情報 (ハッシュやピクセルのコピー) は自身で保持するため、
+// 判定後に画像を ReleaseImage で解放しても問題ありません。
+// 複数のゴルーチンから同時に使用することはできません。
+type DuplicateFilter struct {
+	opts DedupOptions
+	seed maphash.Seed
+
+	hasLast   bool
+	lastSaved time.Time
+	last      frameSignature // 最後に保存したフレーム
+	pending   frameSignature // 最後に Check したフレーム (Saved で last になる)
+}
+
+// frameSignature はフレームの比較に使用する情報です。
+type frameSignature struct {
+	size   image.Point
+	hash   uint64 // DedupExact: ピクセルのハッシュ、DedupPerceptual: dHash
+	pixels []byte // DedupTolerance: RGBA ピクセルのコピー
+}
+
+// NewDuplicateFilter は指定された方法で重複を判定するフィルターを作成します。
+func NewDuplicateFilter(opts DedupOptions) (*DuplicateFilter, error) {
+	switch opts.Mode {
+	case "", DedupOff, DedupExact:
+	case DedupTolerance:
+		if opts.Tolerance < 0 || opts.Tolerance > 255 {
+			return nil, fmt.Errorf("dedup tolerance must be between 0 and 255: %d", opts.Tolerance)
+		}
+		if opts.ChangedRatio < 0 || opts.ChangedRatio > 1 {
+			return nil, fmt.Errorf("dedup changed ratio must be between 0 and 1: %g", opts.ChangedRatio)
+		}
+	case DedupPerceptual:
+		if opts.HashDistance < 0 || opts.HashDistance > 64 {
+			return nil, fmt.Errorf("dedup hash distance must be between 0 and 64: %d", opts.HashDistance)
+		}
+	default:
+		return nil, fmt.Errorf("unknown dedup mode %q", opts.Mode)
+	}
+	return &DuplicateFilter{opts: opts, seed: maphash.MakeSeed()}, nil
+}
+
+// Check は img が最後に保存したフレームから変化していないか (保存を省略してよいか) を返します。
+// 保存した場合は、続けて Saved を呼び出して次の比較の基準にしてください。
+func (d *DuplicateFilter) Check(img image.Image, now time.Time) bool {
+	if d.opts.Mode == "" || d.opts.Mode == DedupOff {
+		return false
+	}
+
+	rgba := asRGBA(img)
+	d.pending.size = rgba.Rect.Size()
+	switch d.opts.Mode {
+	case DedupExact:
+		d.pending.hash = d.pixelHash(rgba)
+	case DedupTolerance:
+		d.pending.pixels = copyPixels(d.pending.pixels, rgba)
+	case DedupPerceptual:
+		d.pending.hash = differenceHash(rgba)
+	}
+
+	if !d.hasLast || d.pending.size != d.last.size {
+		return false
+	}
+	if d.opts.Heartbeat > 0 && now.Sub(d.lastSaved) >= d.opts.Heartbeat {
+		return false
+	}
+
+	switch d.opts.Mode {
+	case DedupExact:
+		return d.pending.hash == d.last.hash
+	case DedupTolerance:
+		return changedRatio(d.pending.pixels, d.last.pixels, d.opts.Tolerance) <= d.opts.ChangedRatio
+	default: // DedupPerceptual
+		return bits.OnesCount64(d.pending.hash^d.last.hash) <= d.opts.HashDistance
+	}
+}
+
+// Saved は直前に Check したフレームが保存されたことを記録します。
+func (d *DuplicateFilter) Saved(now time.Time) {
+	d.hasLast = true
+	d.lastSaved = now
+	// ピクセルのバッファは入れ替えて再利用する
+	d.last, d.pending = d.pending, d.last
+}
+
+// asRGBA は img を原点から始まる連続した *image.RGBA として返します (必要な場合のみ変換します)。
+func asRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Stride == rgba.Rect.Dx()*4 {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// pixelHash はピクセルデータ全体のハッシュを計算します。
+func (d *DuplicateFilter) pixelHash(rgba *image.RGBA) uint64 {
+	n := rgba.Rect.Dx() * rgba.Rect.Dy() * 4
+	return maphash.Bytes(d.seed, rgba.Pix[:n])
+}
+
+// copyPixels はピクセルデータを dst (容量が足りる場合は再利用) にコピーします。
+func copyPixels(dst []byte, rgba *image.RGBA) []byte {
+	n := rgba.Rect.Dx() * rgba.Rect.Dy() * 4
+	if cap(dst) < n {
+		dst = make([]byte, n)
+	}
+	dst = dst[:n]
+	copy(dst, rgba.Pix[:n])
+	return dst
+}
+
+// changedRatio は各チャンネルの差が tolerance を超えるピクセルの割合を返します。
+func changedRatio(a, b []byte, tolerance int) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 1
+	}
+	changed := 0
+	for i := 0; i+3 < len(a); i += 4 {
+		for c := 0; c < 4; c++ {
+			diff := int(a[i+c]) - int(b[i+c])
+			if diff > tolerance || -diff > tolerance {
+				changed++
+				break
+			}
+		}
+	}
+	return float64(changed) / float64(len(a)/4)
+}
+
+// differenceHash は画像を 9x8 の輝度に縮小し、横に隣接するピクセルの明暗から 64 ビットのハッシュ (dHash) を計算します。
+// 圧縮のノイズや小さな変化ではハッシュがほとんど変わらないため、見た目が同じフレームの判定に使用します。
+func differenceHash(rgba *image.RGBA) uint64 {
+	const w, h = 9, 8
+	var lum [h][w]uint64
+	size := rgba.Rect.Size()
+	for y := 0; y < h; y++ {
+		y0, y1 := y*size.Y/h, (y+1)*size.Y/h
+		for x := 0; x < w; x++ {
+			x0, x1 := x*size.X/w, (x+1)*size.X/w
+			var sum, count uint64
+			// ブロック内のピクセルを間引いて平均する (大きな画像でも一定の計算量にする)
+			stepY := max((y1-y0)/8, 1)
+			stepX := max((x1-x0)/8, 1)
+			for py := y0; py < y1; py += stepY {
+				for px := x0; px < x1; px += stepX {
+					p := rgba.Pix[py*rgba.Stride+px*4:]
+					sum += (299*uint64(p[0]) + 587*uint64(p[1]) + 114*uint64(p[2])) / 1000
+					count++
+				}
+			}
+			if count > 0 {
+				lum[y][x] = sum / count
+			}
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if lum[y][x] > lum[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+// gradientRGBA は左上から右下に明るくなるグラデーションの画像を作成します。invert の場合は明暗を反転します。
+func gradientRGBA(width, height int, invert bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := byte((x + y) * 255 / (width + height - 2))
+			if invert {
+				v = 255 - v
+			}
+			img.SetRGBA(x, y, color.RGBA{v, v / 2, 255 - v, 0xff})
+		}
+	}
+	return img
+}
+
+func TestDuplicateFilter(t *testing.T) {
+	base := gradientRGBA(32, 32, false)
+	same := gradientRGBA(32, 32, false)
+	changed := gradientRGBA(32, 32, true)
+	slight := gradientRGBA(32, 32, false) // 1 ピクセルの赤だけが 3 変化した画像
+	c := slight.RGBAAt(5, 5)
+	c.R += 3
+	slight.SetRGBA(5, 5, c)
+	resized := gradientRGBA(16, 32, false)
+
+	tests := []struct {
+		opts        DedupOptions
+		slightIsDup bool // わずかな変化を重複とみなすか
+	}{
+		{DedupOptions{Mode: DedupExact}, false},
+		{DedupOptions{Mode: DedupTolerance, Tolerance: 8, ChangedRatio: 0}, true},    // 差が許容差以内
+		{DedupOptions{Mode: DedupTolerance, Tolerance: 2, ChangedRatio: 0.01}, true}, // 変化したピクセルの割合が閾値以内
+		{DedupOptions{Mode: DedupTolerance, Tolerance: 2, ChangedRatio: 0}, false},
+		{DedupOptions{Mode: DedupPerceptual, HashDistance: 4}, true},
+	}
+	for _, tt := range tests {
+		d, err := NewDuplicateFilter(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		steps := []struct {
+			name  string
+			img   image.Image
+			dup   bool
+			saved bool // 保存に成功した (Saved を呼ぶ)
+		}{
+			{"first frame", base, false, true},
+			{"identical frame", same, true, false},
+			{"slightly changed frame", slight, tt.slightIsDup, false},
+			{"changed frame whose save failed", changed, false, false},
+			// 保存に失敗したフレームは比較の基準にならない
+			{"frame equal to the last saved one", same, true, false},
+			{"changed frame", changed, false, true},
+			{"frame after the change", changed, true, false},
+			{"resized frame", resized, false, false},
+		}
+		for i, step := range steps {
+			now := start.Add(time.Duration(i) * time.Second)
+			if got := d.Check(step.img, now); got != step.dup {
+				t.Errorf("%+v: %s: Check = %v, want %v", tt.opts, step.name, got, step.dup)
+			}
+			if step.saved {
+				d.Saved(now)
+			}
+		}
+	}
+}
+
+func TestDuplicateFilterHeartbeat(t *testing.T) {
+	img := gradientRGBA(16, 16, false)
+	for _, mode := range []DedupMode{DedupExact, DedupTolerance, DedupPerceptual} {
+		d, err := NewDuplicateFilter(DedupOptions{Mode: mode, Heartbeat: 5 * time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		d.Check(img, start)
+		d.Saved(start)
+		// 1 秒ごとの同じフレームは省略し、前回の保存から 5 秒経ったフレームは保存する
+		var saved []int
+		for i := 1; i <= 12; i++ {
+			now := start.Add(time.Duration(i) * time.Second)
+			if !d.Check(img, now) {
+				saved = append(saved, i)
+				d.Saved(now)
+			}
+		}
+		if len(saved) != 2 || saved[0] != 5 || saved[1] != 10 {
+			t.Errorf("%s: saved frames at %v seconds, want [5 10]", mode, saved)
+		}
+	}
+}
+
+func TestDuplicateFilterOff(t *testing.T) {
+	img := gradientRGBA(8, 8, false)
+	for _, mode := range []DedupMode{"", DedupOff} {
+		d, err := NewDuplicateFilter(DedupOptions{Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if d.Check(img, time.Now()) {
+				t.Errorf("%q: frame %d was skipped", mode, i)
+			}
+			d.Saved(time.Now())
+		}
+	}
+	if _, err := NewDuplicateFilter(DedupOptions{Mode: "fuzzy"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !linux && !darwin
+
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import "errors"
+
+// FreeSpace はこのプラットフォームでは空き容量を取得できないため、常にエラーを返します。
+func FreeSpace(dir string) (uint64, error) {
+	return 0, errors.New("screenshot: free space is not available on this platform")
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// FreeSpace は dir があるファイルシステムで、一般ユーザーが使用できる空き容量 (バイト) を返します。
+func FreeSpace(dir string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s failed: %w", dir, err)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
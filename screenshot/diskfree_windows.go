@@ -0,0 +1,24 @@
+//go:build windows
+
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// FreeSpace は dir があるドライブで、現在のユーザーが使用できる空き容量 (バイト) を返します。
+func FreeSpace(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &total, &free); err != nil {
+		return 0, fmt.Errorf("GetDiskFreeSpaceEx %s failed: %w", dir, err)
+	}
+	return available, nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// Encoder は画像を特定の形式でファイルに書き出すエンコーダーです。
+// 保存のワーカーから同時に呼び出されるため、Encode は複数のゴルーチンから同時に使用できる必要があります。
+type Encoder interface {
+	// Extension はファイル名に使用する拡張子 (先頭の "." を含む) を返します。
+	Extension() string
+	// Encode は img をエンコードして w に書き込みます。
+	Encode(w io.Writer, img image.Image) error
+}
+
+// MetadataEncoder は撮影時の情報を画像ファイルに埋め込める Encoder が実装するインターフェースです (PNG と JPEG)。
+// SaveScreenshot は Encoder がこれを実装している場合に EncodeWithMetadata を使用します。
+type MetadataEncoder interface {
+	// EncodeWithMetadata は img をエンコードし、meta を埋め込んで w に書き込みます。
+	EncodeWithMetadata(w io.Writer, img image.Image, meta ImageMetadata) error
+}
+
+// EncoderOptions は形式ごとのエンコード設定です。使用しない形式では無視されます。
+type EncoderOptions struct {
+	JPEGQuality    int                  // JPEG の品質 (1-100、0 の場合は DefaultJPEGQuality)
+	PNGCompression png.CompressionLevel // PNG の圧縮レベル
+}
+
+// DefaultJPEGQuality は JPEGQuality が指定されていない場合の品質です。
+const DefaultJPEGQuality = 90
+
+// EncoderFactory は設定からエンコーダーを作成する関数です。
+type EncoderFactory func(opts EncoderOptions) (Encoder, error)
+
+// 保存形式の名前 (config.OutputSetting.Format の値)
+const (
+	FormatPNG  = "png"
+	FormatJPEG = "jpeg"
+	FormatBMP  = "bmp"
+	FormatTIFF = "tiff"
+	FormatQOI  = "qoi"
+)
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncoderFactory{
+		FormatPNG: func(opts EncoderOptions) (Encoder, error) { return newPNGEncoder(opts.PNGCompression), nil },
+		FormatJPEG: func(opts EncoderOptions) (Encoder, error) {
+			q := opts.JPEGQuality
+			if q == 0 {
+				q = DefaultJPEGQuality
+			}
+			if q < 1 || q > 100 {
+				return nil, fmt.Errorf("JPEG quality must be between 1 and 100: %d", q)
+			}
+			return jpegEncoder{quality: q}, nil
+		},
+		FormatBMP:  func(EncoderOptions) (Encoder, error) { return bmpEncoder{}, nil },
+		FormatTIFF: func(EncoderOptions) (Encoder, error) { return tiffEncoder{}, nil },
+		FormatQOI:  func(EncoderOptions) (Encoder, error) { return qoiEncoder{}, nil },
+	}
+)
+
+// RegisterEncoder は保存形式を登録します。同じ名前の形式が登録済みの場合は置き換えます。
+func RegisterEncoder(format string, factory EncoderFactory) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[strings.ToLower(format)] = factory
+}
+
+// NewEncoder は登録された形式のエンコーダーを作成します。format が空の場合は PNG を使用します。
+func NewEncoder(format string, opts EncoderOptions) (Encoder, error) {
+	format = strings.ToLower(format)
+	if format == "" {
+		format = FormatPNG
+	}
+	if format == "jpg" {
+		format = FormatJPEG
+	}
+	encodersMu.RLock()
+	factory, ok := encoders[format]
+	encodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown image format %q", format)
+	}
+	return factory(opts)
+}
+
+// PNG の圧縮レベルの名前 (config.OutputSetting.PNGCompression の値)
+const (
+	PNGCompressionDefault = "default"
+	PNGCompressionSpeed   = "best_speed"
+	PNGCompressionBest    = "best_compression"
+	PNGCompressionNone    = "none"
+)
+
+// ParsePNGCompression は圧縮レベルの名前を png.CompressionLevel に変換します。空の場合は既定の圧縮レベルを返します。
+func ParsePNGCompression(name string) (png.CompressionLevel, error) {
+	switch strings.ToLower(name) {
+	case "", PNGCompressionDefault:
+		return png.DefaultCompression, nil
+	case PNGCompressionSpeed:
+		return png.BestSpeed, nil
+	case PNGCompressionBest:
+		return png.BestCompression, nil
+	case PNGCompressionNone:
+		return png.NoCompression, nil
+	default:
+		return 0, fmt.Errorf("unknown PNG compression level %q", name)
+	}
+}
+
+// Formats は登録されている保存形式の名前を名前順に返します。
+func Formats() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	formats := make([]string, 0, len(encoders))
+	for name := range encoders {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// pngEncoder は PNG 形式のエンコーダーです。
+// 作業バッファは同じエンコーダーで保存するすべてのフレーム (撮影セッション全体) で再利用します。
+type pngEncoder struct {
+	enc *png.Encoder
+}
+
+// newPNGEncoder は指定された圧縮レベルの PNG エンコーダーを作成します。
+func newPNGEncoder(level png.CompressionLevel) pngEncoder {
+	return pngEncoder{enc: &png.Encoder{CompressionLevel: level, BufferPool: &EncoderBufferPool{}}}
+}
+
+func (pngEncoder) Extension() string                           { return ".png" }
+func (e pngEncoder) Encode(w io.Writer, img image.Image) error { return e.enc.Encode(w, img) }
+
+// EncodeWithMetadata はテキストチャンクを IHDR チャンクの直後に挿入します。
+func (e pngEncoder) EncodeWithMetadata(w io.Writer, img image.Image, meta ImageMetadata) error {
+	return e.enc.Encode(&insertWriter{w: w, at: pngHeaderSize, insert: pngTextChunks(meta)}, img)
+}
+
+// jpegEncoder は JPEG 形式のエンコーダーです。
+type jpegEncoder struct {
+	quality int
+}
+
+func (jpegEncoder) Extension() string { return ".jpg" }
+func (e jpegEncoder) Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: e.quality})
+}
+
+// EncodeWithMetadata は EXIF と COM セグメントを SOI マーカーの直後に挿入します。
+func (e jpegEncoder) EncodeWithMetadata(w io.Writer, img image.Image, meta ImageMetadata) error {
+	return e.Encode(&insertWriter{w: w, at: 2, insert: jpegMetadataSegments(meta)}, img)
+}
+
+// bmpEncoder は BMP 形式のエンコーダーです。
+type bmpEncoder struct{}
+
+func (bmpEncoder) Extension() string                         { return ".bmp" }
+func (bmpEncoder) Encode(w io.Writer, img image.Image) error { return bmp.Encode(w, img) }
+
+// tiffEncoder は Deflate 圧縮の TIFF 形式のエンコーダーです。
+type tiffEncoder struct{}
+
+func (tiffEncoder) Extension() string { return ".tiff" }
+func (tiffEncoder) Encode(w io.Writer, img image.Image) error {
+	return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+}
+
+// qoiEncoder は QOI 形式のエンコーダーです (qoi.go)。
+type qoiEncoder struct{}
+
+func (qoiEncoder) Extension() string                         { return ".qoi" }
+func (qoiEncoder) Encode(w io.Writer, img image.Image) error { return EncodeQOI(w, img) }
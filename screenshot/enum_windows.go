@@ -0,0 +1,46 @@
+//go:build windows
+
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import "sync"
+
+// enumRegistry は EnumWindows などの列挙 API のコールバックに、呼び出しごとの状態を渡すための登録表です。
+// syscall.NewCallback で作成したコールバックのスロットは解放されないため、コールバックは
+// パッケージ初期化時に一度だけ作成し、lParam に渡した ID から呼び出しごとの状態を取り出します。
+// これにより、複数の goroutine が同時に列挙しても結果が混ざりません。
+type enumRegistry[T any] struct {
+	mu     sync.Mutex
+	nextID uintptr
+	states map[uintptr]*T
+}
+
+// register は状態を登録し、lParam として渡す ID を返します。
+func (r *enumRegistry[T]) register(state *T) uintptr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.states == nil {
+		r.states = make(map[uintptr]*T)
+	}
+	r.nextID++
+	if r.nextID == 0 { // 0 は未登録を表すため使用しない
+		r.nextID++
+	}
+	r.states[r.nextID] = state
+	return r.nextID
+}
+
+// lookup は ID に対応する状態を返します。登録されていない場合は nil を返します。
+func (r *enumRegistry[T]) lookup(id uintptr) *T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.states[id]
+}
+
+// unregister は列挙の終了後に状態の登録を解除します。
+func (r *enumRegistry[T]) unregister(id uintptr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.states, id)
+}
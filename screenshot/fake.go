@@ -0,0 +1,153 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"sync"
+)
+
+// FakeWindow はフェイクバックエンドが返すウィンドウと、その撮影結果のスクリプトです。
+type FakeWindow struct {
+	Info WindowInfo
+	// Frames は CaptureWindow の呼び出しごとに順番に返される画像です。
+	// 最後の画像に到達した後は、最後の画像を返し続けます。
+	Frames []image.Image
+	// Err が設定されている場合、CaptureWindow はこのエラーを返します。
+	// Info.Minimized が true の場合は ErrWindowMinimized を返します。
+	Err error
+}
+
+// FakeCapturer はメモリ上のスクリプトに従ってウィンドウと画像を返す Capturer の実装です。
+// 実際のデスクトップを持たない環境 (CI やテスト) での動作確認に使用します。
+type FakeCapturer struct {
+	mu      sync.Mutex
+	windows []*FakeWindow
+	next    map[HWND]int // ウィンドウごとの次に返すフレームの位置
+	ListErr error        // 設定されている場合、ListWindows はこのエラーを返す
+
+	// Monitors は ListMonitors が返すモニターの一覧です。
+	Monitors []MonitorInfo
+	// Desktop は CaptureRect が切り出す仮想デスクトップ全体の画像です。
+	Desktop image.Image
+}
+
+// NewFakeCapturer は指定されたウィンドウを持つフェイクバックエンドを作成します。
+func NewFakeCapturer(windows ...*FakeWindow) *FakeCapturer {
+	return &FakeCapturer{
+		windows: windows,
+		next:    make(map[HWND]int),
+	}
+}
+
+// AddWindow はフェイクバックエンドにウィンドウを追加します。
+func (f *FakeCapturer) AddWindow(w *FakeWindow) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.windows = append(f.windows, w)
+}
+
+// RemoveWindow は指定されたウィンドウを取り除きます (ウィンドウが閉じられた状態を再現します)。
+// 以降の CaptureWindow は ErrWindowGone を返します。
+func (f *FakeCapturer) RemoveWindow(hwnd HWND) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, w := range f.windows {
+		if w.Info.HWND == hwnd {
+			f.windows = append(f.windows[:i], f.windows[i+1:]...)
+			delete(f.next, hwnd)
+			return
+		}
+	}
+}
+
+// ListWindows はスクリプトされたウィンドウのリストを返します。
+func (f *FakeCapturer) ListWindows() ([]WindowInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ListErr != nil {
+		return nil, f.ListErr
+	}
+	list := make([]WindowInfo, 0, len(f.windows))
+	for _, w := range f.windows {
+		list = append(list, w.Info)
+	}
+	return list, nil
+}
+
+// WindowTitle は指定されたウィンドウのタイトルを返します。
+func (f *FakeCapturer) WindowTitle(hwnd HWND) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.lookup(hwnd)
+	if w == nil {
+		return "", fmt.Errorf("fake window %d: %w", hwnd, ErrWindowGone)
+	}
+	return w.Info.Title, nil
+}
+
+// WindowRect は指定されたウィンドウの Info.Rect を返します。
+func (f *FakeCapturer) WindowRect(hwnd HWND) (image.Rectangle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.lookup(hwnd)
+	if w == nil {
+		return image.Rectangle{}, fmt.Errorf("fake window %d: %w", hwnd, ErrWindowGone)
+	}
+	return w.Info.Rect, nil
+}
+
+// CaptureWindow はスクリプトされた次のフレームを返します。
+func (f *FakeCapturer) CaptureWindow(hwnd HWND) (image.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.lookup(hwnd)
+	if w == nil {
+		return nil, fmt.Errorf("fake window %d: %w", hwnd, ErrWindowGone)
+	}
+	if w.Err != nil {
+		return nil, w.Err
+	}
+	if w.Info.Minimized {
+		return nil, fmt.Errorf("fake window %d: %w", hwnd, ErrWindowMinimized)
+	}
+	if len(w.Frames) == 0 {
+		return nil, fmt.Errorf("fake window %d has no frames", hwnd)
+	}
+	i := f.next[hwnd]
+	if i < len(w.Frames)-1 {
+		f.next[hwnd] = i + 1
+	}
+	return w.Frames[i], nil
+}
+
+// ListMonitors はスクリプトされたモニターの一覧を返します。
+func (f *FakeCapturer) ListMonitors() ([]MonitorInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]MonitorInfo(nil), f.Monitors...), nil
+}
+
+// CaptureRect は Desktop から指定された領域を切り出して返します。
+func (f *FakeCapturer) CaptureRect(rect image.Rectangle) (image.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Desktop == nil {
+		return nil, fmt.Errorf("fake desktop is not set")
+	}
+	if rect.Intersect(f.Desktop.Bounds()).Empty() {
+		return nil, fmt.Errorf("capture rect %v is outside the fake desktop", rect)
+	}
+	return cropImage(f.Desktop, rect), nil
+}
+
+// lookup は HWND に対応するウィンドウを探します。呼び出し側で mu を保持している必要があります。
+func (f *FakeCapturer) lookup(hwnd HWND) *FakeWindow {
+	for _, w := range f.windows {
+		if w.Info.HWND == hwnd {
+			return w
+		}
+	}
+	return nil
+}
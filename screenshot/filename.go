@@ -0,0 +1,256 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultFilenameTemplate は従来のファイル名 (screenshot_YYYY-MM-DD_HH-MM-SS_0000) と同じ形式のテンプレートです。
+const DefaultFilenameTemplate = "screenshot_{date}_{time}_{counter}"
+
+// FrameInfo はファイル名のテンプレートを展開するための、保存するフレームの情報です。
+type FrameInfo struct {
+	Time        time.Time // 撮影時刻 (ファイル名とメタデータのすべてでこの値を使用する)
+	Counter     int       // Time と同じ秒に撮影されたフレームの中での連番
+	Frame       int       // セッション内の通し番号 (0 から、リセットされない)
+	SessionID   string    // 撮影セッションの識別子
+	WindowTitle string    // 撮影対象のウィンドウのタイトル
+	ProcessName string    // 撮影対象のウィンドウの実行ファイル名
+	Monitor     int       // 撮影対象のモニター番号 (モニター単位の撮影でない場合は -1)
+
+	// 以下はファイル名には使用せず、マニフェストなどのメタデータにのみ記録します。
+	WindowRect image.Rectangle // 撮影時のウィンドウの矩形 (取得できない場合は空)
+	Latency    time.Duration   // 撮影の開始 (Time) から画像を取得するまでの時間
+	// OriginalSize は縮小などの加工の前の、撮影した画像の大きさです (Pipeline が設定します)。
+	OriginalSize image.Point
+	// Offset は撮影した画像の左上の、撮影対象 (ウィンドウまたは切り出した領域) の左上からの位置です。
+	// 画面外にはみ出した部分を除いて撮影した場合に (0, 0) でなくなります (Pipeline が撮影した画像の Bounds から設定します)。
+	Offset image.Point
+}
+
+// templatePlaceholders はテンプレートで使用できるプレースホルダーと、その値の作り方です。
+var templatePlaceholders = map[string]func(f FrameInfo) string{
+	"window":  func(f FrameInfo) string { return f.WindowTitle },
+	"process": func(f FrameInfo) string { return strings.TrimSuffix(f.ProcessName, filepath.Ext(f.ProcessName)) },
+	"session": func(f FrameInfo) string { return f.SessionID },
+	"date":    func(f FrameInfo) string { return f.Time.Format("2006-01-02") },
+	"time":    func(f FrameInfo) string { return f.Time.Format("15-04-05") },
+	"yyyy":    func(f FrameInfo) string { return f.Time.Format("2006") },
+	"mm":      func(f FrameInfo) string { return f.Time.Format("01") },
+	"dd":      func(f FrameInfo) string { return f.Time.Format("02") },
+	"hh":      func(f FrameInfo) string { return f.Time.Format("15") },
+	"min":     func(f FrameInfo) string { return f.Time.Format("04") },
+	"ss":      func(f FrameInfo) string { return f.Time.Format("05") },
+	"ms":      func(f FrameInfo) string { return fmt.Sprintf("%03d", f.Time.Nanosecond()/int(time.Millisecond)) },
+	// ファイル名に ":" は使えないため、ISO 8601 の基本形式を使用する
+	"utc":     func(f FrameInfo) string { return f.Time.UTC().Format("20060102T150405.000Z") },
+	"iso":     func(f FrameInfo) string { return f.Time.Format("20060102T150405.000-0700") },
+	"counter": func(f FrameInfo) string { return fmt.Sprintf("%04d", f.Counter) },
+	"frame":   func(f FrameInfo) string { return fmt.Sprintf("%06d", f.Frame) },
+	"monitor": func(f FrameInfo) string {
+		if f.Monitor < 0 {
+			return "all"
+		}
+		return strconv.Itoa(f.Monitor)
+	},
+}
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// placeholderValuePatterns はプレースホルダーの値に一致する正規表現です (MatchTemplate で使用します)。
+// ここにないプレースホルダー (ウィンドウのタイトルなど) は任意の文字列に一致します。
+var placeholderValuePatterns = map[string]string{
+	"date":    `\d{4}-\d{2}-\d{2}`,
+	"time":    `\d{2}-\d{2}-\d{2}`,
+	"yyyy":    `\d{4}`,
+	"mm":      `\d{2}`,
+	"dd":      `\d{2}`,
+	"hh":      `\d{2}`,
+	"min":     `\d{2}`,
+	"ss":      `\d{2}`,
+	"ms":      `\d{3}`,
+	"utc":     `\d{8}T\d{6}\.\d{3}Z`,
+	"iso":     `\d{8}T\d{6}\.\d{3}[+-]\d{4}`,
+	"counter": `\d{4,}`,
+	"frame":   `\d{6,}`,
+	"monitor": `(?:all|\d+)`,
+}
+
+// ValidateTemplate はテンプレートに未知のプレースホルダーや不正なパスが含まれていないかを確認します。
+func ValidateTemplate(tmpl string) error {
+	_, err := ExpandTemplate(tmpl, FrameInfo{Time: time.Now(), SessionID: "session", WindowTitle: "window", ProcessName: "process"})
+	return err
+}
+
+// ExpandTemplate はテンプレートのプレースホルダーを f の値で置き換え、保存先ディレクトリからの相対パスを返します。
+// テンプレートに "/" を含めるとサブディレクトリに保存されます (例: "{date}/{window}/{hh}/shot_{frame}")。
+// プレースホルダーの値とパスの各要素は、ファイル名に使えない文字を置き換えてから使用します。
+// 拡張子は含まれません (保存形式によって決まります)。
+func ExpandTemplate(tmpl string, f FrameInfo) (string, error) {
+	if strings.TrimSpace(tmpl) == "" {
+		return "", fmt.Errorf("file name template is empty")
+	}
+
+	var unknown []string
+	expanded := placeholderPattern.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := m[1 : len(m)-1]
+		value, ok := templatePlaceholders[name]
+		if !ok {
+			unknown = append(unknown, m)
+			return m
+		}
+		// 値に含まれる "/" などがディレクトリの区切りとして扱われないようにする
+		return sanitizeFileName(truncateRunes(value(f), maxPlaceholderRunes))
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholder %s in file name template %q", strings.Join(unknown, ", "), tmpl)
+	}
+	if strings.ContainsAny(placeholderPattern.ReplaceAllString(tmpl, ""), "{}") {
+		return "", fmt.Errorf("unbalanced braces in file name template %q", tmpl)
+	}
+
+	segments := strings.FieldsFunc(expanded, func(r rune) bool { return r == '/' || r == '\\' })
+	if len(segments) == 0 {
+		return "", fmt.Errorf("file name template %q expands to an empty path", tmpl)
+	}
+	for i, s := range segments {
+		if s == "." || s == ".." {
+			return "", fmt.Errorf("file name template %q must not contain %q", tmpl, s)
+		}
+		segments[i] = sanitizeFileName(s)
+	}
+	return filepath.Join(segments...), nil
+}
+
+// TemplateMatcher はファイル名のテンプレートから保存されたファイルかどうかを判定します。
+// 保存先に利用者の他のファイルがあっても、このツールが保存したスクリーンショットだけを扱うために使用します。
+type TemplateMatcher struct {
+	segments []*regexp.Regexp // パスの各要素の正規表現 (最後の要素は連番と拡張子を含む)
+}
+
+// MatchTemplate はテンプレートを展開したパスに一致する TemplateMatcher を作成します。
+// 最後の要素には、同じ名前のファイルがあった場合の "_1", "_2", ... と、保存形式のいずれかの拡張子が付いたものが一致します。
+func MatchTemplate(tmpl string) (*TemplateMatcher, error) {
+	if err := ValidateTemplate(tmpl); err != nil {
+		return nil, err
+	}
+	parts := strings.FieldsFunc(tmpl, func(r rune) bool { return r == '/' || r == '\\' })
+	m := &TemplateMatcher{}
+	for i, part := range parts {
+		var pattern strings.Builder
+		pattern.WriteString("^")
+		last := 0
+		for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(part, -1) {
+			pattern.WriteString(regexp.QuoteMeta(sanitizeLiteral(part[last:loc[0]])))
+			if p, ok := placeholderValuePatterns[part[loc[2]:loc[3]]]; ok {
+				pattern.WriteString(p)
+			} else {
+				pattern.WriteString(".+")
+			}
+			last = loc[1]
+		}
+		pattern.WriteString(regexp.QuoteMeta(sanitizeLiteral(part[last:])))
+		if i == len(parts)-1 {
+			pattern.WriteString(`(?:_\d+)?\.(?i:png|jpe?g|bmp|tiff?|qoi)`)
+		}
+		pattern.WriteString("$")
+		re, err := regexp.Compile(pattern.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile file name template %q: %w", tmpl, err)
+		}
+		m.segments = append(m.segments, re)
+	}
+	return m, nil
+}
+
+// Depth はテンプレートのパスの要素の数です (1 の場合はサブディレクトリを使用しません)。
+func (m *TemplateMatcher) Depth() int {
+	return len(m.segments)
+}
+
+// MatchDir は保存先ディレクトリからの相対パス rel のディレクトリが、テンプレートで作成されるものかどうかを返します。
+func (m *TemplateMatcher) MatchDir(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) >= len(m.segments) {
+		return false
+	}
+	for i, part := range parts {
+		if !m.segments[i].MatchString(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchFile は保存先ディレクトリからの相対パス rel のファイルが、テンプレートで保存されたものかどうかを返します。
+func (m *TemplateMatcher) MatchFile(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != len(m.segments) {
+		return false
+	}
+	for i, part := range parts {
+		if !m.segments[i].MatchString(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeLiteral はテンプレートの固定部分の、ファイル名に使えない文字を sanitizeFileName と同じく "_" に置き換えます。
+func sanitizeLiteral(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// windowsReservedNames は Windows でファイル名として使用できない名前です。
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// maxPlaceholderRunes はプレースホルダーの値の最大文字数です (ウィンドウタイトルが長すぎる場合に切り詰める)。
+const maxPlaceholderRunes = 80
+
+// truncateRunes は s を最大 n 文字に切り詰めます。
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// sanitizeFileName はファイル名に使えない文字を "_" に置き換えます。
+// どの OS でも保存できるよう、Windows の制限 (予約文字・予約名・末尾のドットと空白) に合わせます。
+func sanitizeFileName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if name == "" {
+		return "_"
+	}
+	base := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+	if windowsReservedNames[base] {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// WindowFilter は列挙したウィンドウを絞り込む条件です。
+// ゼロ値の項目は条件として使用しません。
+type WindowFilter struct {
+	ProcessName string // 実行ファイル名 (大文字小文字を区別しない)
+	ClassName   string // ウィンドウクラス名 (完全一致)
+	TitleRegex  string // タイトルに対する正規表現
+	MinWidth    int    // 最小の幅 (ピクセル)
+	MinHeight   int    // 最小の高さ (ピクセル)
+
+	ExcludeTitles    []string // 除外するタイトル (完全一致)
+	ExcludeMinimized bool     // 最小化されたウィンドウを除外する
+	ExcludeCloaked   bool     // 画面に描画されていないウィンドウを除外する
+}
+
+// DefaultWindowFilter はウィンドウ選択ダイアログで使用する既定の条件です。
+// シェルや IME などのシステムウィンドウを除外します。
+var DefaultWindowFilter = WindowFilter{
+	ExcludeTitles:  []string{"Program Manager", "Default IME"},
+	ExcludeCloaked: true,
+}
+
+// Apply は windows のうち条件に一致するものを、元の順序のまま返します。
+func (f WindowFilter) Apply(windows []WindowInfo) ([]WindowInfo, error) {
+	var titleRe *regexp.Regexp
+	if f.TitleRegex != "" {
+		re, err := regexp.Compile(f.TitleRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title pattern %q: %w", f.TitleRegex, err)
+		}
+		titleRe = re
+	}
+
+	var result []WindowInfo
+	for _, w := range windows {
+		if f.match(w, titleRe) {
+			result = append(result, w)
+		}
+	}
+	return result, nil
+}
+
+// match は 1 つのウィンドウが条件に一致するかを判定します。
+func (f WindowFilter) match(w WindowInfo, titleRe *regexp.Regexp) bool {
+	for _, t := range f.ExcludeTitles {
+		if w.Title == t {
+			return false
+		}
+	}
+	if f.ExcludeMinimized && w.Minimized {
+		return false
+	}
+	if f.ExcludeCloaked && w.Cloaked {
+		return false
+	}
+	if f.ProcessName != "" && !strings.EqualFold(w.ProcessName, f.ProcessName) {
+		return false
+	}
+	if f.ClassName != "" && w.ClassName != f.ClassName {
+		return false
+	}
+	if titleRe != nil && !titleRe.MatchString(w.Title) {
+		return false
+	}
+	// 最小化されたウィンドウはサイズが意味を持たないため、サイズの条件を適用しない
+	if !w.Minimized && (w.Rect.Dx() < f.MinWidth || w.Rect.Dy() < f.MinHeight) {
+		return false
+	}
+	return true
+}
+
+// ListWindowsFiltered はウィンドウを列挙し、条件に一致するものを返します。
+func ListWindowsFiltered(c Capturer, f WindowFilter) ([]WindowInfo, error) {
+	windows, err := c.ListWindows()
+	if err != nil {
+		return nil, err
+	}
+	return f.Apply(windows)
+}
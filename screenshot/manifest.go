@@ -0,0 +1,202 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestSuffix はマニフェストのファイル名の末尾です。
+// マニフェストはセッションごとに、保存先ディレクトリに "<セッション ID>.manifest.jsonl" の名前で作成します。
+const ManifestSuffix = ".manifest.jsonl"
+
+// StopReason はセッションが終了した理由です。マニフェストのフッターに記録します。
+type StopReason string
+
+const (
+	StopDurationElapsed StopReason = "duration_elapsed" // 設定した撮影時間が経過した
+	StopUser            StopReason = "user_stop"        // ユーザーが停止した
+	StopWindow          StopReason = "window"           // 撮影対象のウィンドウが閉じられた (または最小化された)
+	StopError           StopReason = "error"            // エラー (空き容量の不足など) により停止した
+)
+
+// ManifestHeader はセッションの開始時に記録するレコードです。
+type ManifestHeader struct {
+	Type    string    `json:"type"` // 常に "header"
+	Session string    `json:"session"`
+	Time    time.Time `json:"time"`
+	Target  string    `json:"target"`           // 撮影対象の説明
+	Config  any       `json:"config,omitempty"` // セッション開始時の設定
+}
+
+// ManifestFrame は保存したフレームごとに記録するレコードです。
+type ManifestFrame struct {
+	Type           string        `json:"type"` // 常に "frame"
+	Session        string        `json:"session"`
+	Time           time.Time     `json:"time"` // 撮影時刻
+	Frame          int           `json:"frame"`
+	Path           string        `json:"path"` // 保存先ディレクトリからの相対パス
+	WindowTitle    string        `json:"window_title,omitempty"`
+	WindowRect     *ManifestRect `json:"window_rect,omitempty"`
+	Width          int           `json:"width"`           // 保存した画像の幅
+	Height         int           `json:"height"`          // 保存した画像の高さ
+	OriginalWidth  int           `json:"original_width"`  // 撮影した画像の幅 (縮小した場合に Width と異なる)
+	OriginalHeight int           `json:"original_height"` // 撮影した画像の高さ
+	Format         string        `json:"format"`
+	Bytes          int64         `json:"bytes"`
+	SHA256         string        `json:"sha256"`
+	LatencyMS      float64       `json:"latency_ms"` // 撮影にかかった時間 (ミリ秒)
+}
+
+// ManifestRect はウィンドウの矩形です (仮想デスクトップ座標)。
+type ManifestRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// ManifestFooter はセッションの終了時に記録するレコードです。
+type ManifestFooter struct {
+	Type     string     `json:"type"` // 常に "footer"
+	Session  string     `json:"session"`
+	Time     time.Time  `json:"time"`
+	Reason   StopReason `json:"reason"`
+	Detail   string     `json:"detail,omitempty"` // 理由の説明 (エラーの内容など)
+	Duration float64    `json:"duration_seconds"`
+	Saved    int        `json:"saved"`
+	Skipped  int        `json:"skipped"`
+	Failed   int        `json:"failed"`
+	Dropped  int        `json:"dropped"`
+}
+
+// Manifest は 1 つのセッションで保存したフレームを JSON Lines 形式で記録するファイルです。
+// 保存のワーカーから同時に使用できます。
+type Manifest struct {
+	mu      sync.Mutex
+	file    *os.File
+	dir     string
+	path    string
+	session string
+	start   time.Time // WriteHeader で設定する (mu で保護する)
+}
+
+// OpenManifest は dir にセッション session のマニフェストを新しく作成します。
+// 同じ名前のファイルがある場合 (同じ秒に開始したセッションなど) は "_1", "_2", ... を付けた名前で作成し、
+// 他のセッションのマニフェストに追記することはありません。
+func OpenManifest(dir, session string) (*Manifest, error) {
+	base := filepath.Join(dir, sanitizeFileName(session))
+	for i := 0; i < maxNameCollisions; i++ {
+		path := base + ManifestSuffix
+		if i > 0 {
+			path = fmt.Sprintf("%s_%d%s", base, i, ManifestSuffix)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return &Manifest{file: f, dir: dir, path: path, session: session}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create manifest %s: %w", path, err)
+		}
+	}
+	return nil, fmt.Errorf("failed to create manifest %s%s: too many files with the same name", base, ManifestSuffix)
+}
+
+// Path はマニフェストのファイルのパスを返します。
+func (m *Manifest) Path() string {
+	return m.path
+}
+
+// WriteHeader はセッションの開始を記録します。config は JSON に変換できる設定のスナップショットです。
+func (m *Manifest) WriteHeader(start time.Time, target string, config any) error {
+	m.mu.Lock()
+	m.start = start
+	m.mu.Unlock()
+	return m.write(ManifestHeader{
+		Type:    "header",
+		Session: m.session,
+		Time:    start,
+		Target:  target,
+		Config:  config,
+	})
+}
+
+// WriteFrame は保存したフレームを記録します。
+func (m *Manifest) WriteFrame(frame FrameInfo, saved SavedFile) error {
+	path := saved.Path
+	if rel, err := filepath.Rel(m.dir, saved.Path); err == nil {
+		path = filepath.ToSlash(rel)
+	}
+	record := ManifestFrame{
+		Type:           "frame",
+		Session:        m.session,
+		Time:           frame.Time,
+		Frame:          frame.Frame,
+		Path:           path,
+		WindowTitle:    frame.WindowTitle,
+		Width:          saved.Width,
+		Height:         saved.Height,
+		OriginalWidth:  frame.OriginalSize.X,
+		OriginalHeight: frame.OriginalSize.Y,
+		Format:         saved.Format,
+		Bytes:          saved.Bytes,
+		SHA256:         saved.SHA256,
+		LatencyMS:      float64(frame.Latency.Microseconds()) / 1000,
+	}
+	if !frame.WindowRect.Empty() {
+		record.WindowRect = newManifestRect(frame.WindowRect)
+	}
+	return m.write(record)
+}
+
+// WriteFooter はセッションの終了を記録します。Type、Session、Duration は自動的に設定します。
+func (m *Manifest) WriteFooter(footer ManifestFooter) error {
+	footer.Type = "footer"
+	footer.Session = m.session
+	m.mu.Lock()
+	start := m.start
+	m.mu.Unlock()
+	if !start.IsZero() {
+		footer.Duration = footer.Time.Sub(start).Seconds()
+	}
+	return m.write(footer)
+}
+
+// Close はマニフェストをディスクに書き出して閉じます。
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.file.Sync(); err != nil {
+		m.file.Close()
+		return fmt.Errorf("failed to sync manifest: %w", err)
+	}
+	return m.file.Close()
+}
+
+// write はレコードを 1 行の JSON として追記します。
+// 1 回の Write で書き込むため、クラッシュしても途中の行が他のレコードと混ざることはありません。
+func (m *Manifest) write(record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest record: %w", err)
+	}
+	line = append(line, '\n')
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// newManifestRect は image.Rectangle を ManifestRect に変換します。
+func newManifestRect(r image.Rectangle) *ManifestRect {
+	return &ManifestRect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
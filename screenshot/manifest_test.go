@@ -0,0 +1,101 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readManifest はマニフェストの各行を map として読み込みます。
+func readManifest(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid manifest line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestManifestPerSession(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	first, err := OpenManifest(dir, "20250102-030405")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同じ秒に開始したセッションは別のファイルに記録する
+	second, err := OpenManifest(dir, "20250102-030405")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "20250102-030405"+ManifestSuffix); first.Path() != want {
+		t.Errorf("path = %s, want %s", first.Path(), want)
+	}
+	if first.Path() == second.Path() {
+		t.Fatalf("both sessions write to %s", first.Path())
+	}
+
+	if err := first.WriteHeader(start, "window", nil); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFrame は保存のワーカーから同時に呼び出される
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			saved := SavedFile{Path: filepath.Join(dir, "sub", "shot.png"), Format: "png", Width: 4, Height: 3}
+			if err := first.WriteFrame(FrameInfo{Time: start, Frame: i}, saved); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := first.WriteFooter(ManifestFooter{Time: start.Add(90 * time.Second), Reason: StopUser, Saved: 8}); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*Manifest{first, second} {
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := readManifest(t, first.Path())
+	if len(records) != 10 {
+		t.Fatalf("got %d records, want 10", len(records))
+	}
+	if records[0]["type"] != "header" || records[9]["type"] != "footer" {
+		t.Errorf("first and last records are %v and %v", records[0]["type"], records[9]["type"])
+	}
+	for _, r := range records[1:9] {
+		if r["type"] != "frame" || r["path"] != "sub/shot.png" || r["session"] != "20250102-030405" {
+			t.Errorf("unexpected frame record %v", r)
+		}
+	}
+	if d := records[9]["duration_seconds"]; d != 90.0 {
+		t.Errorf("duration = %v, want 90", d)
+	}
+	if records := readManifest(t, second.Path()); len(records) != 0 {
+		t.Errorf("second session manifest has %d records, want 0", len(records))
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// WindowMatcher は再起動後も同じウィンドウを見つけるための識別条件です。
+// HWND はセッションごとに変わるため、タイトル・クラス名・実行ファイル名で照合します。
+// 空の項目は条件として使用しません。
+type WindowMatcher struct {
+	Title       string // ウィンドウタイトル
+	TitleRegex  bool   // true の場合 Title を正規表現として扱う
+	ClassName   string // ウィンドウクラス名 (完全一致)
+	ProcessName string // 実行ファイル名 (大文字小文字を区別しない)
+	// PID は MatchPID が true の場合にのみ絞り込みに使用し、それ以外の場合は複数のウィンドウが一致した場合の
+	// 優先順位にのみ使用します (プロセスが再起動すると PID は変わるため)。
+	PID      uint32
+	MatchPID bool
+	// HWND は複数のウィンドウが一致した場合の優先順位にのみ使用します。
+	HWND HWND
+}
+
+// IsZero は条件が何も設定されていないかどうかを返します。
+func (m WindowMatcher) IsZero() bool {
+	return m.Title == "" && m.ClassName == "" && m.ProcessName == "" && !m.matchesPID()
+}
+
+// matchesPID は PID を絞り込みの条件として使用するかどうかを返します。
+func (m WindowMatcher) matchesPID() bool {
+	return m.MatchPID && m.PID != 0
+}
+
+// MatcherFor は列挙されたウィンドウからそのウィンドウを識別する条件を作成します。
+func MatcherFor(w WindowInfo) WindowMatcher {
+	return WindowMatcher{
+		Title:       w.Title,
+		ClassName:   w.ClassName,
+		ProcessName: w.ProcessName,
+		PID:         w.PID,
+		HWND:        w.HWND,
+	}
+}
+
+// MatchWindows は windows のうち条件に一致するものを、優先度の高い順に返します。
+// 以前と同じ HWND のウィンドウ、次に同じ PID のウィンドウが先頭に来ます。
+func (m WindowMatcher) MatchWindows(windows []WindowInfo) ([]WindowInfo, error) {
+	if m.IsZero() {
+		return nil, fmt.Errorf("window matcher has no conditions")
+	}
+
+	var titleRe *regexp.Regexp
+	if m.TitleRegex && m.Title != "" {
+		re, err := regexp.Compile(m.Title)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window title pattern %q: %w", m.Title, err)
+		}
+		titleRe = re
+	}
+
+	var sameHWND, samePID, others []WindowInfo
+	for _, w := range windows {
+		if m.Title != "" {
+			if titleRe != nil && !titleRe.MatchString(w.Title) {
+				continue
+			}
+			if titleRe == nil && w.Title != m.Title {
+				continue
+			}
+		}
+		if m.ClassName != "" && w.ClassName != m.ClassName {
+			continue
+		}
+		if m.ProcessName != "" && !strings.EqualFold(w.ProcessName, m.ProcessName) {
+			continue
+		}
+		if m.matchesPID() && w.PID != m.PID {
+			continue
+		}
+
+		switch {
+		case m.HWND != 0 && w.HWND == m.HWND:
+			sameHWND = append(sameHWND, w)
+		case m.PID != 0 && w.PID == m.PID:
+			samePID = append(samePID, w)
+		default:
+			others = append(others, w)
+		}
+	}
+	return append(append(sameHWND, samePID...), others...), nil
+}
+
+// ResolveWindow は現在開いているウィンドウから条件に一致するものを、優先度の高い順に返します。
+// 一致するウィンドウがない場合は空のスライスを返します。
+func ResolveWindow(c Capturer, m WindowMatcher) ([]WindowInfo, error) {
+	windows, err := c.ListWindows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get window list: %w", err)
+	}
+	return m.MatchWindows(windows)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWindowMatcher(t *testing.T) {
+	windows := []WindowInfo{
+		{HWND: 1, Title: "Editor - a.txt", ProcessName: "editor.exe", PID: 100},
+		{HWND: 2, Title: "Editor - b.txt", ProcessName: "editor.exe", PID: 200},
+		{HWND: 3, Title: "Terminal", ProcessName: "term.exe", PID: 300},
+	}
+	hwnds := func(list []WindowInfo) []HWND {
+		var out []HWND
+		for _, w := range list {
+			out = append(out, w.HWND)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		matcher WindowMatcher
+		want    []HWND
+	}{
+		{"exact title", WindowMatcher{Title: "Terminal"}, []HWND{3}},
+		{"title regex", WindowMatcher{Title: `^Editor - .*\.txt$`, TitleRegex: true}, []HWND{1, 2}},
+		{"process is case insensitive", WindowMatcher{ProcessName: "EDITOR.EXE"}, []HWND{1, 2}},
+		// PID は MatchPID がない場合は優先順位にのみ使用する
+		{"pid orders", WindowMatcher{ProcessName: "editor.exe", PID: 200}, []HWND{2, 1}},
+		{"pid filters", WindowMatcher{ProcessName: "editor.exe", PID: 200, MatchPID: true}, []HWND{2}},
+		{"pid only", WindowMatcher{PID: 300, MatchPID: true}, []HWND{3}},
+		{"pid gone", WindowMatcher{Title: "Terminal", PID: 999, MatchPID: true}, nil},
+		{"hwnd before pid", WindowMatcher{ProcessName: "editor.exe", PID: 200, HWND: 1}, []HWND{1, 2}},
+	}
+	for _, tt := range tests {
+		got, err := tt.matcher.MatchWindows(windows)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if g := hwnds(got); !slices.Equal(g, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, g, tt.want)
+		}
+	}
+
+	if _, err := (WindowMatcher{PID: 100}).MatchWindows(windows); err == nil {
+		t.Error("expected an error for a matcher with only a priority PID")
+	}
+	if _, err := (WindowMatcher{Title: "(", TitleRegex: true}).MatchWindows(windows); err == nil {
+		t.Error("expected an error for an invalid title pattern")
+	}
+}
@@ -0,0 +1,673 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Version はこのツールのバージョンです。リリースのビルドでは
+// -ldflags "-X myscreenshot-tool/screenshot.Version=v1.2.3" で設定します。
+var Version = "dev"
+
+// Software は画像のメタデータに記録するツールの名前とバージョンを返します。
+func Software() string {
+	version := Version
+	if version == "dev" {
+		// go install でビルドした場合はモジュールのバージョンを使用する
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+	}
+	return "myscreenshot-tool " + version
+}
+
+// ImageMetadata は画像ファイルに埋め込む撮影時の情報です。
+// PNG では tEXt/iTXt チャンク、JPEG では EXIF (APP1) と COM セグメントに記録します。
+type ImageMetadata struct {
+	CaptureTime time.Time
+	WindowTitle string
+	ProcessName string
+	SessionID   string
+	Frame       int
+	Software    string
+	// OriginalSize は撮影した画像の大きさ、Size は保存した画像の大きさです (縮小した場合に異なります)。
+	OriginalSize image.Point
+	Size         image.Point
+
+	// Text は ReadMetadata がファイルから読み取ったすべてのテキスト項目です (書き込みには使用しません)。
+	Text map[string]string
+}
+
+// NewImageMetadata はフレームの情報と保存する画像の大きさから、画像に埋め込むメタデータを作成します。
+func NewImageMetadata(frame FrameInfo, size image.Point) ImageMetadata {
+	original := frame.OriginalSize
+	if original == (image.Point{}) {
+		original = size
+	}
+	return ImageMetadata{
+		CaptureTime:  frame.Time,
+		WindowTitle:  frame.WindowTitle,
+		ProcessName:  frame.ProcessName,
+		SessionID:    frame.SessionID,
+		Frame:        frame.Frame,
+		Software:     Software(),
+		OriginalSize: original,
+		Size:         size,
+	}
+}
+
+// ErrNoMetadata は画像ファイルにこのツールが埋め込んだメタデータが見つからない場合に返されます。
+var ErrNoMetadata = errors.New("screenshot: no capture metadata found")
+
+// メタデータの項目名 (PNG のキーワードと JPEG の COM セグメントの両方で使用します)。
+// "Creation Time"、"Title"、"Software" は PNG の仕様で定義されているキーワードです。
+const (
+	metaKeyTime     = "Creation Time"
+	metaKeyTitle    = "Title"
+	metaKeyProcess  = "Process"
+	metaKeySession  = "Session"
+	metaKeyFrame    = "Frame"
+	metaKeySoftware = "Software"
+	metaKeyOriginal = "Original Size"
+	metaKeySize     = "Stored Size"
+)
+
+// metaTimeLayout は撮影時刻の形式です (ミリ秒とタイムゾーンを含む RFC 3339)。
+const metaTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// maxMetaValueBytes は 1 つの項目に記録する最大のバイト数です (JPEG のセグメントの長さの上限に収めるため)。
+const maxMetaValueBytes = 4096
+
+// metaField はメタデータの 1 項目です。
+type metaField struct {
+	key, value string
+}
+
+// fields はメタデータを書き込む順に項目の一覧にします。値が空の項目は含めません。
+func (m ImageMetadata) fields() []metaField {
+	var fields []metaField
+	add := func(key, value string) {
+		// 改行は COM セグメントの区切りに使用するため空白に置き換える
+		value = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(value)
+		if value != "" {
+			fields = append(fields, metaField{key, truncateBytes(value, maxMetaValueBytes)})
+		}
+	}
+	if !m.CaptureTime.IsZero() {
+		add(metaKeyTime, m.CaptureTime.Format(metaTimeLayout))
+	}
+	add(metaKeyTitle, m.WindowTitle)
+	add(metaKeyProcess, m.ProcessName)
+	add(metaKeySession, m.SessionID)
+	add(metaKeyFrame, strconv.Itoa(m.Frame))
+	add(metaKeySoftware, m.Software)
+	if m.OriginalSize != (image.Point{}) {
+		add(metaKeyOriginal, formatSize(m.OriginalSize))
+	}
+	if m.Size != (image.Point{}) {
+		add(metaKeySize, formatSize(m.Size))
+	}
+	return fields
+}
+
+// set は読み取った項目を対応するフィールドに設定します。
+func (m *ImageMetadata) set(key, value string) {
+	if m.Text == nil {
+		m.Text = make(map[string]string)
+	}
+	m.Text[key] = value
+	switch key {
+	case metaKeyTime:
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			m.CaptureTime = t
+		}
+	case metaKeyTitle:
+		m.WindowTitle = value
+	case metaKeyProcess:
+		m.ProcessName = value
+	case metaKeySession:
+		m.SessionID = value
+	case metaKeyFrame:
+		if n, err := strconv.Atoi(value); err == nil {
+			m.Frame = n
+		}
+	case metaKeySoftware:
+		m.Software = value
+	case metaKeyOriginal:
+		m.OriginalSize, _ = parseSize(value)
+	case metaKeySize:
+		m.Size, _ = parseSize(value)
+	}
+}
+
+// formatSize は画像の大きさを "幅x高さ" の形式にします。
+func formatSize(p image.Point) string {
+	return strconv.Itoa(p.X) + "x" + strconv.Itoa(p.Y)
+}
+
+// parseSize は "幅x高さ" の形式の大きさを解析します。
+func parseSize(s string) (image.Point, bool) {
+	w, h, ok := strings.Cut(s, "x")
+	if !ok {
+		return image.Point{}, false
+	}
+	x, errX := strconv.Atoi(w)
+	y, errY := strconv.Atoi(h)
+	if errX != nil || errY != nil {
+		return image.Point{}, false
+	}
+	return image.Pt(x, y), true
+}
+
+// truncateBytes は s を UTF-8 の文字の途中で切らないように最大 n バイトに切り詰めます。
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// insertWriter はエンコーダーの出力の指定された位置に、メタデータのバイト列を挿入する io.Writer です。
+// 画像をエンコードし直さずに、標準のエンコーダーの出力にチャンクやセグメントを追加するために使用します。
+type insertWriter struct {
+	w      io.Writer
+	at     int    // 挿入する位置 (出力の先頭からのバイト数)
+	insert []byte // 挿入するバイト列
+	n      int    // これまでに書き込んだバイト数
+	done   bool
+}
+
+func (iw *insertWriter) Write(p []byte) (int, error) {
+	if iw.done || iw.n+len(p) < iw.at {
+		iw.n += len(p)
+		return iw.w.Write(p)
+	}
+	k := iw.at - iw.n
+	if _, err := iw.w.Write(p[:k]); err != nil {
+		return 0, err
+	}
+	if _, err := iw.w.Write(iw.insert); err != nil {
+		return k, err
+	}
+	iw.done = true
+	n, err := iw.w.Write(p[k:])
+	iw.n += len(p)
+	return k + n, err
+}
+
+// ----- PNG -----
+
+// pngSignature は PNG ファイルの先頭の 8 バイトです。
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngHeaderSize はシグネチャと IHDR チャンク (データは常に 13 バイト) の合計の大きさです。
+// テキストチャンクは IHDR の直後に挿入します。
+const pngHeaderSize = 8 + 4 + 4 + 13 + 4
+
+// pngTextChunks はメタデータを PNG のテキストチャンクにします。
+// ASCII だけの値は tEXt、それ以外 (日本語のウィンドウタイトルなど) は UTF-8 の iTXt で記録します。
+func pngTextChunks(meta ImageMetadata) []byte {
+	var buf bytes.Buffer
+	for _, f := range meta.fields() {
+		if isASCII(f.value) {
+			writePNGChunk(&buf, "tEXt", []byte(f.key+"\x00"+f.value))
+		} else {
+			// キーワード、圧縮フラグ (0)、圧縮方式 (0)、言語タグ (空)、翻訳されたキーワード (空)、テキスト
+			writePNGChunk(&buf, "iTXt", []byte(f.key+"\x00\x00\x00\x00\x00"+f.value))
+		}
+	}
+	return buf.Bytes()
+}
+
+// writePNGChunk は長さ、種類、データ、CRC からなる PNG のチャンクを書き込みます。
+func writePNGChunk(buf *bytes.Buffer, typ string, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	buf.WriteString(typ)
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+// isASCII は s が ASCII の文字だけからなるかどうかを返します。
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// maxTextChunkSize は読み取るテキストチャンクの最大の大きさです (壊れたファイルで大きなメモリを確保しないため)。
+const maxTextChunkSize = 1 << 20
+
+// readPNGMetadata は PNG ファイルの tEXt/iTXt/zTXt チャンクを読み取ります。
+func readPNGMetadata(r io.ReadSeeker) (ImageMetadata, error) {
+	var meta ImageMetadata
+	if _, err := r.Seek(int64(len(pngSignature)), io.SeekStart); err != nil {
+		return meta, err
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return meta, fmt.Errorf("failed to read PNG chunk: %w", err)
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		typ := string(header[4:])
+		switch typ {
+		case "IEND":
+			return meta, nil
+		case "tEXt", "iTXt", "zTXt":
+			if length > maxTextChunkSize {
+				return meta, fmt.Errorf("PNG %s chunk too large: %d bytes", typ, length)
+			}
+			data := make([]byte, length+4)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return meta, fmt.Errorf("failed to read PNG %s chunk: %w", typ, err)
+			}
+			crc := crc32.NewIEEE()
+			crc.Write(header[4:])
+			crc.Write(data[:length])
+			if crc.Sum32() != binary.BigEndian.Uint32(data[length:]) {
+				continue // 壊れたチャンクは無視する
+			}
+			if key, value, ok := parsePNGText(typ, data[:length]); ok {
+				meta.set(key, value)
+			}
+		default:
+			if _, err := r.Seek(int64(length)+4, io.SeekCurrent); err != nil {
+				return meta, err
+			}
+		}
+	}
+}
+
+// parsePNGText はテキストチャンクのデータからキーワードとテキストを取り出します。
+func parsePNGText(typ string, data []byte) (key, value string, ok bool) {
+	k, rest, found := bytes.Cut(data, []byte{0})
+	if !found {
+		return "", "", false
+	}
+	key = string(k)
+	switch typ {
+	case "tEXt": // テキストは Latin-1
+		return key, latin1ToUTF8(rest), true
+	case "zTXt": // 圧縮方式 (1 バイト) と zlib で圧縮された Latin-1 のテキスト
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		text, err := inflate(rest[1:])
+		if err != nil {
+			return "", "", false
+		}
+		return key, latin1ToUTF8(text), true
+	default: // iTXt: 圧縮フラグ、圧縮方式、言語タグ、翻訳されたキーワード、UTF-8 のテキスト
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		_, rest, found = bytes.Cut(rest[2:], []byte{0}) // 言語タグ
+		if !found {
+			return "", "", false
+		}
+		_, text, found := bytes.Cut(rest, []byte{0}) // 翻訳されたキーワード
+		if !found {
+			return "", "", false
+		}
+		if compressed {
+			var err error
+			if text, err = inflate(text); err != nil {
+				return "", "", false
+			}
+		}
+		return key, string(text), true
+	}
+}
+
+// inflate は zlib で圧縮されたデータを展開します。
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxTextChunkSize))
+}
+
+// latin1ToUTF8 は Latin-1 (ISO 8859-1) のバイト列を UTF-8 の文字列に変換します。
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// ----- JPEG -----
+
+// JPEG のマーカー
+const (
+	jpegSOI  = 0xd8
+	jpegEOI  = 0xd9
+	jpegSOS  = 0xda
+	jpegAPP1 = 0xe1
+	jpegCOM  = 0xfe
+)
+
+// exifHeader は EXIF の APP1 セグメントのデータの先頭です。
+var exifHeader = []byte("Exif\x00\x00")
+
+// EXIF (TIFF) のタグ
+const (
+	exifTagImageDescription   = 0x010e
+	exifTagSoftware           = 0x0131
+	exifTagDateTime           = 0x0132
+	exifTagExifIFD            = 0x8769
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagSubSecTimeOriginal = 0x9291
+)
+
+// EXIF のデータ型
+const (
+	exifTypeASCII = 2
+	exifTypeLong  = 4
+)
+
+// jpegMetadataSegments はメタデータを JPEG の EXIF (APP1) と COM セグメントにします。
+// EXIF には一般的な画像ビューアーが表示する項目 (撮影日時、説明、ソフトウェア) を、
+// COM にはすべての項目を "キー=値" の行で記録します。
+func jpegMetadataSegments(meta ImageMetadata) []byte {
+	var buf bytes.Buffer
+	writeJPEGSegment(&buf, jpegAPP1, append(append([]byte(nil), exifHeader...), buildEXIF(meta)...))
+
+	var comment strings.Builder
+	for _, f := range meta.fields() {
+		comment.WriteString(f.key + "=" + f.value + "\n")
+	}
+	writeJPEGSegment(&buf, jpegCOM, []byte(comment.String()))
+	return buf.Bytes()
+}
+
+// writeJPEGSegment はマーカー、長さ、データからなる JPEG のセグメントを書き込みます。
+func writeJPEGSegment(buf *bytes.Buffer, marker byte, data []byte) {
+	buf.Write([]byte{0xff, marker})
+	binary.Write(buf, binary.BigEndian, uint16(len(data)+2))
+	buf.Write(data)
+}
+
+// exifEntry は IFD の 1 項目です。
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte // 4 バイト以下の場合は項目に直接記録し、それ以外はデータ領域に記録する
+}
+
+// exifASCII は文字列の項目を作成します (EXIF の ASCII 型は NUL で終わる)。
+func exifASCII(tag uint16, s string) exifEntry {
+	data := append([]byte(s), 0)
+	return exifEntry{tag: tag, typ: exifTypeASCII, count: uint32(len(data)), data: data}
+}
+
+// buildEXIF はリトルエンディアンの TIFF 構造で IFD0 と Exif IFD を作成します。
+func buildEXIF(meta ImageMetadata) []byte {
+	var ifd0, exif []exifEntry
+	if meta.WindowTitle != "" {
+		ifd0 = append(ifd0, exifASCII(exifTagImageDescription, truncateBytes(meta.WindowTitle, maxMetaValueBytes)))
+	}
+	if meta.Software != "" {
+		ifd0 = append(ifd0, exifASCII(exifTagSoftware, meta.Software))
+	}
+	if !meta.CaptureTime.IsZero() {
+		t := meta.CaptureTime
+		ifd0 = append(ifd0, exifASCII(exifTagDateTime, t.Format("2006:01:02 15:04:05")))
+		// タグの番号順に並べる必要がある
+		exif = append(exif,
+			exifASCII(exifTagDateTimeOriginal, t.Format("2006:01:02 15:04:05")),
+			exifASCII(exifTagOffsetTimeOriginal, t.Format("-07:00")),
+			exifASCII(exifTagSubSecTimeOriginal, fmt.Sprintf("%03d", t.Nanosecond()/int(time.Millisecond))),
+		)
+	}
+
+	le := binary.LittleEndian
+	const tiffHeaderSize = 8
+	if len(exif) > 0 {
+		// Exif IFD は IFD0 の直後に置く (ポインターの項目を加えた後の IFD0 の大きさから位置が決まる)
+		ptr := exifEntry{tag: exifTagExifIFD, typ: exifTypeLong, count: 1, data: make([]byte, 4)}
+		le.PutUint32(ptr.data, uint32(tiffHeaderSize+ifdSize(append(ifd0, ptr))))
+		ifd0 = append(ifd0, ptr)
+	}
+
+	b := []byte("II*\x00")
+	b = le.AppendUint32(b, tiffHeaderSize)
+	b = appendIFD(b, ifd0)
+	if len(exif) > 0 {
+		b = appendIFD(b, exif)
+	}
+	return b
+}
+
+// ifdSize は IFD とそのデータ領域を合わせた大きさを返します。
+func ifdSize(entries []exifEntry) int {
+	size := 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		if len(e.data) > 4 {
+			size += len(e.data) + len(e.data)%2 // データは偶数のオフセットに置く
+		}
+	}
+	return size
+}
+
+// appendIFD は b の末尾に IFD とそのデータ領域を追加します (次の IFD はなし)。
+// b は TIFF のヘッダーから始まっている必要があります (オフセットは b の先頭からの位置です)。
+func appendIFD(b []byte, entries []exifEntry) []byte {
+	le := binary.LittleEndian
+	dataOffset := len(b) + 2 + 12*len(entries) + 4
+	var data []byte
+	b = le.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = le.AppendUint16(b, e.tag)
+		b = le.AppendUint16(b, e.typ)
+		b = le.AppendUint32(b, e.count)
+		if len(e.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			b = append(b, value...)
+			continue
+		}
+		b = le.AppendUint32(b, uint32(dataOffset+len(data)))
+		data = append(data, e.data...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	b = le.AppendUint32(b, 0)
+	return append(b, data...)
+}
+
+// readJPEGMetadata は JPEG ファイルの EXIF と COM セグメントを読み取ります。
+// COM セグメントの項目は EXIF の同じ項目より優先します (タイムゾーンやミリ秒を含むため)。
+func readJPEGMetadata(r io.ReadSeeker) (ImageMetadata, error) {
+	var meta ImageMetadata
+	if _, err := r.Seek(2, io.SeekStart); err != nil {
+		return meta, err
+	}
+	var comment string
+	marker := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(r, marker[:1]); err != nil {
+			return meta, fmt.Errorf("failed to read JPEG marker: %w", err)
+		}
+		if marker[0] != 0xff {
+			return meta, fmt.Errorf("invalid JPEG marker 0x%02x", marker[0])
+		}
+		// マーカーの前には任意の数の 0xFF (フィルバイト) が置かれることがある
+		for marker[1] = 0xff; marker[1] == 0xff; {
+			if _, err := io.ReadFull(r, marker[1:]); err != nil {
+				return meta, fmt.Errorf("failed to read JPEG marker: %w", err)
+			}
+		}
+		switch m := marker[1]; {
+		case m == jpegSOS || m == jpegEOI:
+			// 以降は画像のデータなので、メタデータはここまでにある
+			if comment != "" {
+				for _, line := range strings.Split(comment, "\n") {
+					if key, value, ok := strings.Cut(line, "="); ok {
+						meta.set(key, value)
+					}
+				}
+			}
+			return meta, nil
+		case m == 0x01 || (m >= 0xd0 && m <= 0xd7):
+			continue // 長さを持たないマーカー
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return meta, fmt.Errorf("failed to read JPEG segment: %w", err)
+		}
+		if length < 2 {
+			return meta, fmt.Errorf("invalid JPEG segment length %d", length)
+		}
+		size := int64(length) - 2
+		if marker[1] != jpegAPP1 && marker[1] != jpegCOM {
+			if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+				return meta, err
+			}
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return meta, fmt.Errorf("failed to read JPEG segment: %w", err)
+		}
+		if marker[1] == jpegCOM {
+			comment += string(data)
+		} else if bytes.HasPrefix(data, exifHeader) {
+			parseEXIF(&meta, data[len(exifHeader):])
+		}
+	}
+}
+
+// parseEXIF は EXIF の TIFF 構造から、このツールが記録する項目を読み取ります。
+func parseEXIF(meta *ImageMetadata, tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	values := make(map[uint16]string)
+	var readIFD func(offset uint32, depth int)
+	readIFD = func(offset uint32, depth int) {
+		if depth > 1 || int64(offset)+2 > int64(len(tiff)) {
+			return
+		}
+		n := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < n; i++ {
+			p := int(offset) + 2 + 12*i
+			if p+12 > len(tiff) {
+				return
+			}
+			tag, typ, count := order.Uint16(tiff[p:]), order.Uint16(tiff[p+2:]), order.Uint32(tiff[p+4:])
+			switch {
+			case tag == exifTagExifIFD && typ == exifTypeLong:
+				readIFD(order.Uint32(tiff[p+8:]), depth+1)
+			case typ == exifTypeASCII:
+				var value []byte
+				if count <= 4 {
+					value = tiff[p+8 : p+8+int(count)]
+				} else if off := order.Uint32(tiff[p+8:]); int64(off)+int64(count) <= int64(len(tiff)) {
+					value = tiff[off : off+count]
+				}
+				values[tag] = strings.TrimRight(string(value), "\x00")
+			}
+		}
+	}
+	readIFD(order.Uint32(tiff[4:]), 0)
+
+	if v := values[exifTagImageDescription]; v != "" {
+		meta.set(metaKeyTitle, v)
+	}
+	if v := values[exifTagSoftware]; v != "" {
+		meta.set(metaKeySoftware, v)
+	}
+	datetime := values[exifTagDateTimeOriginal]
+	if datetime == "" {
+		datetime = values[exifTagDateTime]
+	}
+	if datetime != "" {
+		loc := time.Local
+		if offset := values[exifTagOffsetTimeOriginal]; offset != "" {
+			if t, err := time.Parse("-07:00", offset); err == nil {
+				loc = t.Location()
+			}
+		}
+		if t, err := time.ParseInLocation("2006:01:02 15:04:05", datetime, loc); err == nil {
+			if ms, err := strconv.Atoi(values[exifTagSubSecTimeOriginal]); err == nil {
+				t = t.Add(time.Duration(ms) * time.Millisecond)
+			}
+			meta.set(metaKeyTime, t.Format(metaTimeLayout))
+		}
+	}
+}
+
+// ----- 読み取り -----
+
+// ReadMetadata は SaveScreenshot が PNG または JPEG ファイルに埋め込んだ撮影時の情報を読み取ります。
+// メタデータが見つからない場合は ErrNoMetadata を返します。
+// 他のツールが書き込んだテキスト項目も ImageMetadata.Text で取得できます。
+func ReadMetadata(path string) (ImageMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ImageMetadata{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(pngSignature))
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+
+	var meta ImageMetadata
+	switch {
+	case bytes.Equal(magic, pngSignature):
+		meta, err = readPNGMetadata(f)
+	case bytes.HasPrefix(magic, []byte{0xff, jpegSOI}):
+		meta, err = readJPEGMetadata(f)
+	default:
+		return ImageMetadata{}, fmt.Errorf("reading metadata from %s: unsupported image format", path)
+	}
+	if err != nil {
+		return meta, fmt.Errorf("failed to read metadata from %s: %w", path, err)
+	}
+	if len(meta.Text) == 0 {
+		return meta, ErrNoMetadata
+	}
+	return meta, nil
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// testMetadata はテスト用の、すべての項目を設定したメタデータを作成します。
+func testMetadata(title string) ImageMetadata {
+	return ImageMetadata{
+		CaptureTime:  time.Date(2025, 1, 2, 3, 4, 5, 678e6, time.FixedZone("JST", 9*60*60)),
+		WindowTitle:  title,
+		ProcessName:  "notepad.exe",
+		SessionID:    "20250102-030405",
+		Frame:        42,
+		Software:     "myscreenshot-tool test",
+		OriginalSize: image.Pt(32, 24),
+		Size:         image.Pt(16, 12),
+	}
+}
+
+// encodeWithMetadata は format のエンコーダーで img と meta をファイルに書き込み、そのパスを返します。
+func encodeWithMetadata(t *testing.T, format string, img image.Image, meta ImageMetadata) string {
+	t.Helper()
+	enc, err := NewEncoder(format, EncoderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := enc.(MetadataEncoder).EncodeWithMetadata(&buf, img, meta); err != nil {
+		t.Fatalf("%s: %v", format, err)
+	}
+	path := filepath.Join(t.TempDir(), "shot"+enc.Extension())
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	img := filledRGBA(image.Rect(0, 0, 16, 12), color.RGBA{0x40, 0x80, 0xc0, 0xff})
+	longASCII := strings.Repeat("a", maxMetaValueBytes+100)
+	longJapanese := strings.Repeat("あ", maxMetaValueBytes) // 3 バイトの文字で上限を超える
+	tests := []struct {
+		name  string
+		title string
+		want  string // 読み取れるタイトル
+	}{
+		{"ascii", "Editor - notes.txt", "Editor - notes.txt"},
+		{"non-ascii", "メモ帳 — 日本語.txt", "メモ帳 — 日本語.txt"}, // PNG では iTXt
+		{"latin-1", "café", "café"},
+		{"newline", "line 1\nline 2", "line 1 line 2"},
+		{"long ascii", longASCII, longASCII[:maxMetaValueBytes]},
+		{"long non-ascii", longJapanese, longJapanese[:maxMetaValueBytes/3*3]}, // 文字の途中で切らない
+	}
+	decoders := map[string]func(r *bytes.Reader) (image.Image, error){
+		FormatPNG:  func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) },
+		FormatJPEG: func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) },
+	}
+	for _, format := range []string{FormatPNG, FormatJPEG} {
+		for _, tt := range tests {
+			name := format + "/" + tt.name
+			path := encodeWithMetadata(t, format, img, testMetadata(tt.title))
+
+			got, err := ReadMetadata(path)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			want := testMetadata(tt.want)
+			if !got.CaptureTime.Equal(want.CaptureTime) {
+				t.Errorf("%s: CaptureTime = %v, want %v", name, got.CaptureTime, want.CaptureTime)
+			}
+			if _, offset := got.CaptureTime.Zone(); offset != 9*60*60 {
+				t.Errorf("%s: CaptureTime zone offset = %d, want +09:00", name, offset)
+			}
+			if got.WindowTitle != want.WindowTitle {
+				t.Errorf("%s: WindowTitle = %q (%d bytes), want %d bytes", name, truncateBytes(got.WindowTitle, 40), len(got.WindowTitle), len(want.WindowTitle))
+			}
+			if !utf8.ValidString(got.WindowTitle) {
+				t.Errorf("%s: WindowTitle is not valid UTF-8", name)
+			}
+			if got.ProcessName != want.ProcessName || got.SessionID != want.SessionID || got.Frame != want.Frame || got.Software != want.Software {
+				t.Errorf("%s: got process %q, session %q, frame %d, software %q; want %q, %q, %d, %q", name,
+					got.ProcessName, got.SessionID, got.Frame, got.Software, want.ProcessName, want.SessionID, want.Frame, want.Software)
+			}
+			if got.OriginalSize != want.OriginalSize || got.Size != want.Size {
+				t.Errorf("%s: sizes = %v, %v; want %v, %v", name, got.OriginalSize, got.Size, want.OriginalSize, want.Size)
+			}
+			if got.Text[metaKeyTitle] != want.WindowTitle {
+				t.Errorf("%s: Text[%q] does not hold the title", name, metaKeyTitle)
+			}
+
+			// メタデータを埋め込んでも標準のデコーダーで読み込める
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format == FormatPNG && !isASCII(tt.title) && !bytes.Contains(data, []byte("iTXt"+metaKeyTitle+"\x00")) {
+				t.Errorf("%s: title was not written to an iTXt chunk", name)
+			}
+			decoded, err := decoders[format](bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: decode: %v", name, err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Errorf("%s: decoded bounds = %v, want %v", name, decoded.Bounds(), img.Bounds())
+			}
+		}
+	}
+}
+
+func TestReadMetadataWithoutMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMetadata(path); !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("err = %v, want ErrNoMetadata", err)
+	}
+}
+
+func TestReadMetadataInvalidInput(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	meta := testMetadata("タイトル")
+
+	// 途中で切れたファイルはエラーになる (パニックしない)
+	for _, format := range []string{FormatPNG, FormatJPEG} {
+		data, err := os.ReadFile(encodeWithMetadata(t, format, img, meta))
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, end := readPNGMetadata, len(data)-len(pngTrailer)+8 // IEND チャンクの種類まで読めれば終わり
+		if format == FormatJPEG {
+			read, end = readJPEGMetadata, 2+len(jpegMetadataSegments(meta))+2 // 次のセグメントのマーカーまで
+		}
+		for n := 8; n < end; n++ {
+			if _, err := read(bytes.NewReader(data[:n])); err == nil {
+				t.Fatalf("%s: no error for a file truncated to %d of %d bytes", format, n, len(data))
+			}
+		}
+	}
+
+	// 壊れたファイル
+	dir := t.TempDir()
+	rnd := rand.New(rand.NewSource(1))
+	inputs := [][]byte{nil, []byte("not an image"), pngSignature, {0xff, jpegSOI}}
+	for i := 0; i < 200; i++ {
+		garbage := make([]byte, rnd.Intn(256))
+		rnd.Read(garbage)
+		prefix := pngSignature
+		if i%2 == 1 {
+			prefix = []byte{0xff, jpegSOI}
+		}
+		inputs = append(inputs, append(append([]byte(nil), prefix...), garbage...))
+	}
+	for i, data := range inputs {
+		path := filepath.Join(dir, "garbage")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadMetadata(path); err == nil {
+			t.Errorf("input %d (% x...): no error", i, data[:min(len(data), 16)])
+		}
+	}
+}
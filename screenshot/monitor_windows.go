@@ -0,0 +1,117 @@
+//go:build windows
+
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	enumDisplayMonitorsProc = user32.NewProc("EnumDisplayMonitors")
+	getMonitorInfoProc      = user32.NewProc("GetMonitorInfoW")
+	getDCProc               = user32.NewProc("GetDC")
+)
+
+// MONITORINFOEXW 構造体 (モニターの位置と名前)
+type MONITORINFOEXW struct {
+	CbSize    uint32
+	RcMonitor RECT
+	RcWork    RECT
+	DwFlags   uint32
+	SzDevice  [32]uint16
+}
+
+const MONITORINFOF_PRIMARY = 0x00000001
+
+// EnumDisplayMonitors のコールバックはパッケージ初期化時に一度だけ作成する。
+// 呼び出しごとの結果は lParam に渡した ID で monitorEnums から取り出す。
+var (
+	monitorEnumCallback = syscall.NewCallback(monitorEnumProc)
+	monitorEnums        enumRegistry[[]MonitorInfo]
+)
+
+// monitorEnumProc は EnumDisplayMonitors API のコールバック関数です。
+func monitorEnumProc(hMonitor, hdc, lprcMonitor, lParam uintptr) uintptr {
+	list := monitorEnums.lookup(lParam)
+	if list == nil {
+		return 0 // 列挙を中止
+	}
+
+	mi := MONITORINFOEXW{CbSize: uint32(unsafe.Sizeof(MONITORINFOEXW{}))}
+	ret, _, _ := getMonitorInfoProc.Call(hMonitor, uintptr(unsafe.Pointer(&mi)))
+	if ret == 0 {
+		return 1 // 情報が取れないモニターはスキップし、列挙を継続
+	}
+
+	*list = append(*list, MonitorInfo{
+		Index:   len(*list),
+		Name:    syscall.UTF16ToString(mi.SzDevice[:]),
+		Bounds:  image.Rect(int(mi.RcMonitor.Left), int(mi.RcMonitor.Top), int(mi.RcMonitor.Right), int(mi.RcMonitor.Bottom)),
+		Primary: mi.DwFlags&MONITORINFOF_PRIMARY != 0,
+	})
+	return 1 // true を返し、列挙を継続
+}
+
+// ListMonitors は接続されているモニターの一覧を取得します。
+func (c *GDICapturer) ListMonitors() ([]MonitorInfo, error) {
+	var list []MonitorInfo
+	id := monitorEnums.register(&list)
+	defer monitorEnums.unregister(id)
+
+	ret, _, err := enumDisplayMonitorsProc.Call(0, 0, monitorEnumCallback, id)
+	if ret == 0 {
+		return nil, fmt.Errorf("EnumDisplayMonitors failed: %w", err)
+	}
+	return list, nil
+}
+
+// CaptureRect は仮想デスクトップ座標で指定された画面の領域を BitBlt で撮影します。
+func (c *GDICapturer) CaptureRect(rect image.Rectangle) (image.Image, error) {
+	width := rect.Dx()
+	height := rect.Dy()
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid capture rect %v", rect)
+	}
+
+	// 画面全体の DC を取得
+	screenDC, _, err := getDCProc.Call(0)
+	if screenDC == 0 {
+		return nil, fmt.Errorf("GetDC failed: %w", err)
+	}
+	defer releaseDCProc.Call(0, screenDC)
+
+	memDC, _, err := createCompatibleDCSingleProc.Call(screenDC)
+	if memDC == 0 {
+		return nil, fmt.Errorf("CreateCompatibleDC failed: %w", err)
+	}
+	defer deleteDCProc.Call(memDC)
+
+	hBitmap, _, err := createCompatibleBitmapProc.Call(screenDC, uintptr(width), uintptr(height))
+	if hBitmap == 0 {
+		return nil, fmt.Errorf("CreateCompatibleBitmap failed: %w", err)
+	}
+	defer deleteObjectProc.Call(hBitmap)
+
+	oldBitmap, _, _ := selectObjectProc.Call(memDC, hBitmap)
+	defer selectObjectProc.Call(memDC, oldBitmap)
+
+	// CAPTUREBLT を指定して、レイヤードウィンドウも含めて画面をコピーする
+	const SRCCOPY = 0x00CC0020
+	const CAPTUREBLT = 0x40000000
+	ret, _, err := bitBltProc.Call(memDC, 0, 0, uintptr(width), uintptr(height),
+		screenDC, uintptr(rect.Min.X), uintptr(rect.Min.Y), SRCCOPY|CAPTUREBLT)
+	if ret == 0 {
+		return nil, fmt.Errorf("BitBlt failed: %w", err)
+	}
+
+	img, err := c.bitmapToImage(HBITMAP(hBitmap), width, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert bitmap to image: %w", err)
+	}
+	return img, nil
+}
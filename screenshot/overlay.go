@@ -0,0 +1,220 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// OverlayPosition は画像の上でテキストの帯を描く位置です。値は config.OverlaySetting.Position にそのまま保存されます。
+type OverlayPosition string
+
+const (
+	OverlayTop         OverlayPosition = "top"          // 上端 (画像の幅いっぱいの帯)
+	OverlayBottom      OverlayPosition = "bottom"       // 下端 (画像の幅いっぱいの帯)
+	OverlayTopLeft     OverlayPosition = "top_left"     // 左上 (テキストの大きさの帯)
+	OverlayTopRight    OverlayPosition = "top_right"    // 右上
+	OverlayBottomLeft  OverlayPosition = "bottom_left"  // 左下
+	OverlayBottomRight OverlayPosition = "bottom_right" // 右下
+)
+
+// DefaultOverlayFontSize は FontSize が指定されていない場合の文字の大きさ (ピクセル) です。
+const DefaultOverlayFontSize = 16
+
+// overlayTimeLayout はオーバーレイに表示する撮影時刻の形式です。
+const overlayTimeLayout = "2006-01-02 15:04:05.000 -07:00"
+
+// OverlayOptions はオーバーレイの設定です。
+type OverlayOptions struct {
+	ShowTime  bool   // 撮影時刻を表示する
+	ShowTitle bool   // ウィンドウのタイトルを表示する
+	ShowFrame bool   // フレーム番号を表示する
+	Label     string // 任意のテキスト (空の場合は表示しない)
+
+	Position OverlayPosition // 空の場合は OverlayBottom
+	FontSize float64         // 文字の大きさ (ピクセル、0 以下の場合は DefaultOverlayFontSize)
+	// FontFile は使用する TrueType/OpenType フォントのファイルです。空の場合は組み込みの Go フォントを使用します
+	// (Go フォントには日本語の文字がないため、日本語のタイトルを表示する場合は指定してください)。
+	FontFile string
+
+	TextColor         color.Color // nil の場合は白
+	BackgroundColor   color.Color // nil の場合は黒
+	BackgroundOpacity float64     // 背景の不透明度 (0-1)
+}
+
+// Overlay は撮影時刻やウィンドウのタイトルなどのテキストの帯を画像に描き込む FrameProcessor です。
+type Overlay struct {
+	opts OverlayOptions
+	text *image.Uniform
+	bg   *image.Uniform
+
+	// font.Face は複数のゴルーチンから同時に使用できないため、描画は 1 つずつ行う
+	mu   sync.Mutex
+	face font.Face
+}
+
+// NewOverlay はフォントを読み込んでオーバーレイを作成します。
+func NewOverlay(opts OverlayOptions) (*Overlay, error) {
+	switch opts.Position {
+	case "":
+		opts.Position = OverlayBottom
+	case OverlayTop, OverlayBottom, OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight:
+	default:
+		return nil, fmt.Errorf("unknown overlay position %q", opts.Position)
+	}
+	if opts.FontSize <= 0 {
+		opts.FontSize = DefaultOverlayFontSize
+	}
+	if opts.BackgroundOpacity < 0 || opts.BackgroundOpacity > 1 {
+		return nil, fmt.Errorf("overlay background opacity must be between 0 and 1: %g", opts.BackgroundOpacity)
+	}
+	if opts.TextColor == nil {
+		opts.TextColor = color.White
+	}
+	if opts.BackgroundColor == nil {
+		opts.BackgroundColor = color.Black
+	}
+
+	face, err := loadFontFace(opts.FontFile, opts.FontSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// 背景は指定された不透明度で重ねる
+	bg := color.NRGBAModel.Convert(opts.BackgroundColor).(color.NRGBA)
+	bg.A = uint8(opts.BackgroundOpacity*255 + 0.5)
+
+	return &Overlay{
+		opts: opts,
+		text: image.NewUniform(opts.TextColor),
+		bg:   image.NewUniform(bg),
+		face: face,
+	}, nil
+}
+
+// loadFontFace はフォントのファイル (空の場合は組み込みの Go フォント) から指定された大きさのフェイスを作成します。
+func loadFontFace(path string, size float64) (font.Face, error) {
+	data := goregular.TTF
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read overlay font %s: %w", path, err)
+		}
+	}
+	// TrueType Collection (.ttc) の場合は最初のフォントを使用する
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse overlay font %s: %w", path, err)
+	}
+	f, err := collection.Font(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse overlay font %s: %w", path, err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create overlay font face: %w", err)
+	}
+	return face, nil
+}
+
+// Text はフレームの情報からオーバーレイに表示するテキストを作成します。
+func (o *Overlay) Text(frame FrameInfo) string {
+	var parts []string
+	if o.opts.ShowTime && !frame.Time.IsZero() {
+		parts = append(parts, frame.Time.Format(overlayTimeLayout))
+	}
+	if o.opts.ShowTitle && frame.WindowTitle != "" {
+		parts = append(parts, frame.WindowTitle)
+	}
+	if o.opts.ShowFrame {
+		parts = append(parts, "#"+strconv.Itoa(frame.Frame))
+	}
+	if o.opts.Label != "" {
+		parts = append(parts, o.opts.Label)
+	}
+	return strings.Join(parts, "  ")
+}
+
+// Process はテキストの帯を画像に描き込みます。img が *image.RGBA の場合はその場で書き換えます。
+func (o *Overlay) Process(img image.Image, frame FrameInfo) (image.Image, error) {
+	text := o.Text(frame)
+	if text == "" {
+		return img, nil
+	}
+	dst, ok := img.(*image.RGBA)
+	if !ok {
+		// 撮影した画像以外 (デコードした画像など) は RGBA にコピーしてから描く
+		b := img.Bounds()
+		rgba := image.NewRGBA(b)
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+		dst = rgba
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	bounds := dst.Bounds()
+	metrics := o.face.Metrics()
+	padding := fixed.I(int(o.opts.FontSize/3 + 0.5))
+	textWidth := font.MeasureString(o.face, text)
+	height := (metrics.Ascent + metrics.Descent + padding*2).Ceil()
+	width := (textWidth + padding*2).Ceil()
+
+	// 帯の矩形を位置に応じて決める
+	var band image.Rectangle
+	switch o.opts.Position {
+	case OverlayTop:
+		band = image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Min.Y+height)
+	case OverlayBottom:
+		band = image.Rect(bounds.Min.X, bounds.Max.Y-height, bounds.Max.X, bounds.Max.Y)
+	case OverlayTopLeft:
+		band = image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+width, bounds.Min.Y+height)
+	case OverlayTopRight:
+		band = image.Rect(bounds.Max.X-width, bounds.Min.Y, bounds.Max.X, bounds.Min.Y+height)
+	case OverlayBottomLeft:
+		band = image.Rect(bounds.Min.X, bounds.Max.Y-height, bounds.Min.X+width, bounds.Max.Y)
+	default: // OverlayBottomRight
+		band = image.Rect(bounds.Max.X-width, bounds.Max.Y-height, bounds.Max.X, bounds.Max.Y)
+	}
+	band = band.Intersect(bounds) // 画像より大きい場合ははみ出した部分を描かない
+
+	if o.opts.BackgroundOpacity > 0 {
+		draw.Draw(dst, band, o.bg, image.Point{}, draw.Over)
+	}
+	drawer := font.Drawer{
+		Dst:  dst.SubImage(band).(*image.RGBA), // 帯からはみ出した文字は描かない
+		Src:  o.text,
+		Face: o.face,
+		Dot:  fixed.Point26_6{X: fixed.I(band.Min.X) + padding, Y: fixed.I(band.Min.Y) + padding + metrics.Ascent},
+	}
+	drawer.DrawString(text)
+	return dst, nil
+}
+
+// ParseHexColor は "#RRGGBB" または "#RRGGBBAA" 形式の色を解析します ("#" は省略できます)。
+func ParseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: expected #RRGGBB or #RRGGBBAA", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	if len(hex) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
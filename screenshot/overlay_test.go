@@ -0,0 +1,145 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+// filledRGBA は r の範囲を c で塗りつぶした画像を作成します。
+func filledRGBA(r image.Rectangle, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(r)
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// changedRect は img のうち、色が c から変わったピクセルを囲む矩形を返します。
+func changedRect(img *image.RGBA, c color.RGBA) image.Rectangle {
+	var r image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.RGBAAt(x, y) != c {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestOverlayBandPosition(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	bounds := image.Rect(10, 20, 410, 320) // 原点以外から始まる画像
+	// 背景を不透明にし、文字も同じ色にして帯全体を一色で塗る
+	base := OverlayOptions{Label: "label", TextColor: color.Black, BackgroundColor: color.Black, BackgroundOpacity: 1}
+
+	var band image.Point // 最初の位置で測った帯の大きさ
+	for _, pos := range []OverlayPosition{OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight, OverlayTop, OverlayBottom, ""} {
+		opts := base
+		opts.Position = pos
+		o, err := NewOverlay(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := filledRGBA(bounds, red)
+		out, err := o.Process(img, FrameInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != image.Image(img) {
+			t.Errorf("%q: RGBA image was not drawn in place", pos)
+		}
+		got := changedRect(img, red)
+		if got.Empty() {
+			t.Fatalf("%q: no band was drawn", pos)
+		}
+		if band == (image.Point{}) {
+			band = got.Size()
+			if band.X >= bounds.Dx()/2 || band.Y >= bounds.Dy()/2 {
+				t.Fatalf("%q: band %v is too large for a short label", pos, got)
+			}
+		}
+
+		var want image.Rectangle
+		switch pos {
+		case OverlayTop:
+			want = image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Min.Y+band.Y)
+		case OverlayBottom, "": // 既定は下端
+			want = image.Rect(bounds.Min.X, bounds.Max.Y-band.Y, bounds.Max.X, bounds.Max.Y)
+		case OverlayTopLeft:
+			want = image.Rectangle{Min: bounds.Min, Max: bounds.Min.Add(band)}
+		case OverlayTopRight:
+			want = image.Rect(bounds.Max.X-band.X, bounds.Min.Y, bounds.Max.X, bounds.Min.Y+band.Y)
+		case OverlayBottomLeft:
+			want = image.Rect(bounds.Min.X, bounds.Max.Y-band.Y, bounds.Min.X+band.X, bounds.Max.Y)
+		case OverlayBottomRight:
+			want = image.Rectangle{Min: bounds.Max.Sub(band), Max: bounds.Max}
+		}
+		if got != want {
+			t.Errorf("%q: band = %v, want %v", pos, got, want)
+		}
+		for y := want.Min.Y; y < want.Max.Y; y++ {
+			for x := want.Min.X; x < want.Max.X; x++ {
+				if c := img.RGBAAt(x, y); c != (color.RGBA{0, 0, 0, 0xff}) {
+					t.Fatalf("%q: pixel (%d, %d) in the band = %v, want opaque black", pos, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func TestOverlayClipsToBounds(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	for _, pos := range []OverlayPosition{OverlayTop, OverlayBottom, OverlayTopLeft, OverlayTopRight, OverlayBottomLeft, OverlayBottomRight} {
+		o, err := NewOverlay(OverlayOptions{
+			ShowTime: true, ShowTitle: true, ShowFrame: true, Label: "a label that is much wider than the image",
+			Position: pos, FontSize: 24, BackgroundOpacity: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 大きな画像の一部分 (撮影範囲を切り出した画像) に、その部分より大きな帯を描く
+		parent := filledRGBA(image.Rect(0, 0, 60, 40), red)
+		sub := parent.SubImage(image.Rect(20, 10, 40, 20)).(*image.RGBA)
+		frame := FrameInfo{Time: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), WindowTitle: "window", Frame: 7}
+		if _, err := o.Process(sub, frame); err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 40; y++ {
+			for x := 0; x < 60; x++ {
+				c := parent.RGBAAt(x, y)
+				if image.Pt(x, y).In(sub.Rect) {
+					// 部分画像は帯の背景か文字で塗りつぶされる
+					if c == red {
+						t.Fatalf("%s: pixel (%d, %d) inside the image was not covered by the band", pos, x, y)
+					}
+					if c.A != 0xff || (c != white && c.R != c.G) {
+						t.Fatalf("%s: pixel (%d, %d) inside the image = %v, want the band color", pos, x, y, c)
+					}
+				} else if c != red {
+					t.Fatalf("%s: pixel (%d, %d) outside the image was changed to %v", pos, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func TestOverlayEmptyText(t *testing.T) {
+	o, err := NewOverlay(OverlayOptions{ShowTitle: true, BackgroundOpacity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	img := filledRGBA(image.Rect(0, 0, 50, 50), red)
+	if _, err := o.Process(img, FrameInfo{}); err != nil { // タイトルがなければ何も描かない
+		t.Fatal(err)
+	}
+	if r := changedRect(img, red); !r.Empty() {
+		t.Errorf("band drawn at %v for an empty text", r)
+	}
+}
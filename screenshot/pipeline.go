@@ -0,0 +1,205 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy はキューが一杯のときに新しいフレームをどう扱うかです。値は config.PipelineSetting.DropPolicy にそのまま保存されます。
+type DropPolicy string
+
+const (
+	DropOldest DropPolicy = "drop_oldest" // キューの最も古いフレームを捨てて新しいフレームを入れる
+	DropNewest DropPolicy = "drop_newest" // 新しいフレームを捨てる
+	DropBlock  DropPolicy = "block"       // キューに空きができるまで撮影側を待たせる (フレームは失われない)
+)
+
+// Job は保存を待つ 1 フレームです。
+// Image はパイプラインが所有し、FrameProcessor がその場で書き換えることがあるため、他と共有している画像を渡してはいけません。
+type Job struct {
+	Image image.Image
+	Frame FrameInfo
+}
+
+// PipelineOptions は Pipeline の設定です。
+type PipelineOptions struct {
+	Workers   int        // エンコードと書き込みを行うゴルーチンの数 (0 以下の場合は 1)
+	QueueSize int        // 保存を待つフレームの最大数 (0 以下の場合は 1)
+	Drop      DropPolicy // キューが一杯のときの動作 (空の場合は DropBlock)
+
+	SaveDir  string
+	Template string  // ファイル名のテンプレート (SaveScreenshot を参照)
+	Encoder  Encoder // 複数のワーカーから同時に使用されます
+
+	// Processors は保存の前に順に適用する処理です (オーバーレイなど)。複数のワーカーから同時に使用されます。
+	Processors []FrameProcessor
+
+	// OnSaved は各フレームの保存が終わるたびに (失敗した場合も) ワーカーのゴルーチンから呼び出されます。
+	// その時点で job.Image は解放済みのため、画像の情報は saved を参照してください。
+	OnSaved func(job Job, saved SavedFile, err error)
+}
+
+// FrameProcessor は保存の前にフレームを加工する処理です。
+type FrameProcessor interface {
+	// Process は加工した画像を返します。img が書き換え可能な画像 (*image.RGBA など) の場合は、
+	// その場で書き換えて img をそのまま返してもかまいません。
+	Process(img image.Image, frame FrameInfo) (image.Image, error)
+}
+
+// PipelineStats は Pipeline の統計です。
+type PipelineStats struct {
+	QueueDepth int // 現在保存を待っているフレームの数
+	Saved      int // 保存したフレームの数
+	Failed     int // 保存に失敗したフレームの数
+	Dropped    int // キューが一杯だったため (または空きを待つ間に停止されたため) 捨てたフレームの数
+}
+
+// Pipeline は撮影したフレームのエンコードと書き込みを、撮影とは別のゴルーチンで行います。
+// 撮影側は Submit でフレームを有限長のキューに入れるだけなので、エンコードが遅くても撮影の間隔が乱れません。
+type Pipeline struct {
+	opts  PipelineOptions
+	queue chan Job
+	wg    sync.WaitGroup
+
+	closeOnce sync.Once
+	saved     atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+}
+
+// NewPipeline はワーカーを起動してパイプラインを作成します。使用後は必ず Close を呼び出してください。
+func NewPipeline(opts PipelineOptions) (*Pipeline, error) {
+	switch opts.Drop {
+	case "":
+		opts.Drop = DropBlock
+	case DropOldest, DropNewest, DropBlock:
+	default:
+		return nil, fmt.Errorf("unknown drop policy %q", opts.Drop)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1
+	}
+
+	p := &Pipeline{
+		opts:  opts,
+		queue: make(chan Job, opts.QueueSize),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+	return p, nil
+}
+
+// Submit はフレームを保存のキューに入れます。フレームを受け付けた場合は true を返します。
+// キューが一杯の場合は DropPolicy に従い、捨てたフレームの画像は ReleaseImage で解放します。
+// DropBlock で空きを待っている間に ctx が終了した場合も、フレームを捨てて false を返します。
+// Close の後に呼び出してはいけません。
+func (p *Pipeline) Submit(ctx context.Context, job Job) bool {
+	switch p.opts.Drop {
+	case DropBlock:
+		select {
+		case p.queue <- job:
+			return true
+		case <-ctx.Done():
+			p.drop(job)
+			return false
+		}
+	case DropNewest:
+		select {
+		case p.queue <- job:
+			return true
+		default:
+			p.drop(job)
+			return false
+		}
+	default: // DropOldest
+		for {
+			select {
+			case p.queue <- job:
+				return true
+			default:
+			}
+			// 最も古いフレームを 1 つ取り出して捨て、もう一度入れ直す
+			select {
+			case old := <-p.queue:
+				p.drop(old)
+			default: // その間にワーカーが取り出した
+			}
+		}
+	}
+}
+
+// drop はフレームを捨てて統計に記録します。
+func (p *Pipeline) drop(job Job) {
+	ReleaseImage(job.Image)
+	p.dropped.Add(1)
+}
+
+// Close は新しいフレームの受け付けを終了し、キューに残っているフレームをすべて保存してから戻ります。
+func (p *Pipeline) Close() {
+	p.closeOnce.Do(func() {
+		close(p.queue)
+	})
+	p.wg.Wait()
+}
+
+// Stats は現在の統計を返します。
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		QueueDepth: len(p.queue),
+		Saved:      int(p.saved.Load()),
+		Failed:     int(p.failed.Load()),
+		Dropped:    int(p.dropped.Load()),
+	}
+}
+
+// worker はキューからフレームを取り出してエンコードし、ファイルに書き込みます。
+func (p *Pipeline) worker() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		if job.Frame.OriginalSize == (image.Point{}) {
+			job.Frame.OriginalSize = job.Image.Bounds().Size()
+			job.Frame.Offset = job.Image.Bounds().Min
+		}
+		img, err := p.process(job)
+		var saved SavedFile
+		if err == nil {
+			saved, err = SaveScreenshot(img, p.opts.SaveDir, p.opts.Template, job.Frame, p.opts.Encoder)
+		}
+		ReleaseImage(img) // 保存後はバッファを次の撮影で再利用する
+		if err != nil {
+			p.failed.Add(1)
+		} else {
+			p.saved.Add(1)
+		}
+		if p.opts.OnSaved != nil {
+			p.opts.OnSaved(job, saved, err)
+		}
+	}
+}
+
+// process はフレームに Processors を順に適用します。
+// 途中で新しい画像に置き換わった場合は、元の画像をその時点で解放します。
+func (p *Pipeline) process(job Job) (image.Image, error) {
+	img := job.Image
+	for _, proc := range p.opts.Processors {
+		out, err := proc.Process(img, job.Frame)
+		if err != nil {
+			return img, fmt.Errorf("failed to process frame %d: %w", job.Frame.Frame, err)
+		}
+		if out != img {
+			ReleaseImage(img)
+			img = out
+		}
+	}
+	return img, nil
+}
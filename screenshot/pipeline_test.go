@@ -0,0 +1,165 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingEncoder は release が閉じられるまで Encode を止める Encoder です。
+// Encode を始めるたびに started に通知します。
+type blockingEncoder struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingEncoder() *blockingEncoder {
+	return &blockingEncoder{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (e *blockingEncoder) Extension() string { return ".png" }
+
+func (e *blockingEncoder) Encode(w io.Writer, img image.Image) error {
+	e.started <- struct{}{}
+	<-e.release
+	return png.Encode(w, img)
+}
+
+// copyProcessor はフレームをプールの新しい画像に複製して返す FrameProcessor です (置き換えられた画像の解放を確認するため)。
+type copyProcessor struct {
+	mu     sync.Mutex
+	copies []*image.RGBA
+}
+
+func (p *copyProcessor) Process(img image.Image, frame FrameInfo) (image.Image, error) {
+	b := img.Bounds()
+	out := newPooledRGBA(b.Dx(), b.Dy())
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	p.mu.Lock()
+	p.copies = append(p.copies, out)
+	p.mu.Unlock()
+	return out, nil
+}
+
+func TestPipelineDropPolicies(t *testing.T) {
+	tests := []struct {
+		drop       DropPolicy
+		cancel     bool  // DropBlock で空きを待つ間に停止する
+		accepted   bool  // 4 つ目のフレームが受け付けられるか
+		dropped    int   // 捨てたフレーム
+		savedOrder []int // 保存したフレームの番号
+	}{
+		{DropNewest, false, false, 3, []int{0, 1, 2}},
+		{DropOldest, false, true, 1, []int{0, 2, 3}}, // 最も新しいフレームが残る
+		{DropBlock, true, false, 3, []int{0, 1, 2}},
+		{DropBlock, false, true, -1, []int{0, 1, 2, 3}}, // 空きができるまで待つ
+	}
+	for _, tt := range tests {
+		name := string(tt.drop)
+		if tt.cancel {
+			name += " (cancelled)"
+		}
+		frames := make([]image.Image, 4)
+		for i := range frames {
+			frames[i] = newPooledRGBA(4, 4)
+		}
+		fake := NewFakeCapturer(&FakeWindow{Info: WindowInfo{HWND: 1, Title: "window"}, Frames: frames})
+		encoder := newBlockingEncoder()
+		processor := &copyProcessor{}
+		var mu sync.Mutex
+		var saved []int
+		p, err := NewPipeline(PipelineOptions{
+			QueueSize:  2,
+			Drop:       tt.drop,
+			SaveDir:    t.TempDir(),
+			Template:   "frame_{frame}",
+			Encoder:    encoder,
+			Processors: []FrameProcessor{processor},
+			OnSaved: func(job Job, s SavedFile, err error) {
+				if err != nil {
+					t.Errorf("%s: frame %d: %v", name, job.Frame.Frame, err)
+				}
+				mu.Lock()
+				saved = append(saved, job.Frame.Frame)
+				mu.Unlock()
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		submit := func(ctx context.Context, i int) bool {
+			img, err := Capture(fake, Target{HWND: 1})
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			return p.Submit(ctx, Job{Image: img, Frame: FrameInfo{Frame: i}})
+		}
+
+		// 1 つ目のフレームのエンコード中に、キューを一杯にする
+		submit(context.Background(), 0)
+		<-encoder.started
+		for i := 1; i <= 2; i++ {
+			if !submit(context.Background(), i) {
+				t.Fatalf("%s: frame %d was not accepted", name, i)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan bool, 1)
+		go func() { result <- submit(ctx, 3) }()
+		if tt.drop == DropBlock {
+			select {
+			case <-result:
+				t.Fatalf("%s: Submit returned while the queue was full", name)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if tt.cancel {
+				cancel()
+			} else {
+				close(encoder.release)
+			}
+		}
+		if got := <-result; got != tt.accepted {
+			t.Errorf("%s: Submit = %v, want %v", name, got, tt.accepted)
+		}
+		cancel()
+		if tt.dropped >= 0 {
+			if got := p.Stats().Dropped; got != 1 {
+				t.Errorf("%s: Dropped = %d, want 1", name, got)
+			}
+			if img := frames[tt.dropped].(*image.RGBA); img.Pix != nil {
+				t.Errorf("%s: dropped frame %d was not released", name, tt.dropped)
+			}
+			close(encoder.release)
+		}
+
+		// Close はキューに残っているフレームをすべて保存してから戻る
+		p.Close()
+		stats := p.Stats()
+		if stats.QueueDepth != 0 || stats.Saved != len(tt.savedOrder) || stats.Failed != 0 {
+			t.Errorf("%s: stats after Close = %+v, want %d saved", name, stats, len(tt.savedOrder))
+		}
+		if !slices.Equal(saved, tt.savedOrder) {
+			t.Errorf("%s: saved frames %v, want %v", name, saved, tt.savedOrder)
+		}
+		// 保存したフレームも、処理で置き換えられた元の画像も解放されている
+		for i, frame := range frames {
+			if frame.(*image.RGBA).Pix != nil {
+				t.Errorf("%s: frame %d was not released", name, i)
+			}
+		}
+		for i, c := range processor.copies {
+			if c.Pix != nil {
+				t.Errorf("%s: processed copy %d was not released", name, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"image"
+	"image/png"
+	"runtime"
+	"sync"
+	"weak"
+)
+
+// pixelPools は画像のバイト数ごとにピクセルバッファを再利用するためのプールです (map[int]*sync.Pool)。
+// 同じウィンドウを一定間隔で撮影する場合、毎回同じサイズのバッファが必要になるため、
+// 撮影ごとの大きな割り当てと GC の負荷を避けられます。
+var pixelPools sync.Map
+
+// pooledImages は newPooledRGBA が作成し、まだ解放されていない画像の集合です (map[weak.Pointer[image.RGBA]]struct{})。
+// ReleaseImage がプール由来でない画像 (デコードした画像やテスト用の画像など) のバッファを奪わないようにします。
+// 弱いポインタで記録するため、ReleaseImage が呼ばれなかった画像も通常どおり GC で回収され、
+// 回収時にその記録も削除されます (バッファはプールに戻りません)。
+var pooledImages sync.Map
+
+// getPixelBuffer は長さ n のピクセルバッファをプールから取得します (内容は不定です)。
+func getPixelBuffer(n int) []byte {
+	if p, ok := pixelPools.Load(n); ok {
+		if buf, ok := p.(*sync.Pool).Get().(*[]byte); ok {
+			return *buf
+		}
+	}
+	return make([]byte, n)
+}
+
+// putPixelBuffer はピクセルバッファをプールに戻します。
+func putPixelBuffer(buf []byte) {
+	n := len(buf)
+	p, _ := pixelPools.LoadOrStore(n, &sync.Pool{})
+	p.(*sync.Pool).Put(&buf)
+}
+
+// newPooledRGBA はプールから取得したバッファを使用する image.RGBA を作成します。
+// 使用後は ReleaseImage でバッファをプールに戻してください。
+func newPooledRGBA(width, height int) *image.RGBA {
+	img := &image.RGBA{
+		Pix:    getPixelBuffer(width * height * 4),
+		Stride: width * 4,
+		Rect:   image.Rect(0, 0, width, height),
+	}
+	key := weak.Make(img)
+	pooledImages.Store(key, struct{}{})
+	runtime.AddCleanup(img, func(key weak.Pointer[image.RGBA]) { pooledImages.Delete(key) }, key)
+	return img
+}
+
+// ReleaseImage は撮影した画像のピクセルバッファを次の撮影で再利用できるようプールに戻します。
+// 画像を保存し終わり、以後参照しない場合にのみ呼び出してください。
+// プール由来でない画像に対しては何もしません。
+// 誤って再利用した場合に気付けるよう、解放後の画像のピクセルは空になります。
+func ReleaseImage(img image.Image) {
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		return
+	}
+	if _, pooled := pooledImages.LoadAndDelete(weak.Make(rgba)); !pooled {
+		return
+	}
+	putPixelBuffer(rgba.Pix)
+	rgba.Pix = nil
+}
+
+// bgraToImage はプールから取得した image.RGBA のピクセルバッファに read で BGRA のピクセルを書き込ませ、
+// 同じバッファ内で B と R を入れ替えて RGBA にします (GetDIBits などが返すトップダウンの 32 ビット DIB 用)。
+// 別のバッファへのコピーを避けつつ、PNG エンコーダーの image.RGBA 向けの高速な処理を利用できます。
+// read がエラーを返した場合は、バッファをプールに戻してそのエラーを返します。
+func bgraToImage(width, height int, read func(pix []byte) error) (*image.RGBA, error) {
+	img := newPooledRGBA(width, height)
+	if err := read(img.Pix); err != nil {
+		ReleaseImage(img)
+		return nil, err
+	}
+	swapRedBlue(img.Pix)
+	return img, nil
+}
+
+// swapRedBlue は BGRA のピクセル列をその場で RGBA に並べ替えます (逆も同様)。
+func swapRedBlue(pix []byte) {
+	for i := 0; i+3 < len(pix); i += 4 {
+		pix[i], pix[i+2] = pix[i+2], pix[i]
+	}
+}
+
+// EncoderBufferPool は png.Encoder の作業バッファ (圧縮器やスキャンラインのバッファ) を再利用するプールです。
+// png.Encoder.BufferPool に設定すると、フレームごとの圧縮器の割り当てを避けられます。
+// 複数のゴルーチンから同時に使用できます。
+type EncoderBufferPool struct {
+	pool sync.Pool
+}
+
+// Get はプールから作業バッファを取得します。プールが空の場合は nil を返し、png.Encoder が新しく割り当てます。
+func (p *EncoderBufferPool) Get() *png.EncoderBuffer {
+	buf, _ := p.pool.Get().(*png.EncoderBuffer)
+	return buf
+}
+
+// Put は作業バッファをプールに戻します。
+func (p *EncoderBufferPool) Put(buf *png.EncoderBuffer) {
+	p.pool.Put(buf)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"runtime"
+	"testing"
+	"time"
+	"weak"
+)
+
+// bgraFrame は GetDIBits が書き込むのと同じ形式 (トップダウン、BGRA) のテスト用のピクセルを作成します。
+func bgraFrame(width, height int) []byte {
+	pix := make([]byte, width*height*4)
+	for i := 0; i < len(pix); i += 4 {
+		p := i / 4
+		pix[i] = byte(p)        // B
+		pix[i+1] = byte(p >> 8) // G
+		pix[i+2] = byte(p >> 3) // R
+		pix[i+3] = byte(p >> 5) // A
+	}
+	return pix
+}
+
+// bitmapToImageAlloc は変更前の bitmapToImage と同じく、撮影ごとにバッファと画像を割り当て、
+// ピクセルごとに BGRA から RGBA に並べ替えます (ベンチマークの比較対象)。
+func bitmapToImageAlloc(src []byte, width, height int) *image.RGBA {
+	pixelData := make([]byte, width*height*4)
+	copy(pixelData, src) // GetDIBits による書き込みの代わり
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := (y*width + x) * 4
+			img.Pix[idx] = pixelData[idx+2]
+			img.Pix[idx+1] = pixelData[idx+1]
+			img.Pix[idx+2] = pixelData[idx]
+			img.Pix[idx+3] = pixelData[idx+3]
+		}
+	}
+	return img
+}
+
+func TestBGRAToImage(t *testing.T) {
+	const width, height = 7, 3 // 行の長さが 4 の倍数でない大きさも確認する
+	src := bgraFrame(width, height)
+
+	img, err := bgraToImage(width, height, func(pix []byte) error {
+		copy(pix, src)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReleaseImage(img)
+	if img.Bounds() != image.Rect(0, 0, width, height) {
+		t.Fatalf("bounds = %v", img.Bounds())
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := (y*width + x) * 4
+			want := color.RGBA{R: src[i+2], G: src[i+1], B: src[i], A: src[i+3]}
+			if got := img.RGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	// 変更前の実装と同じ結果になる
+	want := bitmapToImageAlloc(src, width, height)
+	if string(want.Pix) != string(img.Pix) {
+		t.Error("result differs from the allocate-and-swizzle conversion")
+	}
+}
+
+func TestBGRAToImageError(t *testing.T) {
+	readErr := errors.New("GetDIBits failed")
+	img, err := bgraToImage(4, 4, func(pix []byte) error { return readErr })
+	if !errors.Is(err, readErr) || img != nil {
+		t.Fatalf("got %v, %v; want the read error", img, err)
+	}
+}
+
+func TestReleaseImage(t *testing.T) {
+	img := newPooledRGBA(4, 4)
+	ReleaseImage(img)
+	if img.Pix != nil {
+		t.Error("released image still references the pooled buffer")
+	}
+	ReleaseImage(img) // 2 回目は何もしない
+
+	// プール由来でない画像のバッファは奪わない
+	own := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	ReleaseImage(own)
+	if own.Pix == nil {
+		t.Error("ReleaseImage took the buffer of an image that is not pooled")
+	}
+}
+
+func TestUnreleasedImageIsCollected(t *testing.T) {
+	// ReleaseImage を呼ばなかった画像も、参照がなくなれば GC で回収され、記録も削除される
+	var keys []weak.Pointer[image.RGBA]
+	for i := 0; i < 8; i++ {
+		keys = append(keys, weak.Make(newPooledRGBA(64, 64)))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runtime.GC()
+		remaining := 0
+		for _, key := range keys {
+			if _, ok := pooledImages.Load(key); ok {
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d unreleased images are still registered", remaining)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, key := range keys {
+		if key.Value() != nil {
+			t.Error("unreleased image was not collected")
+		}
+	}
+}
+
+// BenchmarkBitmapToImage は 4K のフレームで、プールのバッファとその場での並べ替え (pooled) と
+// 撮影ごとの割り当てとピクセルごとのコピー (alloc) を比較します。
+// pooled は保存後と同じく ReleaseImage でバッファを戻すため、定常状態ではフレームごとの大きな割り当てがありません。
+func BenchmarkBitmapToImage(b *testing.B) {
+	const width, height = 3840, 2160
+	src := bgraFrame(width, height)
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src)))
+		for i := 0; i < b.N; i++ {
+			img, err := bgraToImage(width, height, func(pix []byte) error {
+				copy(pix, src)
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			ReleaseImage(img)
+		}
+	})
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src)))
+		for i := 0; i < b.N; i++ {
+			bitmapToImageAlloc(src, width, height)
+		}
+	})
+}
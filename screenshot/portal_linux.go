@@ -0,0 +1,296 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png" // ポータルが保存する PNG をデコードするため
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// xdg-desktop-portal の D-Bus 名とインターフェース
+const (
+	portalBusName          = "org.freedesktop.portal.Desktop"
+	portalObjectPath       = "/org/freedesktop/portal/desktop"
+	portalScreenshotMethod = "org.freedesktop.portal.Screenshot.Screenshot"
+	portalRequestInterface = "org.freedesktop.portal.Request"
+	portalSessionInterface = "org.freedesktop.portal.Session"
+)
+
+// PortalScreenHWND はポータルバックエンドが返す唯一の撮影対象 (画面全体) の HWND です。
+// Wayland ではクライアントが他のウィンドウを列挙できないため、画面全体を 1 つのウィンドウとして扱います。
+const PortalScreenHWND HWND = 1
+
+// DefaultPortalTimeout はポータルの応答を待つ既定の時間です。
+// 初回はユーザーの許可ダイアログが表示されるため、長めに設定しています。
+const DefaultPortalTimeout = 2 * time.Minute
+
+// ErrPortalCancelled はユーザーがポータルの許可ダイアログをキャンセルした場合に返されます。
+var ErrPortalCancelled = errors.New("screenshot: portal request was cancelled by the user")
+
+// PortalCapturer は xdg-desktop-portal を D-Bus 経由で呼び出す Capturer の実装です。
+// Wayland セッションでは X11 による撮影ができないため、このバックエンドを使用します。
+//
+// Grab が設定されている場合は ScreenCast API のセッションを開き、PipeWire のストリームからフレームを取得します。
+// セッションは persist_mode=2 で開始し、ポータルが返す復元トークンを次回のセッションに渡すことで、
+// インターバル撮影やアプリケーションの再起動のたびに許可を求められることを防ぎます。
+// ScreenCast API が利用できない場合は Screenshot API で撮影します
+// (Screenshot API には許可を保存する仕組みがないため、確認のダイアログが表示されるかどうかはデスクトップ環境によります)。
+type PortalCapturer struct {
+	conn        *dbus.Conn
+	destination string // ポータルのバス名 (テスト用の代替ポータルに差し替え可能)
+	Timeout     time.Duration
+
+	// Grab は ScreenCast のストリームからフレームを取得する関数です。nil の場合は Screenshot API のみを使用します。
+	Grab FrameGrabber
+
+	mu             sync.Mutex // ポータルへの要求を 1 つずつ処理する
+	restoreToken   string
+	onRestoreToken func(token string)
+	session        dbus.ObjectPath // 開いている ScreenCast のセッション
+	node           uint32          // セッションのストリームの PipeWire ノード ID
+	noScreenCast   bool            // ポータルが ScreenCast API を提供していない
+}
+
+// NewPortalCapturer はセッションバスに接続し、ポータルバックエンドを作成します。
+func NewPortalCapturer() (*PortalCapturer, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	return NewPortalCapturerWithConn(conn, portalBusName), nil
+}
+
+// NewPortalCapturerWithConn は既存の D-Bus 接続と宛先名を使用してポータルバックエンドを作成します。
+// プライベートなセッションバス上の代替ポータルに対して動作を確認する場合に使用します。
+func NewPortalCapturerWithConn(conn *dbus.Conn, destination string) *PortalCapturer {
+	return &PortalCapturer{
+		conn:        conn,
+		destination: destination,
+		Timeout:     DefaultPortalTimeout,
+		Grab:        defaultFrameGrabber(),
+	}
+}
+
+// Close は ScreenCast のセッションと D-Bus 接続を閉じます。
+func (c *PortalCapturer) Close() error {
+	c.mu.Lock()
+	c.closeSession()
+	c.mu.Unlock()
+	return c.conn.Close()
+}
+
+// RestoreToken は最後にポータルから受け取った復元トークンを返します。
+func (c *PortalCapturer) RestoreToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.restoreToken
+}
+
+// SetRestoreToken は以前に保存した復元トークンを設定します。次に開く ScreenCast のセッションで使用します。
+func (c *PortalCapturer) SetRestoreToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.restoreToken = token
+}
+
+// OnRestoreToken はポータルから新しい復元トークンを受け取ったときに呼び出す関数を設定します。
+// fn は撮影中のゴルーチンから呼び出されるため、fn の中で PortalCapturer のメソッドを呼び出さないでください。
+func (c *PortalCapturer) OnRestoreToken(fn func(token string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRestoreToken = fn
+}
+
+// ListWindows は画面全体を表す 1 つのウィンドウを返します。
+func (c *PortalCapturer) ListWindows() ([]WindowInfo, error) {
+	return []WindowInfo{{HWND: PortalScreenHWND, Title: "Screen (xdg-desktop-portal)"}}, nil
+}
+
+// WindowTitle は画面全体を表すウィンドウのタイトルを返します。
+func (c *PortalCapturer) WindowTitle(hwnd HWND) (string, error) {
+	if hwnd != PortalScreenHWND {
+		return "", fmt.Errorf("portal backend has no window %d", hwnd)
+	}
+	return "Screen (xdg-desktop-portal)", nil
+}
+
+// CaptureWindow はポータルから画面全体の画像を取得し、image.Imageとして返します。
+func (c *PortalCapturer) CaptureWindow(hwnd HWND) (image.Image, error) {
+	if hwnd != PortalScreenHWND {
+		return nil, fmt.Errorf("portal backend has no window %d", hwnd)
+	}
+
+	// 同時に複数の要求を出すと許可ダイアログが重なるため、要求は 1 つずつ処理する
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Grab != nil && !c.noScreenCast {
+		img, err := c.captureScreenCast()
+		if !errors.Is(err, errScreenCastUnavailable) {
+			return img, err
+		}
+		log.Printf("ScreenCast portal is not available, falling back to the Screenshot portal: %v", err)
+		c.noScreenCast = true
+	}
+	return c.captureScreenshot()
+}
+
+// captureScreenshot は Screenshot API で画面を撮影します。
+// ポータルが保存したファイルは利用者の画像フォルダにあることもあるため、読み込むだけで削除しません。
+// 呼び出し側で mu を保持している必要があります。
+func (c *PortalCapturer) captureScreenshot() (image.Image, error) {
+	options := map[string]dbus.Variant{
+		// 範囲選択などの対話的な UI を表示せずに撮影する
+		"interactive": dbus.MakeVariant(false),
+	}
+
+	results, err := c.request(portalScreenshotMethod, options, "")
+	if err != nil {
+		return nil, err
+	}
+
+	uriVariant, ok := results["uri"]
+	if !ok {
+		return nil, errors.New("portal response has no uri")
+	}
+	uri, _ := uriVariant.Value().(string)
+	path, err := portalURIToPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open portal screenshot %s: %w", path, err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode portal screenshot %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// ListMonitors は画面全体を 1 つのモニターとして返します。
+// ポータルは画面の構成を公開しないため、Bounds は空になります。
+func (c *PortalCapturer) ListMonitors() ([]MonitorInfo, error) {
+	return []MonitorInfo{{Index: 0, Name: "Screen (xdg-desktop-portal)", Primary: true}}, nil
+}
+
+// CaptureRect は画面全体を撮影し、指定された領域を切り出します。
+// rect が空の場合は画面全体を返します。
+func (c *PortalCapturer) CaptureRect(rect image.Rectangle) (image.Image, error) {
+	img, err := c.CaptureWindow(PortalScreenHWND)
+	if err != nil {
+		return nil, err
+	}
+	if rect.Empty() {
+		return img, nil
+	}
+	if rect.Intersect(img.Bounds()).Empty() {
+		return nil, fmt.Errorf("capture rect %v is outside the screen %v", rect, img.Bounds())
+	}
+	return cropImage(img, rect), nil
+}
+
+// request はポータルのメソッドを args と options を引数として呼び出し、Request オブジェクトの Response シグナルを待ちます。
+// 呼び出し側で mu を保持している必要があります。
+func (c *PortalCapturer) request(method string, options map[string]dbus.Variant, args ...any) (map[string]dbus.Variant, error) {
+	token, err := newPortalHandleToken()
+	if err != nil {
+		return nil, err
+	}
+	options["handle_token"] = dbus.MakeVariant(token)
+
+	// 競合を避けるため、メソッド呼び出しの前に Response シグナルを購読する
+	// (Request オブジェクトのパスは送信者名と handle_token から決まる)
+	expected := portalRequestPath(c.conn.Names()[0], token)
+	matchOpts := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(expected),
+		dbus.WithMatchInterface(portalRequestInterface),
+		dbus.WithMatchMember("Response"),
+	}
+	if err := c.conn.AddMatchSignal(matchOpts...); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to portal response: %w", err)
+	}
+	defer c.conn.RemoveMatchSignal(matchOpts...)
+
+	signals := make(chan *dbus.Signal, 4)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	var handle dbus.ObjectPath
+	obj := c.conn.Object(c.destination, portalObjectPath)
+	if err := obj.Call(method, 0, append(args, options)...).Store(&handle); err != nil {
+		return nil, fmt.Errorf("portal call %s failed: %w", method, err)
+	}
+
+	timeout := time.NewTimer(c.Timeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case sig, ok := <-signals:
+			if !ok {
+				return nil, errors.New("D-Bus connection closed while waiting for portal response")
+			}
+			// 古いポータル実装は予測と異なるパスを返すことがあるため、返されたハンドルも受け付ける
+			if sig.Path != expected && sig.Path != handle {
+				continue
+			}
+			if sig.Name != portalRequestInterface+".Response" || len(sig.Body) < 2 {
+				continue
+			}
+			code, _ := sig.Body[0].(uint32)
+			results, _ := sig.Body[1].(map[string]dbus.Variant)
+			switch code {
+			case 0:
+				return results, nil
+			case 1:
+				return nil, ErrPortalCancelled
+			default:
+				return nil, fmt.Errorf("portal request %s failed (response %d)", method, code)
+			}
+		case <-timeout.C:
+			return nil, fmt.Errorf("timed out waiting for portal response to %s", method)
+		}
+	}
+}
+
+// portalRequestPath は送信者の一意名と handle_token から Request オブジェクトのパスを求めます。
+func portalRequestPath(uniqueName, token string) dbus.ObjectPath {
+	sender := strings.ReplaceAll(strings.TrimPrefix(uniqueName, ":"), ".", "_")
+	return dbus.ObjectPath(portalObjectPath + "/request/" + sender + "/" + token)
+}
+
+// newPortalHandleToken は Request オブジェクトのパスに使用するランダムなトークンを生成します。
+func newPortalHandleToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate portal handle token: %w", err)
+	}
+	return "myscreenshot_" + hex.EncodeToString(b), nil
+}
+
+// portalURIToPath はポータルが返す file:// URI をローカルのパスに変換します。
+func portalURIToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid portal uri %q: %w", uri, err)
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported portal uri scheme %q", u.Scheme)
+	}
+	return u.Path, nil
+}
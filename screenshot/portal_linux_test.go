@@ -0,0 +1,458 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// testPortalName はテスト用の代替ポータルのバス名です。
+const testPortalName = "org.freedesktop.portal.Desktop.Test"
+
+// privateBusConfig はテスト専用の dbus-daemon の設定です。%s はソケットのパスに置き換えます。
+const privateBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startPrivateBus はテスト専用の dbus-daemon を起動し、そのアドレスを返します。
+// dbus-daemon がインストールされていない場合はテストをスキップします。
+func startPrivateBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "bus.conf")
+	config := strings.Replace(privateBusConfig, "%s", filepath.Join(dir, "bus"), 1)
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+configPath, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read the bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// fakeScreenshotPortal は org.freedesktop.portal.Screenshot の代替実装です。
+// Screenshot が呼び出されると、Request オブジェクトの Response シグナルで結果を返します。
+type fakeScreenshotPortal struct {
+	conn *dbus.Conn
+
+	mu       sync.Mutex
+	response uint32           // 返す応答コード (0: 成功, 1: キャンセル)
+	image    image.Image      // 成功時に PNG で保存して URI を返す画像
+	dir      string           // 画像を保存するディレクトリ
+	calls    []map[string]any // 受け取ったオプション
+	saved    []string         // 保存した画像のパス
+}
+
+// Screenshot は xdg-desktop-portal の Screenshot メソッドです。
+func (p *fakeScreenshotPortal) Screenshot(sender dbus.Sender, parentWindow string, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	received := make(map[string]any, len(options))
+	for k, v := range options {
+		received[k] = v.Value()
+	}
+	p.calls = append(p.calls, received)
+	token, _ := received["handle_token"].(string)
+	handle := portalRequestPath(string(sender), token)
+
+	results := map[string]dbus.Variant{}
+	if p.response == 0 {
+		path := filepath.Join(p.dir, "portal-screenshot.png")
+		f, err := os.Create(path)
+		if err != nil {
+			return "", dbus.MakeFailedError(err)
+		}
+		err = png.Encode(f, p.image)
+		f.Close()
+		if err != nil {
+			return "", dbus.MakeFailedError(err)
+		}
+		p.saved = append(p.saved, path)
+		results["uri"] = dbus.MakeVariant("file://" + path)
+	}
+	// 呼び出し元は呼び出しの前に Response を購読しているため、応答より先にシグナルを送ってよい
+	if err := p.conn.Emit(handle, portalRequestInterface+".Response", p.response, results); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return handle, nil
+}
+
+// startFakePortal はプライベートなバスに、response と img を返す代替ポータルを登録し、それに接続した PortalCapturer を返します。
+// 代替ポータルは Screenshot API のみを提供します。
+func startFakePortal(t *testing.T, response uint32, img image.Image) (*fakeScreenshotPortal, *PortalCapturer) {
+	t.Helper()
+	address := startPrivateBus(t)
+	serverConn := ownTestPortal(t, address)
+	portal := &fakeScreenshotPortal{conn: serverConn, response: response, image: img, dir: t.TempDir()}
+	if err := serverConn.Export(portal, portalObjectPath, "org.freedesktop.portal.Screenshot"); err != nil {
+		t.Fatal(err)
+	}
+	return portal, connectTestPortal(t, address)
+}
+
+// ownTestPortal はプライベートなバスに接続し、代替ポータルのバス名を取得します。
+func ownTestPortal(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	serverConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("failed to connect to the private bus: %v", err)
+	}
+	t.Cleanup(func() { serverConn.Close() })
+	if reply, err := serverConn.RequestName(testPortalName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v (reply %d)", testPortalName, err, reply)
+	}
+	return serverConn
+}
+
+// connectTestPortal は代替ポータルに接続した PortalCapturer を作成します。
+// Grab は nil にするため、ScreenCast API を使用するテストでは設定し直す必要があります。
+func connectTestPortal(t *testing.T, address string) *PortalCapturer {
+	t.Helper()
+	clientConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("failed to connect to the private bus: %v", err)
+	}
+	capturer := NewPortalCapturerWithConn(clientConn, testPortalName)
+	capturer.Timeout = 10 * time.Second
+	capturer.Grab = nil
+	t.Cleanup(func() { capturer.Close() })
+	return capturer
+}
+
+func TestPortalCaptureWindow(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for i := range src.Pix {
+		src.Pix[i] = 0xFF
+	}
+	src.Set(3, 2, color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF})
+	portal, capturer := startFakePortal(t, 0, src)
+	// ポータルが ScreenCast API を提供していない場合は Screenshot API で撮影する
+	capturer.Grab = func(remote *os.File, node uint32) (image.Image, error) {
+		t.Error("Grab was called without a ScreenCast session")
+		return nil, errors.New("unexpected grab")
+	}
+
+	// 撮影のたびにポータルに要求する
+	for i := 0; i < 2; i++ {
+		img, err := capturer.CaptureWindow(PortalScreenHWND)
+		if err != nil {
+			t.Fatalf("capture %d: %v", i, err)
+		}
+		if got := img.Bounds(); got != src.Bounds() {
+			t.Fatalf("bounds = %v, want %v", got, src.Bounds())
+		}
+		if got := color.RGBAModel.Convert(img.At(3, 2)); got != src.At(3, 2) {
+			t.Errorf("pixel = %v, want %v", got, src.At(3, 2))
+		}
+	}
+
+	portal.mu.Lock()
+	defer portal.mu.Unlock()
+	if len(portal.calls) != 2 {
+		t.Fatalf("portal was called %d times, want 2", len(portal.calls))
+	}
+	for _, options := range portal.calls {
+		if interactive, ok := options["interactive"].(bool); !ok || interactive {
+			t.Errorf("interactive = %v, want false", options["interactive"])
+		}
+		if token, _ := options["handle_token"].(string); token == "" {
+			t.Error("handle_token was not sent")
+		}
+	}
+	// ポータルが保存したファイルは利用者のファイルの可能性があるため削除しない
+	for _, path := range portal.saved {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("portal screenshot %s was removed: %v", path, err)
+		}
+	}
+}
+
+func TestPortalCaptureRect(t *testing.T) {
+	_, capturer := startFakePortal(t, 0, image.NewRGBA(image.Rect(0, 0, 20, 10)))
+
+	img, err := capturer.CaptureRect(image.Rect(5, 2, 15, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(10, 6) {
+		t.Errorf("size = %v, want 10x6", got)
+	}
+	if _, err := capturer.CaptureRect(image.Rect(30, 30, 40, 40)); err == nil {
+		t.Error("expected an error for a rect outside the screen")
+	}
+}
+
+func TestPortalCancelled(t *testing.T) {
+	_, capturer := startFakePortal(t, 1, nil)
+
+	_, err := capturer.CaptureWindow(PortalScreenHWND)
+	if !errors.Is(err, ErrPortalCancelled) {
+		t.Fatalf("err = %v, want ErrPortalCancelled", err)
+	}
+}
+
+// fakeScreenCastPortal は org.freedesktop.portal.ScreenCast の代替実装です。
+// Start が呼び出されるたびに新しい復元トークン (token-1, token-2, ...) を返します。
+type fakeScreenCastPortal struct {
+	conn *dbus.Conn
+
+	mu       sync.Mutex
+	response uint32            // Start が返す応答コード (0: 成功, 1: キャンセル)
+	selected []map[string]any  // SelectSources が受け取ったオプション
+	starts   int               // Start が呼び出された回数
+	remotes  int               // OpenPipeWireRemote が呼び出された回数
+	closed   []dbus.ObjectPath // 閉じられたセッション
+	pipes    []*os.File        // OpenPipeWireRemote で渡したパイプ
+	sessions map[dbus.ObjectPath]*fakeSession
+}
+
+// fakeSession は org.freedesktop.portal.Session の代替実装です。
+type fakeSession struct {
+	portal *fakeScreenCastPortal
+	path   dbus.ObjectPath
+}
+
+// Close は xdg-desktop-portal の Session.Close メソッドです。
+func (s *fakeSession) Close() *dbus.Error {
+	s.portal.mu.Lock()
+	defer s.portal.mu.Unlock()
+	s.portal.closed = append(s.portal.closed, s.path)
+	return nil
+}
+
+// respond は handle_token から求めた Request オブジェクトに Response シグナルを送ります。
+func (p *fakeScreenCastPortal) respond(sender dbus.Sender, options map[string]dbus.Variant, code uint32, results map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+	token, _ := options["handle_token"].Value().(string)
+	handle := portalRequestPath(string(sender), token)
+	if err := p.conn.Emit(handle, portalRequestInterface+".Response", code, results); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return handle, nil
+}
+
+// CreateSession は xdg-desktop-portal の ScreenCast.CreateSession メソッドです。
+func (p *fakeScreenCastPortal) CreateSession(sender dbus.Sender, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token, _ := options["session_handle_token"].Value().(string)
+	path := dbus.ObjectPath(portalObjectPath + "/session/" + strings.ReplaceAll(strings.TrimPrefix(string(sender), ":"), ".", "_") + "/" + token)
+	session := &fakeSession{portal: p, path: path}
+	if err := p.conn.Export(session, path, portalSessionInterface); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	p.sessions[path] = session
+	return p.respond(sender, options, 0, map[string]dbus.Variant{"session_handle": dbus.MakeVariant(string(path))})
+}
+
+// SelectSources は xdg-desktop-portal の ScreenCast.SelectSources メソッドです。
+func (p *fakeScreenCastPortal) SelectSources(sender dbus.Sender, session dbus.ObjectPath, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions[session] == nil {
+		return "", dbus.MakeFailedError(errors.New("unknown session"))
+	}
+	received := make(map[string]any, len(options))
+	for k, v := range options {
+		received[k] = v.Value()
+	}
+	p.selected = append(p.selected, received)
+	return p.respond(sender, options, 0, map[string]dbus.Variant{})
+}
+
+// Start は xdg-desktop-portal の ScreenCast.Start メソッドです。
+func (p *fakeScreenCastPortal) Start(sender dbus.Sender, session dbus.ObjectPath, parentWindow string, options map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions[session] == nil {
+		return "", dbus.MakeFailedError(errors.New("unknown session"))
+	}
+	results := map[string]dbus.Variant{}
+	if p.response == 0 {
+		p.starts++
+		streams := []struct {
+			Node       uint32
+			Properties map[string]dbus.Variant
+		}{{Node: 42, Properties: map[string]dbus.Variant{"size": dbus.MakeVariant([]int32{8, 6})}}}
+		results["streams"] = dbus.MakeVariant(streams)
+		results["restore_token"] = dbus.MakeVariant(fmt.Sprintf("token-%d", p.starts))
+	}
+	return p.respond(sender, options, p.response, results)
+}
+
+// OpenPipeWireRemote は xdg-desktop-portal の ScreenCast.OpenPipeWireRemote メソッドです。
+// PipeWire の代わりに、"pipewire" と書き込んだパイプを返します。
+func (p *fakeScreenCastPortal) OpenPipeWireRemote(session dbus.ObjectPath, options map[string]dbus.Variant) (dbus.UnixFD, *dbus.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions[session] == nil {
+		return 0, dbus.MakeFailedError(errors.New("unknown session"))
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, dbus.MakeFailedError(err)
+	}
+	w.WriteString("pipewire")
+	w.Close()
+	p.remotes++
+	p.pipes = append(p.pipes, r)
+	return dbus.UnixFD(r.Fd()), nil
+}
+
+// startFakeScreenCastPortal はプライベートなバスに ScreenCast API を提供する代替ポータルを登録し、バスのアドレスを返します。
+func startFakeScreenCastPortal(t *testing.T, response uint32) (*fakeScreenCastPortal, string) {
+	t.Helper()
+	address := startPrivateBus(t)
+	serverConn := ownTestPortal(t, address)
+	portal := &fakeScreenCastPortal{conn: serverConn, response: response, sessions: map[dbus.ObjectPath]*fakeSession{}}
+	if err := serverConn.Export(portal, portalObjectPath, portalScreenCastInterface); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, f := range portal.pipes {
+			f.Close()
+		}
+	})
+	return portal, address
+}
+
+// pipeGrabber は代替ポータルが渡したパイプを読み、src を返す FrameGrabber を作成します。
+func pipeGrabber(t *testing.T, src image.Image) FrameGrabber {
+	return func(remote *os.File, node uint32) (image.Image, error) {
+		data, err := io.ReadAll(remote)
+		if err != nil {
+			return nil, err
+		}
+		if string(data) != "pipewire" || node != 42 {
+			t.Errorf("grab got %q from node %d, want the portal's remote for node 42", data, node)
+		}
+		return src, nil
+	}
+}
+
+func TestPortalScreenCastRestoreToken(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	portal, address := startFakeScreenCastPortal(t, 0)
+
+	first := connectTestPortal(t, address)
+	first.Grab = pipeGrabber(t, src)
+	var saved []string
+	first.OnRestoreToken(func(token string) { saved = append(saved, token) })
+
+	// 1 つのセッションで繰り返し撮影する (撮影のたびに許可を求めない)
+	for i := 0; i < 3; i++ {
+		img, err := first.CaptureWindow(PortalScreenHWND)
+		if err != nil {
+			t.Fatalf("capture %d: %v", i, err)
+		}
+		if img != src {
+			t.Errorf("capture %d returned a different image", i)
+		}
+	}
+	if got := first.RestoreToken(); got != "token-1" {
+		t.Errorf("restore token = %q, want token-1", got)
+	}
+	if !slices.Equal(saved, []string{"token-1"}) {
+		t.Errorf("OnRestoreToken got %v, want [token-1]", saved)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 再起動後は保存したトークンで許可を復元し、新しいトークンを受け取る
+	second := connectTestPortal(t, address)
+	second.Grab = pipeGrabber(t, src)
+	second.SetRestoreToken("token-1")
+	if _, err := second.CaptureWindow(PortalScreenHWND); err != nil {
+		t.Fatal(err)
+	}
+	if got := second.RestoreToken(); got != "token-2" {
+		t.Errorf("restore token = %q, want token-2", got)
+	}
+
+	portal.mu.Lock()
+	defer portal.mu.Unlock()
+	if len(portal.selected) != 2 || portal.starts != 2 || portal.remotes != 4 {
+		t.Fatalf("got %d SelectSources, %d Start and %d OpenPipeWireRemote calls, want 2, 2 and 4", len(portal.selected), portal.starts, portal.remotes)
+	}
+	for i, options := range portal.selected {
+		if mode, _ := options["persist_mode"].(uint32); mode != 2 {
+			t.Errorf("session %d: persist_mode = %v, want 2", i, options["persist_mode"])
+		}
+		if types, _ := options["types"].(uint32); types != 1 {
+			t.Errorf("session %d: types = %v, want 1 (monitor)", i, options["types"])
+		}
+	}
+	if token, ok := portal.selected[0]["restore_token"]; ok {
+		t.Errorf("first session sent restore_token %v without a saved token", token)
+	}
+	if token := portal.selected[1]["restore_token"]; token != "token-1" {
+		t.Errorf("second session sent restore_token %v, want token-1", token)
+	}
+	if len(portal.closed) != 1 {
+		t.Errorf("%d sessions were closed, want 1 (on Close)", len(portal.closed))
+	}
+}
+
+func TestPortalScreenCastCancelled(t *testing.T) {
+	portal, address := startFakeScreenCastPortal(t, 1)
+	capturer := connectTestPortal(t, address)
+	capturer.Grab = pipeGrabber(t, nil)
+
+	if _, err := capturer.CaptureWindow(PortalScreenHWND); !errors.Is(err, ErrPortalCancelled) {
+		t.Fatalf("err = %v, want ErrPortalCancelled", err)
+	}
+	if token := capturer.RestoreToken(); token != "" {
+		t.Errorf("restore token = %q after a cancelled session", token)
+	}
+	portal.mu.Lock()
+	defer portal.mu.Unlock()
+	// キャンセルされたセッションは閉じ、Screenshot API にフォールバックしない
+	if len(portal.closed) != 1 || portal.remotes != 0 {
+		t.Errorf("closed %d sessions and opened %d remotes, want 1 and 0", len(portal.closed), portal.remotes)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// QOI (Quite OK Image Format) のチャンクのタグ
+// 仕様: https://qoiformat.org/qoi-specification.pdf
+const (
+	qoiOpIndex = 0x00 // 00xxxxxx: 直近の色の配列を参照
+	qoiOpDiff  = 0x40 // 01xxxxxx: 直前の画素との小さな差分
+	qoiOpLuma  = 0x80 // 10xxxxxx: 緑を基準とした差分
+	qoiOpRun   = 0xc0 // 11xxxxxx: 直前の画素の繰り返し
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+
+	qoiMaxRun = 62
+)
+
+// qoiEndMarker はデータの終わりを示す 8 バイトの列です。
+var qoiEndMarker = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+// EncodeQOI は img を QOI 形式 (RGBA 4 チャンネル、sRGB) で w に書き込みます。
+// PNG より圧縮率は低いものの、エンコードが非常に高速な可逆圧縮形式です。
+func EncodeQOI(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("cannot encode empty image as QOI")
+	}
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	header := make([]byte, 14)
+	copy(header, "qoif")
+	binary.BigEndian.PutUint32(header[4:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(header[8:], uint32(b.Dy()))
+	header[12] = 4 // チャンネル数 (RGBA)
+	header[13] = 0 // sRGB (アルファは線形)
+	bw.Write(header)
+
+	var index [64]color.NRGBA
+	prev := color.NRGBA{A: 0xff}
+	run := 0
+	rgba, _ := img.(*image.RGBA)
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var px color.NRGBA
+			if rgba != nil && rgba.Pix[rgba.PixOffset(x, y)+3] == 0xff {
+				// 不透明な画素は乗算済みアルファの変換が不要なので、そのまま読み取る
+				p := rgba.Pix[rgba.PixOffset(x, y):]
+				px = color.NRGBA{R: p[0], G: p[1], B: p[2], A: 0xff}
+			} else {
+				px = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			}
+
+			if px == prev {
+				run++
+				if run == qoiMaxRun {
+					bw.WriteByte(qoiOpRun | byte(run-1))
+					run = 0
+				}
+				continue
+			}
+			if run > 0 {
+				bw.WriteByte(qoiOpRun | byte(run-1))
+				run = 0
+			}
+
+			hash := (int(px.R)*3 + int(px.G)*5 + int(px.B)*7 + int(px.A)*11) % 64
+			switch {
+			case index[hash] == px:
+				bw.WriteByte(qoiOpIndex | byte(hash))
+			case px.A == prev.A:
+				index[hash] = px
+				dr := int8(px.R - prev.R)
+				dg := int8(px.G - prev.G)
+				db := int8(px.B - prev.B)
+				drdg := dr - dg
+				dbdg := db - dg
+				switch {
+				case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+					bw.WriteByte(qoiOpDiff | byte(dr+2)<<4 | byte(dg+2)<<2 | byte(db+2))
+				case dg >= -32 && dg <= 31 && drdg >= -8 && drdg <= 7 && dbdg >= -8 && dbdg <= 7:
+					bw.WriteByte(qoiOpLuma | byte(dg+32))
+					bw.WriteByte(byte(drdg+8)<<4 | byte(dbdg+8))
+				default:
+					bw.Write([]byte{qoiOpRGB, px.R, px.G, px.B})
+				}
+			default:
+				index[hash] = px
+				bw.Write([]byte{qoiOpRGBA, px.R, px.G, px.B, px.A})
+			}
+			prev = px
+		}
+	}
+	if run > 0 {
+		bw.WriteByte(qoiOpRun | byte(run-1))
+	}
+	bw.Write(qoiEndMarker)
+	return bw.Flush()
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// decodeQOI は仕様に従った QOI の参照デコーダーです。デコードした画像と、チャンクの種類ごとの数を返します。
+func decodeQOI(data []byte) (*image.NRGBA, map[string]int, error) {
+	if len(data) < 14+len(qoiEndMarker) || string(data[:4]) != "qoif" {
+		return nil, nil, fmt.Errorf("not a QOI image")
+	}
+	if !bytes.Equal(data[len(data)-len(qoiEndMarker):], qoiEndMarker) {
+		return nil, nil, fmt.Errorf("missing end marker")
+	}
+	width := int(binary.BigEndian.Uint32(data[4:]))
+	height := int(binary.BigEndian.Uint32(data[8:]))
+	if data[12] != 4 || data[13] != 0 {
+		return nil, nil, fmt.Errorf("unexpected channels %d and colorspace %d", data[12], data[13])
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	ops := make(map[string]int)
+	var index [64]color.NRGBA
+	px := color.NRGBA{A: 0xff}
+	p := 14
+	end := len(data) - len(qoiEndMarker)
+	next := func() byte {
+		if p >= end {
+			panic("QOI data ends in the middle of a chunk")
+		}
+		p++
+		return data[p-1]
+	}
+	for i := 0; i < width*height; {
+		if p >= end {
+			return nil, nil, fmt.Errorf("data ends after %d of %d pixels", i, width*height)
+		}
+		run := 1
+		switch b := next(); {
+		case b == qoiOpRGB:
+			px.R, px.G, px.B = next(), next(), next()
+			ops["rgb"]++
+		case b == qoiOpRGBA:
+			px.R, px.G, px.B, px.A = next(), next(), next(), next()
+			ops["rgba"]++
+		case b&0xc0 == qoiOpIndex:
+			px = index[b&0x3f]
+			ops["index"]++
+		case b&0xc0 == qoiOpDiff:
+			px.R += (b>>4)&3 - 2
+			px.G += (b>>2)&3 - 2
+			px.B += b&3 - 2
+			ops["diff"]++
+		case b&0xc0 == qoiOpLuma:
+			b2 := next()
+			dg := b&0x3f - 32
+			px.R += dg + b2>>4 - 8
+			px.G += dg
+			px.B += dg + b2&0x0f - 8
+			ops["luma"]++
+		default: // qoiOpRun
+			run = int(b&0x3f) + 1
+			ops["run"]++
+		}
+		index[(int(px.R)*3+int(px.G)*5+int(px.B)*7+int(px.A)*11)%64] = px
+		for ; run > 0; run-- {
+			if i >= width*height {
+				return nil, nil, fmt.Errorf("run goes past the last pixel")
+			}
+			img.SetNRGBA(i%width, i/width, px)
+			i++
+		}
+	}
+	if p != end {
+		return nil, nil, fmt.Errorf("%d bytes left after the last pixel", end-p)
+	}
+	return img, ops, nil
+}
+
+func TestEncodeQOIKnownBytes(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	for x, c := range []color.RGBA{{1, 0, 0, 0xff}, {1, 0, 0, 0xff}, {0, 0, 0, 0xff}, {1, 0, 0, 0xff}} {
+		img.SetRGBA(x, 0, c)
+	}
+	var buf bytes.Buffer
+	if err := EncodeQOI(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 4, 0, 0, 0, 1, 4, 0,
+		0x7a, // DIFF (+1, 0, 0)
+		0xc0, // RUN 1
+		0x5a, // DIFF (-1, 0, 0)
+		0x38, // INDEX 56
+	}
+	want = append(want, qoiEndMarker...)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("encoded % x\nwant    % x", buf.Bytes(), want)
+	}
+}
+
+func TestEncodeQOIRoundTrip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(5, 7, 105, 12)) // 原点以外から始まる画像
+	b := img.Bounds()
+	for x := b.Min.X; x < b.Max.X; x++ {
+		img.SetRGBA(x, b.Min.Y, color.RGBA{0x20, 0x40, 0x60, 0xff}) // 1 行目: 62 を超える繰り返し (1 行 100 画素)
+	}
+	img.SetRGBA(b.Min.X, b.Min.Y+1, color.RGBA{0xff, 0x10, 0x00, 0xff})
+	img.SetRGBA(b.Min.X+1, b.Min.Y+1, color.RGBA{0x00, 0x11, 0xfe, 0xff}) // DIFF: R と B がラップアラウンドする
+	img.SetRGBA(b.Min.X+2, b.Min.Y+1, color.RGBA{0xed, 0xfb, 0xe3, 0xff}) // LUMA: G が 0x11 から 0xfb (-22) に、R が 0x00 から 0xed にラップアラウンドする
+	img.SetRGBA(b.Min.X+3, b.Min.Y+1, color.RGBA{0xff, 0x10, 0x00, 0xff}) // INDEX: 以前の色
+	img.SetRGBA(b.Min.X+4, b.Min.Y+1, color.RGBA{0x80, 0x00, 0x40, 0xff}) // RGB
+	// 半透明と透明の画素 (乗算済みアルファからの変換が必要)
+	img.SetRGBA(b.Min.X+5, b.Min.Y+1, color.RGBA{0x40, 0x20, 0x10, 0x80})
+	img.SetRGBA(b.Min.X+6, b.Min.Y+1, color.RGBA{0x41, 0x20, 0x10, 0x80})
+	img.SetRGBA(b.Min.X+7, b.Min.Y+1, color.RGBA{})
+	// 残りは 64 色を順に繰り返す (2 周目以降は INDEX になる)
+	for y := b.Min.Y + 2; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := (y*b.Dx() + x) % 64
+			img.SetRGBA(x, y, color.RGBA{byte(i * 4), byte(255 - i*4), byte(i * 16), 0xff})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeQOI(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, ops, err := decodeQOI(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds().Size() != b.Size() {
+		t.Fatalf("decoded size = %v, want %v", decoded.Bounds().Size(), b.Size())
+	}
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			want := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y))
+			if got := decoded.NRGBAAt(x, y); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	for _, op := range []string{"run", "index", "diff", "luma", "rgb", "rgba"} {
+		if ops[op] == 0 {
+			t.Errorf("no %s chunk was written (%v)", op, ops)
+		}
+	}
+
+	// image.RGBA 以外の画像 (すべての画素を Convert で変換する) も同じ結果になる
+	nrgba := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			nrgba.Set(x, y, img.At(x, y))
+		}
+	}
+	var other bytes.Buffer
+	if err := EncodeQOI(&other, nrgba); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(other.Bytes(), buf.Bytes()) {
+		t.Error("encoding an NRGBA image gives different bytes")
+	}
+}
+
+func TestEncodeQOIEmpty(t *testing.T) {
+	if err := EncodeQOI(&bytes.Buffer{}, image.NewRGBA(image.Rectangle{})); err == nil {
+		t.Error("expected an error for an empty image")
+	}
+}
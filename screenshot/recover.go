@@ -0,0 +1,161 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"myscreenshot-tool/atomicfile"
+)
+
+// RecoveryReport は中断されたセッションの後始末の結果です。
+type RecoveryReport struct {
+	RemovedTemp  []string // 削除した書き込み途中の一時ファイル
+	RemovedEmpty []string // 削除した空の画像ファイル (SaveScreenshot が名前を確保した後、書き込む前に中断されたもの)
+	Truncated    []string // 途中までしか書かれていない画像ファイル
+	Errors       []error  // 確認や削除に失敗したファイルのエラー (失敗したファイルは飛ばして残りを確認します)
+}
+
+// RecoverSaveDirectory は保存先ディレクトリから、前回のセッションが中断された際に残った一時ファイルと
+// 空の画像ファイルを削除し、途中までしか書かれていない画像を検出します。
+// 画像はファイル名のテンプレートに一致するもの (matcher.MatchFile が true のもの) のみを対象にし、
+// 利用者が保存先に置いたファイルには触れません。検出した画像は削除せず、RecoveryReport.Truncated で返します。
+// このプロセスの起動後に更新されたファイルは実行中のセッションのものである可能性があるため、対象にしません。
+// 個々のファイルの失敗は RecoveryReport.Errors に記録して続行し、保存先を確認できなかった場合のみエラーを返します。
+func RecoverSaveDirectory(dir string, matcher *TemplateMatcher) (RecoveryReport, error) {
+	var report RecoveryReport
+	removed, err := atomicfile.CleanupTemp(dir)
+	report.RemovedTemp = removed
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				if errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			report.Errors = append(report.Errors, err)
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			// テンプレートで作成されないディレクトリには入らない
+			if !matcher.MatchDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if atomicfile.IsTemp(path) || !matcher.MatchFile(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				report.Errors = append(report.Errors, err)
+			}
+			return nil
+		}
+		if !atomicfile.IsStale(info) {
+			return nil
+		}
+		// 空のファイルは名前の確保のみで画像が書き込まれなかったものなので削除する
+		if info.Size() == 0 {
+			if err := os.Remove(path); err != nil {
+				report.Errors = append(report.Errors, fmt.Errorf("failed to remove empty image %s: %w", path, err))
+				return nil
+			}
+			report.RemovedEmpty = append(report.RemovedEmpty, path)
+			return nil
+		}
+		truncated, err := IsTruncatedImage(path)
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			return nil
+		}
+		if truncated {
+			report.Truncated = append(report.Truncated, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to check save directory %s: %w", dir, err)
+	}
+	return report, nil
+}
+
+// pngTrailer は PNG ファイルの末尾にある IEND チャンクです。
+var pngTrailer = []byte{0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xae, 0x42, 0x60, 0x82}
+
+// IsTruncatedImage は画像ファイルが途中までしか書かれていないかどうかを、形式ごとの末尾の目印やヘッダーで判定します。
+// 画像全体をデコードせずに判定するため、保存先に大量のファイルがあっても短時間で確認できます。
+// 拡張子から形式がわからないファイルは false を返します。
+func IsTruncatedImage(path string) (bool, error) {
+	if !isImageFile(path) {
+		return false, nil
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	size := info.Size()
+	if size == 0 {
+		return true, nil
+	}
+
+	// tail はファイルの末尾 n バイトを読み込みます
+	tail := func(n int64) []byte {
+		if size < n {
+			return nil
+		}
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, size-n); err != nil && err != io.EOF {
+			return nil
+		}
+		return buf
+	}
+
+	switch ext {
+	case ".png":
+		return !bytes.Equal(tail(int64(len(pngTrailer))), pngTrailer), nil
+	case ".jpg", ".jpeg":
+		// JPEG は EOI マーカー (FF D9) で終わる
+		return !bytes.Equal(tail(2), []byte{0xff, 0xd9}), nil
+	case ".qoi":
+		return !bytes.Equal(tail(int64(len(qoiEndMarker))), qoiEndMarker), nil
+	case ".bmp":
+		// BMP はファイルヘッダーにファイル全体のサイズが記録されている
+		header := make([]byte, 6)
+		if _, err := f.ReadAt(header, 0); err != nil {
+			return true, nil
+		}
+		return int64(binary.LittleEndian.Uint32(header[2:])) > size, nil
+	default: // TIFF は末尾に目印がないため、ヘッダーのみ確認する
+		header := make([]byte, 8)
+		if _, err := f.ReadAt(header, 0); err != nil {
+			return true, nil
+		}
+		return !bytes.HasPrefix(header, []byte("II*\x00")) && !bytes.HasPrefix(header, []byte("MM\x00*")), nil
+	}
+}
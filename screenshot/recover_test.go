@@ -0,0 +1,103 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"myscreenshot-tool/atomicfile"
+)
+
+// writeTestFile は data を書き込んだファイルを作成し、stale の場合は更新時刻をプロセスの起動前にします。
+func writeTestFile(t *testing.T, path string, data []byte, stale bool) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if stale {
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecoverSaveDirectory(t *testing.T) {
+	dir := t.TempDir()
+	const tmpl = "shot_{frame}"
+	matcher, err := MatchTemplate(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := SaveScreenshot(image.NewRGBA(image.Rect(0, 0, 4, 4)), dir, tmpl, FrameInfo{Frame: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete, err := os.ReadFile(saved.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, saved.Path, complete, true) // 前回のセッションで保存した画像
+
+	path := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+	if err := os.Mkdir(path("photos"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, path(atomicfile.TempPrefix+"old.png-1"), complete[:10], true)
+	writeTestFile(t, path(atomicfile.TempPrefix+"live.png-2"), complete[:10], false) // 実行中のセッションが書き込み中
+	writeTestFile(t, path("shot_000002.png"), nil, true)                             // 名前の確保後に中断された
+	writeTestFile(t, path("shot_000003.png"), nil, false)                            // 実行中のセッションが確保した名前
+	writeTestFile(t, path("shot_000004.png"), complete[:len(complete)-4], true)      // 書き込みの途中で中断された
+	// テンプレートに一致しないファイルは利用者のものなので対象外
+	writeTestFile(t, path("notes.txt"), nil, true)
+	writeTestFile(t, path("holiday.png"), nil, true)
+	writeTestFile(t, path("photos/shot_000005.png"), nil, true)
+	writeTestFile(t, path("broken.png"), complete[:10], true)
+
+	report, err := RecoverSaveDirectory(dir, matcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{path(atomicfile.TempPrefix + "old.png-1")}; !slices.Equal(report.RemovedTemp, want) {
+		t.Errorf("RemovedTemp = %v, want %v", report.RemovedTemp, want)
+	}
+	if want := []string{path("shot_000002.png")}; !slices.Equal(report.RemovedEmpty, want) {
+		t.Errorf("RemovedEmpty = %v, want %v", report.RemovedEmpty, want)
+	}
+	if want := []string{path("shot_000004.png")}; !slices.Equal(report.Truncated, want) {
+		t.Errorf("Truncated = %v, want %v", report.Truncated, want)
+	}
+	if len(report.Errors) != 0 {
+		t.Errorf("Errors = %v", report.Errors)
+	}
+
+	for _, name := range []string{atomicfile.TempPrefix + "old.png-1", "shot_000002.png"} {
+		if _, err := os.Stat(path(name)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	for _, name := range []string{atomicfile.TempPrefix + "live.png-2", "shot_000003.png", "shot_000004.png", "notes.txt", "holiday.png", "photos/shot_000005.png", "broken.png", filepath.Base(saved.Path)} {
+		if _, err := os.Stat(path(name)); err != nil {
+			t.Errorf("%s should be kept: %v", name, err)
+		}
+	}
+}
+
+func TestRecoverSaveDirectoryMissing(t *testing.T) {
+	matcher, err := MatchTemplate(DefaultFilenameTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := RecoverSaveDirectory(filepath.Join(t.TempDir(), "missing"), matcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.RemovedTemp)+len(report.RemovedEmpty)+len(report.Truncated)+len(report.Errors) != 0 {
+		t.Errorf("report = %+v, want empty", report)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// MaskMode はマスクした領域の隠し方です。値は config.MaskSetting.Mode にそのまま保存されます。
+type MaskMode string
+
+const (
+	MaskSolid    MaskMode = "solid"    // 単色で塗りつぶす
+	MaskPixelate MaskMode = "pixelate" // ブロックごとの平均の色で塗りつぶす (モザイク)
+	// MaskBlur はぼかします。ぼかしの程度によっては文字が読み取れる場合があるため、
+	// 確実に隠す必要がある領域には MaskSolid か MaskPixelate を使用してください。
+	MaskBlur MaskMode = "blur"
+)
+
+// マスクの設定が省略された場合の値
+const (
+	DefaultMaskBlockSize  = 16 // MaskPixelate のブロックの大きさ (ピクセル)
+	DefaultMaskBlurRadius = 12 // MaskBlur の半径 (ピクセル)
+)
+
+// MaskRule は隠す領域 1 つです。
+type MaskRule struct {
+	Rect       image.Rectangle // ウィンドウの左上を原点とする矩形 (RedactionOptions.Reference の大きさのウィンドウでの位置)
+	Mode       MaskMode
+	Color      color.Color // MaskSolid の色 (nil の場合は黒)
+	BlockSize  int         // MaskPixelate のブロックの大きさ (0 以下の場合は DefaultMaskBlockSize)
+	BlurRadius int         // MaskBlur の半径 (0 以下の場合は DefaultMaskBlurRadius)
+}
+
+// RedactionOptions は Redactor の設定です。
+type RedactionOptions struct {
+	Rules []MaskRule
+	// Reference はマスクの矩形を設定したときのウィンドウの大きさです。
+	// 撮影時のウィンドウの大きさがこれと異なる場合は、マスクの矩形を同じ比率で拡大・縮小します。
+	// 空の場合は拡大・縮小しません。
+	Reference image.Point
+	// Origin は撮影した画像の左上のウィンドウ上の位置です (ウィンドウを基準とした撮影領域を切り出す場合はその左上)。
+	Origin image.Point
+}
+
+// Redactor は保存の前に画像の指定された領域を隠す FrameProcessor です。
+// ファイルに書き込む前に適用するため、隠す前のピクセルがディスクに残ることはありません。
+type Redactor struct {
+	opts RedactionOptions
+}
+
+// NewRedactor はマスクの設定を確認して Redactor を作成します。
+func NewRedactor(opts RedactionOptions) (*Redactor, error) {
+	rules := make([]MaskRule, len(opts.Rules))
+	for i, rule := range opts.Rules {
+		if rule.Rect.Empty() {
+			return nil, fmt.Errorf("mask %d: rectangle must have a positive size: %v", i+1, rule.Rect)
+		}
+		switch rule.Mode {
+		case "":
+			rule.Mode = MaskSolid
+		case MaskSolid, MaskPixelate, MaskBlur:
+		default:
+			return nil, fmt.Errorf("mask %d: unknown mode %q", i+1, rule.Mode)
+		}
+		if rule.Color == nil {
+			rule.Color = color.Black
+		}
+		if rule.BlockSize <= 0 {
+			rule.BlockSize = DefaultMaskBlockSize
+		}
+		if rule.BlurRadius <= 0 {
+			rule.BlurRadius = DefaultMaskBlurRadius
+		}
+		rules[i] = rule
+	}
+	opts.Rules = rules
+	return &Redactor{opts: opts}, nil
+}
+
+// Process はマスクを画像に適用します。img が *image.RGBA の場合はその場で書き換えます。
+// 撮影時のウィンドウの大きさは frame.WindowRect から取得し、取得できない場合は画像の大きさを使用します。
+// ウィンドウの一部だけを撮影した画像では、frame.Offset の分だけマスクの位置をずらします。
+func (r *Redactor) Process(img image.Image, frame FrameInfo) (image.Image, error) {
+	if len(r.opts.Rules) == 0 {
+		return img, nil
+	}
+	dst, ok := img.(*image.RGBA)
+	if !ok {
+		b := img.Bounds()
+		dst = image.NewRGBA(b)
+		draw.Draw(dst, b, img, b.Min, draw.Src)
+	}
+
+	bounds := dst.Bounds()
+	window := frame.WindowRect.Size()
+	if frame.WindowRect.Empty() {
+		if r.opts.Origin == (image.Point{}) && frame.Offset == (image.Point{}) {
+			window = bounds.Size() // ウィンドウ全体を撮影した画像
+		} else {
+			window = r.opts.Reference // 切り出した画像や一部だけの画像からはウィンドウの大きさがわからないため拡大・縮小しない
+		}
+	}
+
+	for _, rule := range r.opts.Rules {
+		rect := r.scale(rule.Rect, window).Sub(r.opts.Origin).Sub(frame.Offset).Add(bounds.Min).Intersect(bounds)
+		if rect.Empty() {
+			continue
+		}
+		switch rule.Mode {
+		case MaskSolid:
+			draw.Draw(dst, rect, image.NewUniform(rule.Color), image.Point{}, draw.Src)
+		case MaskPixelate:
+			pixelate(dst, rect, rule.BlockSize)
+		case MaskBlur:
+			boxBlur(dst, rect, rule.BlurRadius)
+		}
+	}
+	return dst, nil
+}
+
+// scale はマスクの矩形を撮影時のウィンドウの大きさに合わせて拡大・縮小します。
+// 隠し漏れがないよう、端は外側に丸めます。
+func (r *Redactor) scale(rect image.Rectangle, window image.Point) image.Rectangle {
+	ref := r.opts.Reference
+	if ref.X <= 0 || ref.Y <= 0 || window.X <= 0 || window.Y <= 0 || window == ref {
+		return rect
+	}
+	floor := func(v, num, den int) int { return floorDiv(v*num, den) }
+	ceil := func(v, num, den int) int { return -floorDiv(-v*num, den) }
+	return image.Rect(
+		floor(rect.Min.X, window.X, ref.X), floor(rect.Min.Y, window.Y, ref.Y),
+		ceil(rect.Max.X, window.X, ref.X), ceil(rect.Max.Y, window.Y, ref.Y),
+	)
+}
+
+// floorDiv は負の数も切り捨てる整数の除算です。
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// pixelate は rect を size ピクセルのブロックに分け、各ブロックをその平均の色で塗りつぶします。
+func pixelate(img *image.RGBA, rect image.Rectangle, size int) {
+	for by := rect.Min.Y; by < rect.Max.Y; by += size {
+		for bx := rect.Min.X; bx < rect.Max.X; bx += size {
+			block := image.Rect(bx, by, bx+size, by+size).Intersect(rect)
+			var sum [4]int
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				row := img.Pix[img.PixOffset(block.Min.X, y):img.PixOffset(block.Max.X, y)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := block.Dx() * block.Dy()
+			avg := [4]byte{byte(sum[0] / n), byte(sum[1] / n), byte(sum[2] / n), byte(sum[3] / n)}
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				row := img.Pix[img.PixOffset(block.Min.X, y):img.PixOffset(block.Max.X, y)]
+				for i := 0; i < len(row); i += 4 {
+					copy(row[i:i+4], avg[:])
+				}
+			}
+		}
+	}
+}
+
+// boxBlur は rect の中をぼかします。箱型のぼかしを横と縦に 3 回ずつ適用して、ガウスぼかしに近い結果にします。
+// rect の外のピクセルは参照しません (端では rect の中のピクセルだけで平均します)。
+func boxBlur(img *image.RGBA, rect image.Rectangle, radius int) {
+	w, h := rect.Dx(), rect.Dy()
+	// rect を連続したバッファにコピーして処理し、最後に書き戻す
+	buf := make([]byte, w*h*4)
+	tmp := make([]byte, w*h*4)
+	for y := 0; y < h; y++ {
+		copy(buf[y*w*4:(y+1)*w*4], img.Pix[img.PixOffset(rect.Min.X, rect.Min.Y+y):])
+	}
+	for pass := 0; pass < 3; pass++ {
+		blurLine(buf, tmp, w, h, 4, w*4, radius) // 横方向: 1 行ごと
+		blurLine(tmp, buf, h, w, w*4, 4, radius) // 縦方向: 1 列ごと
+	}
+	for y := 0; y < h; y++ {
+		copy(img.Pix[img.PixOffset(rect.Min.X, rect.Min.Y+y):], buf[y*w*4:(y+1)*w*4])
+	}
+}
+
+// blurLine は src の各ラインに半径 radius の移動平均を適用して dst に書き込みます。
+// ラインは lines 本あり、各ラインは n 個のピクセルからなります。
+// step はライン内の隣のピクセルまで、lineStep は次のラインまでのバイト数です。
+func blurLine(src, dst []byte, n, lines, step, lineStep, radius int) {
+	for line := 0; line < lines; line++ {
+		base := line * lineStep
+		for c := 0; c < 4; c++ {
+			// 窓 [i-radius, i+radius] のうち範囲内のピクセルの合計と数を保ちながら進める
+			sum, count := 0, 0
+			for i := 0; i <= radius && i < n; i++ {
+				sum += int(src[base+i*step+c])
+				count++
+			}
+			for i := 0; i < n; i++ {
+				dst[base+i*step+c] = byte(sum / count)
+				if out := i - radius; out >= 0 {
+					sum -= int(src[base+out*step+c])
+					count--
+				}
+				if in := i + radius + 1; in < n {
+					sum += int(src[base+in*step+c])
+					count++
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+)
+
+// maskedColumns は画像の行 y のうち、色が c のピクセルの x の範囲を返します (画像の左端を 0 とします)。
+func maskedColumns(img image.Image, y int, c color.RGBA) (first, last int) {
+	b := img.Bounds()
+	first, last = -1, -1
+	for x := b.Min.X; x < b.Max.X; x++ {
+		if color.RGBAModel.Convert(img.At(x, b.Min.Y+y)) == c {
+			if first < 0 {
+				first = x - b.Min.X
+			}
+			last = x - b.Min.X
+		}
+	}
+	return first, last
+}
+
+func TestRedactorClippedFrame(t *testing.T) {
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	black := color.RGBA{0, 0, 0, 0xFF}
+	// 100x50 のウィンドウの左側 30 ピクセルが画面外にあり、撮影できたのは x = 30 からの部分
+	clipped := image.Rect(30, 0, 100, 50)
+	redactor, err := NewRedactor(RedactionOptions{
+		Rules:     []MaskRule{{Rect: image.Rect(20, 10, 60, 20)}},
+		Reference: image.Pt(100, 50),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 撮影した画像の Bounds がウィンドウ上の位置の場合
+	out, err := redactor.Process(filledRGBA(clipped, white), FrameInfo{Offset: clipped.Min, WindowRect: image.Rect(-30, 0, 70, 50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, last := maskedColumns(out, 15, black); first != 0 || last != 29 {
+		t.Errorf("mask covers image columns %d-%d, want 0-29 (window x 30-59)", first, last)
+	}
+	if first, _ := maskedColumns(out, 5, black); first >= 0 {
+		t.Error("mask drawn outside its rows")
+	}
+
+	// 原点から始まる画像に変換された後でも、Offset があれば同じ位置に適用する
+	out, err = redactor.Process(filledRGBA(image.Rect(0, 0, 70, 50), white), FrameInfo{Offset: clipped.Min})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, last := maskedColumns(out, 15, black); first != 0 || last != 29 {
+		t.Errorf("mask covers image columns %d-%d, want 0-29", first, last)
+	}
+}
+
+func TestPipelineRedactsClippedWindow(t *testing.T) {
+	white := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	black := color.RGBA{0, 0, 0, 0xFF}
+	windowRect := image.Rect(-30, 0, 70, 50) // 左側の 30 ピクセルが画面外
+	fake := NewFakeCapturer(&FakeWindow{
+		Info:   WindowInfo{HWND: 1, Title: "clipped", Rect: windowRect},
+		Frames: []image.Image{filledRGBA(image.Rect(30, 0, 100, 50), white)},
+	})
+
+	tests := []struct {
+		name        string
+		target      Target
+		origin      image.Point
+		first, last int // マスクされる画像の列
+	}{
+		{"window", Target{HWND: 1}, image.Point{}, 0, 29},
+		// ウィンドウ上の (10, 0) からの領域。撮影できた部分は領域の x = 20 から
+		{"window region", Target{HWND: 1, Region: &Region{Anchor: AnchorWindow, Rect: image.Rect(10, 0, 90, 50)}}, image.Pt(10, 0), 0, 29},
+	}
+	for _, tt := range tests {
+		redactor, err := NewRedactor(RedactionOptions{
+			Rules:     []MaskRule{{Rect: image.Rect(20, 10, 60, 20)}},
+			Reference: image.Pt(100, 50),
+			Origin:    tt.origin,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved SavedFile
+		p, err := NewPipeline(PipelineOptions{
+			SaveDir:    t.TempDir(),
+			Template:   "frame",
+			Processors: []FrameProcessor{redactor},
+			OnSaved: func(job Job, s SavedFile, err error) {
+				if err != nil {
+					t.Errorf("%s: %v", tt.name, err)
+				}
+				saved = s
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := Capture(fake, tt.target)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.target.Region != nil {
+			if want := image.Rect(20, 0, 80, 50); img.Bounds() != want {
+				t.Errorf("%s: region bounds = %v, want %v", tt.name, img.Bounds(), want)
+			}
+		} else {
+			img = filledRGBA(img.Bounds(), white) // フェイクのフレームは共有されているため、書き換え用に複製する
+		}
+		p.Submit(context.Background(), Job{Image: img, Frame: FrameInfo{WindowRect: windowRect}})
+		p.Close()
+
+		f, err := os.Open(saved.Path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		out, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if first, last := maskedColumns(out, 15, black); first != tt.first || last != tt.last {
+			t.Errorf("%s: mask covers columns %d-%d, want %d-%d", tt.name, first, last, tt.first, tt.last)
+		}
+	}
+}
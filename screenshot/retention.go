@@ -0,0 +1,224 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"myscreenshot-tool/atomicfile"
+)
+
+// RetentionOptions は保存先に残すスクリーンショットの上限です。0 の項目は制限しません。
+type RetentionOptions struct {
+	MaxBytes int64         // 合計サイズの上限
+	MaxFiles int           // ファイル数の上限
+	MaxAge   time.Duration // 保存してからの経過時間の上限
+	// PerSession が true の場合、このセッションで保存したファイルだけを対象にします。
+	// false の場合は保存先ディレクトリのうち、Template で保存した名前に一致する画像ファイルが対象です
+	// (利用者が保存先に置いた他の画像は削除しません)。
+	PerSession bool
+	// Template は保存に使用するファイル名のテンプレートです。
+	// サブディレクトリを含まない場合は、保存先ディレクトリの直下のファイルのみを対象にします。
+	Template string
+}
+
+// IsZero は制限が何も設定されていないかどうかを返します。
+func (o RetentionOptions) IsZero() bool {
+	return o.MaxBytes <= 0 && o.MaxFiles <= 0 && o.MaxAge <= 0
+}
+
+// Janitor は保存先のスクリーンショットが上限を超えないよう、古いものから削除します。
+type Janitor struct {
+	dir  string
+	opts RetentionOptions
+
+	mu      sync.Mutex
+	session []string // このセッションで保存したファイル (PerSession の場合のみ使用)
+}
+
+// retainedFile は削除の候補となるファイルです。
+type retainedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// NewJanitor は dir のスクリーンショットを管理する Janitor を作成します。
+func NewJanitor(dir string, opts RetentionOptions) *Janitor {
+	return &Janitor{dir: dir, opts: opts}
+}
+
+// Track はこのセッションで保存したファイルを記録します (PerSession の場合の削除の対象になります)。
+// 保存のワーカーから同時に呼び出せます。
+func (j *Janitor) Track(path string) {
+	if !j.opts.PerSession {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.session = append(j.session, path)
+}
+
+// Run は ctx が終了するまで、interval ごとに Sweep を実行します。
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	if j.opts.IsZero() {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if removed, err := j.Sweep(time.Now()); err != nil {
+			log.Printf("Retention sweep failed: %v", err)
+		} else if len(removed) > 0 {
+			log.Printf("Retention: removed %d old screenshot(s).", len(removed))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep は上限を超えている分のスクリーンショットを古いものから削除し、削除したパスを返します。
+func (j *Janitor) Sweep(now time.Time) ([]string, error) {
+	if j.opts.IsZero() {
+		return nil, nil
+	}
+	files, err := j.candidates()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(a, b int) bool { return files[a].modTime.Before(files[b].modTime) })
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+
+	var removed []string
+	var errs []error
+	for i, f := range files {
+		remaining := len(files) - i
+		tooMany := j.opts.MaxFiles > 0 && remaining > j.opts.MaxFiles
+		tooBig := j.opts.MaxBytes > 0 && total > j.opts.MaxBytes
+		tooOld := j.opts.MaxAge > 0 && now.Sub(f.modTime) > j.opts.MaxAge
+		if !tooMany && !tooBig && !tooOld {
+			break // 古い順に並んでいるため、これ以降のファイルはすべて上限内
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		total -= f.size
+		removed = append(removed, f.path)
+		j.removeEmptyDirs(filepath.Dir(f.path))
+	}
+
+	if j.opts.PerSession && len(removed) > 0 {
+		j.forget(removed)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// candidates は削除の対象となるファイルの一覧を返します。
+func (j *Janitor) candidates() ([]retainedFile, error) {
+	var files []retainedFile
+	if j.opts.PerSession {
+		j.mu.Lock()
+		paths := append([]string(nil), j.session...)
+		j.mu.Unlock()
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // 既に削除されている
+			}
+			files = append(files, retainedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return files, nil
+	}
+
+	matcher, err := MatchTemplate(j.opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(j.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(j.dir, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			// テンプレートで作成されないディレクトリには入らない
+			if !matcher.MatchDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if atomicfile.IsTemp(path) || !matcher.MatchFile(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, retainedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list screenshots in %s: %w", j.dir, err)
+	}
+	return files, nil
+}
+
+// forget は削除したファイルをセッションの記録から取り除きます。
+func (j *Janitor) forget(removed []string) {
+	gone := make(map[string]bool, len(removed))
+	for _, path := range removed {
+		gone[path] = true
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	kept := j.session[:0]
+	for _, path := range j.session {
+		if !gone[path] {
+			kept = append(kept, path)
+		}
+	}
+	j.session = kept
+}
+
+// removeEmptyDirs はファイル名のテンプレートで作成されたサブディレクトリが空になった場合に削除します。
+// 保存先ディレクトリ自体は削除しません。
+func (j *Janitor) removeEmptyDirs(dir string) {
+	root := filepath.Clean(j.dir)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil { // 空でない場合は失敗する
+			return
+		}
+	}
+}
+
+// isImageFile は保存形式のいずれかの拡張子を持つファイルかどうかを返します。
+func isImageFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".bmp", ".tiff", ".tif", ".qoi":
+		return true
+	}
+	return false
+}
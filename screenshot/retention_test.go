@@ -0,0 +1,115 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMatchTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl  string
+		path  string
+		match bool
+	}{
+		{DefaultFilenameTemplate, "screenshot_2025-01-02_03-04-05_0000.png", true},
+		{DefaultFilenameTemplate, "screenshot_2025-01-02_03-04-05_0000_3.JPG", true}, // 名前の衝突による連番
+		{DefaultFilenameTemplate, "screenshot_2025-01-02_03-04-05_0000.txt", false},
+		{DefaultFilenameTemplate, "screenshot_holiday.png", false},
+		{DefaultFilenameTemplate, "holiday.png", false},
+		{DefaultFilenameTemplate, "2025-01-02/screenshot_2025-01-02_03-04-05_0000.png", false}, // サブディレクトリは対象外
+		{"{date}/shot_{frame}", "2025-01-02/shot_000012.qoi", true},
+		{"{date}/shot_{frame}", "shot_000012.qoi", false},
+		{"{date}/shot_{frame}", "photos/shot_000012.qoi", false},
+		{"{window}_{monitor}", "Editor - a.txt_all.png", true},
+		{"{window}_{monitor}", "Editor_x.png", false},
+	}
+	for _, tt := range tests {
+		m, err := MatchTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.tmpl, err)
+		}
+		if got := m.MatchFile(filepath.FromSlash(tt.path)); got != tt.match {
+			t.Errorf("%q matches %q = %v, want %v", tt.tmpl, tt.path, got, tt.match)
+		}
+	}
+
+	// テンプレートを展開した名前には必ず一致する
+	frame := FrameInfo{Time: time.Date(2025, 1, 2, 3, 4, 5, 6e6, time.Local), Counter: 7, Frame: 8, SessionID: "s", WindowTitle: "a/b: c?", ProcessName: "p.exe", Monitor: -1}
+	for _, tmpl := range []string{DefaultFilenameTemplate, "{yyyy}/{mm}/{window}_{utc}_{iso}_{ms}", "{process}-{session}-{frame}"} {
+		m, err := MatchTemplate(tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := ExpandTemplate(tmpl, frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.MatchFile(name + ".png") {
+			t.Errorf("%q does not match its own expansion %q", tmpl, name)
+		}
+	}
+
+	if _, err := MatchTemplate("{unknown}"); err == nil {
+		t.Error("expected an error for an unknown placeholder")
+	}
+}
+
+func TestJanitorSweepOnlyTemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	create := func(rel string) string {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	shot := create("screenshot_2025-01-02_03-04-05_0000.png")
+	others := []string{
+		create("holiday.png"), // 利用者が置いた画像
+		create("2025-01-02/screenshot_2025-01-02_03-04-05_0000.png"), // テンプレートがサブディレクトリを含まない
+	}
+
+	j := NewJanitor(dir, RetentionOptions{MaxAge: time.Hour, Template: DefaultFilenameTemplate})
+	removed, err := j.Sweep(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{shot}; !slices.Equal(removed, want) {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+	for _, path := range others {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s should be kept: %v", path, err)
+		}
+	}
+
+	// サブディレクトリを含むテンプレートでは、テンプレートに一致するディレクトリのみを対象にする
+	nested := create("2025-01-03/shot_000001.png")
+	kept := create("photos/shot_000002.png")
+	j = NewJanitor(dir, RetentionOptions{MaxAge: time.Hour, Template: "{date}/shot_{frame}"})
+	removed, err = j.Sweep(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{nested}; !slices.Equal(removed, want) {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("%s should be kept: %v", kept, err)
+	}
+	if _, err := os.Stat(filepath.Dir(nested)); !os.IsNotExist(err) {
+		t.Error("empty template directory was not removed")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ScaleKernel は縮小に使用する補間の方法です。値は config.ScaleSetting.Kernel にそのまま保存されます。
+type ScaleKernel string
+
+const (
+	KernelNearest    ScaleKernel = "nearest"     // 最近傍 (最も速いが、文字や細い線が崩れやすい)
+	KernelBilinear   ScaleKernel = "bilinear"    // バイリニア
+	KernelCatmullRom ScaleKernel = "catmull_rom" // Catmull-Rom (最も遅いが、縮小後の文字が最も読みやすい)
+)
+
+// ScaleOptions は Scaler の設定です。
+type ScaleOptions struct {
+	Factor    float64     // 縮小率 (0-1、0 または 1 の場合は縮小しない)
+	MaxWidth  int         // 幅の上限 (0 の場合は制限しない)
+	MaxHeight int         // 高さの上限 (0 の場合は制限しない)
+	Kernel    ScaleKernel // 空の場合は KernelBilinear
+}
+
+// Scaler は保存の前に画像を縮小する FrameProcessor です。
+// Factor で縮小した後、幅と高さが上限を超える場合は縦横比を保ったまま上限に収まるよう縮小します。
+type Scaler struct {
+	opts   ScaleOptions
+	scaler xdraw.Scaler
+}
+
+// NewScaler は設定を確認して Scaler を作成します。
+func NewScaler(opts ScaleOptions) (*Scaler, error) {
+	if opts.Factor < 0 || opts.Factor > 1 {
+		return nil, fmt.Errorf("scale factor must be between 0 and 1: %g", opts.Factor)
+	}
+	if opts.MaxWidth < 0 || opts.MaxHeight < 0 {
+		return nil, fmt.Errorf("max width and height must not be negative: %dx%d", opts.MaxWidth, opts.MaxHeight)
+	}
+	s := &Scaler{opts: opts}
+	switch opts.Kernel {
+	case KernelNearest:
+		s.scaler = xdraw.NearestNeighbor
+	case KernelBilinear, "":
+		s.scaler = xdraw.BiLinear
+	case KernelCatmullRom:
+		s.scaler = xdraw.CatmullRom
+	default:
+		return nil, fmt.Errorf("unknown scale kernel %q", opts.Kernel)
+	}
+	return s, nil
+}
+
+// IsNoop は設定が縮小を行わないかどうかを返します。
+func (s *Scaler) IsNoop() bool {
+	return (s.opts.Factor == 0 || s.opts.Factor == 1) && s.opts.MaxWidth == 0 && s.opts.MaxHeight == 0
+}
+
+// TargetSize は size の画像を縮小した後の大きさを返します。
+func (s *Scaler) TargetSize(size image.Point) image.Point {
+	w, h := float64(size.X), float64(size.Y)
+	if f := s.opts.Factor; f > 0 && f < 1 {
+		w, h = w*f, h*f
+	}
+	if s.opts.MaxWidth > 0 && w > float64(s.opts.MaxWidth) {
+		w, h = float64(s.opts.MaxWidth), h*float64(s.opts.MaxWidth)/w
+	}
+	if s.opts.MaxHeight > 0 && h > float64(s.opts.MaxHeight) {
+		w, h = w*float64(s.opts.MaxHeight)/h, float64(s.opts.MaxHeight)
+	}
+	return image.Pt(max(int(math.Round(w)), 1), max(int(math.Round(h)), 1))
+}
+
+// Process は画像を縮小した新しい画像を返します。縮小する必要がない場合は img をそのまま返します。
+// 縮小後の画像はプールのバッファを使用するため、保存後に ReleaseImage で解放できます。
+func (s *Scaler) Process(img image.Image, frame FrameInfo) (image.Image, error) {
+	b := img.Bounds()
+	size := s.TargetSize(b.Size())
+	if size == b.Size() {
+		return img, nil
+	}
+	dst := newPooledRGBA(size.X, size.Y)
+	s.scaler.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst, nil
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+)
+
+func TestScalerTargetSize(t *testing.T) {
+	tests := []struct {
+		opts ScaleOptions
+		size image.Point
+		want image.Point
+	}{
+		{ScaleOptions{}, image.Pt(1920, 1080), image.Pt(1920, 1080)},
+		{ScaleOptions{Factor: 1}, image.Pt(1920, 1080), image.Pt(1920, 1080)},
+		{ScaleOptions{Factor: 0.5}, image.Pt(1920, 1080), image.Pt(960, 540)},
+		// 上限を超える辺が上限に収まるよう、縦横比を保って縮小する
+		{ScaleOptions{MaxWidth: 1280}, image.Pt(1920, 1080), image.Pt(1280, 720)},
+		{ScaleOptions{MaxHeight: 540}, image.Pt(1920, 1080), image.Pt(960, 540)},
+		{ScaleOptions{MaxWidth: 1280, MaxHeight: 1280}, image.Pt(1080, 1920), image.Pt(720, 1280)},  // 縦長
+		{ScaleOptions{MaxWidth: 1000, MaxHeight: 300}, image.Pt(1920, 1080), image.Pt(533, 300)},    // 高さの方が厳しい
+		{ScaleOptions{MaxWidth: 300, MaxHeight: 1000}, image.Pt(1920, 1080), image.Pt(300, 169)},    // 幅の方が厳しい
+		{ScaleOptions{MaxWidth: 4000, MaxHeight: 4000}, image.Pt(1920, 1080), image.Pt(1920, 1080)}, // 拡大はしない
+		{ScaleOptions{Factor: 0.5, MaxWidth: 640}, image.Pt(1920, 1080), image.Pt(640, 360)},        // 縮小率の後に上限を適用する
+		{ScaleOptions{MaxWidth: 10}, image.Pt(1000, 20), image.Pt(10, 1)},                           // 1 ピクセル未満にはしない
+	}
+	for _, tt := range tests {
+		s, err := NewScaler(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.TargetSize(tt.size); got != tt.want {
+			t.Errorf("%+v: TargetSize(%v) = %v, want %v", tt.opts, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestScalerProcess(t *testing.T) {
+	s, err := NewScaler(ScaleOptions{MaxWidth: 40, MaxHeight: 40, Kernel: KernelNearest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := filledRGBA(image.Rect(10, 10, 110, 60), color.RGBA{0x20, 0x40, 0x60, 0xff})
+	out, err := s.Process(img, FrameInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Bounds(); got != image.Rect(0, 0, 40, 20) {
+		t.Errorf("scaled bounds = %v, want 40x20", got)
+	}
+	if c := out.(*image.RGBA).RGBAAt(20, 10); c != (color.RGBA{0x20, 0x40, 0x60, 0xff}) {
+		t.Errorf("scaled pixel = %v", c)
+	}
+	ReleaseImage(out)
+
+	// 上限に収まっている画像はそのまま返す
+	small := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	if out, err := s.Process(small, FrameInfo{}); err != nil || out != image.Image(small) {
+		t.Errorf("Process returned a new image for an image within the limits (err %v)", err)
+	}
+}
+
+func TestNewScalerInvalid(t *testing.T) {
+	for _, opts := range []ScaleOptions{{Factor: -0.5}, {Factor: 1.5}, {MaxWidth: -1}, {MaxHeight: -1}, {Kernel: "lanczos"}} {
+		if _, err := NewScaler(opts); err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
+
+func TestPipelineRecordsOriginalSize(t *testing.T) {
+	s, err := NewScaler(ScaleOptions{MaxWidth: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := NewEncoder(FormatPNG, EncoderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var frames []FrameInfo
+	var files []SavedFile
+	p, err := NewPipeline(PipelineOptions{
+		QueueSize:  1,
+		Drop:       DropBlock,
+		SaveDir:    t.TempDir(),
+		Template:   "frame_{frame}",
+		Encoder:    enc,
+		Processors: []FrameProcessor{s},
+		OnSaved: func(job Job, saved SavedFile, err error) {
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			frames = append(frames, job.Frame)
+			files = append(files, saved)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Submit(context.Background(), Job{Image: newPooledRGBA(200, 100), Frame: FrameInfo{Frame: 1}})
+	p.Close()
+
+	if len(files) != 1 {
+		t.Fatalf("%d files saved, want 1", len(files))
+	}
+	if frames[0].OriginalSize != image.Pt(200, 100) {
+		t.Errorf("OriginalSize = %v, want 200x100", frames[0].OriginalSize)
+	}
+	if files[0].Width != 50 || files[0].Height != 25 {
+		t.Errorf("saved size = %dx%d, want 50x25", files[0].Width, files[0].Height)
+	}
+	// 画像に埋め込んだメタデータにも、縮小前と保存した画像の大きさを記録する
+	meta, err := ReadMetadata(files[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.OriginalSize != image.Pt(200, 100) || meta.Size != image.Pt(50, 25) {
+		t.Errorf("metadata sizes = %v, %v; want 200x100, 50x25", meta.OriginalSize, meta.Size)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// xdg-desktop-portal の ScreenCast API
+const (
+	portalScreenCastInterface = "org.freedesktop.portal.ScreenCast"
+
+	screenCastSourceMonitor       uint32 = 1 // types: モニター
+	screenCastPersistUntilRevoked uint32 = 2 // persist_mode: 明示的に取り消されるまで許可を保持する
+)
+
+// errScreenCastUnavailable はポータルが ScreenCast API を提供していない場合に返されます。
+var errScreenCastUnavailable = errors.New("screenshot: ScreenCast portal is not available")
+
+// FrameGrabber は ScreenCast のストリームから 1 フレームを取得する関数です。
+// remote はポータルの OpenPipeWireRemote が返した PipeWire への接続、node はストリームのノード ID です。
+// remote は呼び出し後に PortalCapturer が閉じます。
+type FrameGrabber func(remote *os.File, node uint32) (image.Image, error)
+
+// defaultFrameGrabber は gst-launch-1.0 がインストールされている場合に GStreamerFrameGrabber を返します。
+func defaultFrameGrabber() FrameGrabber {
+	if _, err := exec.LookPath("gst-launch-1.0"); err != nil {
+		return nil
+	}
+	return GStreamerFrameGrabber
+}
+
+// GStreamerFrameGrabber は gst-launch-1.0 の pipewiresrc でストリームから 1 フレームを取得します。
+func GStreamerFrameGrabber(remote *os.File, node uint32) (image.Image, error) {
+	// remote は子プロセスのファイルディスクリプタ 3 として渡す
+	cmd := exec.Command("gst-launch-1.0", "-q",
+		"pipewiresrc", "fd=3", fmt.Sprintf("path=%d", node), "num-buffers=1", "!",
+		"videoconvert", "!", "pngenc", "snapshot=true", "!", "fdsink", "fd=1")
+	cmd.ExtraFiles = []*os.File{remote}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gst-launch-1.0 failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame from gst-launch-1.0: %w", err)
+	}
+	return img, nil
+}
+
+// captureScreenCast は ScreenCast のセッションのストリームから 1 フレームを取得します。
+// セッションがなければ開始し、以降の撮影では同じセッションを使用します (撮影のたびに許可を求めません)。
+// 呼び出し側で mu を保持している必要があります。
+func (c *PortalCapturer) captureScreenCast() (image.Image, error) {
+	if c.session == "" {
+		if err := c.startScreenCast(); err != nil {
+			return nil, err
+		}
+	}
+
+	var fd dbus.UnixFD
+	obj := c.conn.Object(c.destination, portalObjectPath)
+	err := obj.Call(portalScreenCastInterface+".OpenPipeWireRemote", 0, c.session, map[string]dbus.Variant{}).Store(&fd)
+	if err != nil {
+		// セッションがデスクトップ環境によって閉じられた場合は、次回の撮影で開き直す
+		c.closeSession()
+		return nil, fmt.Errorf("portal call OpenPipeWireRemote failed: %w", err)
+	}
+	remote := os.NewFile(uintptr(fd), "pipewire-remote")
+	defer remote.Close()
+
+	img, err := c.Grab(remote, c.node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to grab frame from PipeWire node %d: %w", c.node, err)
+	}
+	return img, nil
+}
+
+// startScreenCast は ScreenCast のセッションを作成し、画面全体のストリームを開始します。
+// 保存済みの復元トークンがあれば SelectSources に渡し、ポータルが返した新しいトークンを保存します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *PortalCapturer) startScreenCast() error {
+	sessionToken, err := newPortalHandleToken()
+	if err != nil {
+		return err
+	}
+	results, err := c.request(portalScreenCastInterface+".CreateSession", map[string]dbus.Variant{
+		"session_handle_token": dbus.MakeVariant(sessionToken),
+	})
+	if err != nil {
+		var dbusErr dbus.Error
+		if errors.As(err, &dbusErr) && isUnknownDBusMember(dbusErr.Name) {
+			return fmt.Errorf("%w: %w", errScreenCastUnavailable, err)
+		}
+		return err
+	}
+	session, err := portalSessionHandle(results)
+	if err != nil {
+		return err
+	}
+	c.session = session
+
+	options := map[string]dbus.Variant{
+		"types":        dbus.MakeVariant(screenCastSourceMonitor),
+		"multiple":     dbus.MakeVariant(false),
+		"persist_mode": dbus.MakeVariant(screenCastPersistUntilRevoked),
+	}
+	if c.restoreToken != "" {
+		options["restore_token"] = dbus.MakeVariant(c.restoreToken)
+	}
+	if _, err := c.request(portalScreenCastInterface+".SelectSources", options, session); err != nil {
+		c.closeSession()
+		return err
+	}
+
+	results, err = c.request(portalScreenCastInterface+".Start", map[string]dbus.Variant{}, session, "")
+	if err != nil {
+		c.closeSession()
+		return err
+	}
+	var streams []struct {
+		Node       uint32
+		Properties map[string]dbus.Variant
+	}
+	if v, ok := results["streams"]; !ok || dbus.Store([]any{v.Value()}, &streams) != nil || len(streams) == 0 {
+		c.closeSession()
+		return errors.New("portal ScreenCast response has no streams")
+	}
+	c.node = streams[0].Node
+
+	// 復元トークンは一度しか使用できないため、受け取るたびに保存し直す
+	if v, ok := results["restore_token"]; ok {
+		if token, _ := v.Value().(string); token != "" && token != c.restoreToken {
+			c.restoreToken = token
+			if c.onRestoreToken != nil {
+				c.onRestoreToken(token)
+			}
+		}
+	}
+	return nil
+}
+
+// closeSession は開いている ScreenCast のセッションを閉じます。
+// 呼び出し側で mu を保持している必要があります。
+func (c *PortalCapturer) closeSession() {
+	if c.session == "" {
+		return
+	}
+	c.conn.Object(c.destination, c.session).Call(portalSessionInterface+".Close", 0)
+	c.session = ""
+	c.node = 0
+}
+
+// portalSessionHandle は CreateSession の応答からセッションのオブジェクトパスを取り出します。
+// 古いポータル実装は文字列で、新しい実装はオブジェクトパスで返します。
+func portalSessionHandle(results map[string]dbus.Variant) (dbus.ObjectPath, error) {
+	v, ok := results["session_handle"]
+	if !ok {
+		return "", errors.New("portal CreateSession response has no session_handle")
+	}
+	switch handle := v.Value().(type) {
+	case string:
+		return dbus.ObjectPath(handle), nil
+	case dbus.ObjectPath:
+		return handle, nil
+	default:
+		return "", fmt.Errorf("unexpected session_handle type %T", handle)
+	}
+}
+
+// isUnknownDBusMember は D-Bus のエラー名が、メソッドやインターフェースが存在しないことを表すかどうかを判定します。
+func isUnknownDBusMember(name string) bool {
+	switch name {
+	case "org.freedesktop.DBus.Error.UnknownMethod",
+		"org.freedesktop.DBus.Error.UnknownInterface",
+		"org.freedesktop.DBus.Error.UnknownObject":
+		return true
+	}
+	return false
+}
@@ -3,21 +3,26 @@
 package screenshot
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"image"
 	"image/png"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
-	"syscall"
+	"strings"
 	"time"
-	"unsafe"
 
-	"golang.org/x/sys/windows"
+	"myscreenshot-tool/atomicfile"
 )
 
-// ウィンドウハンドル (HWND) を使いやすくするための型エイリアス
-type HWND syscall.Handle
+// ウィンドウハンドル (HWND) を使いやすくするための型
+// Windows 以外のバックエンドでも、ウィンドウを一意に識別する値として使用する
+type HWND uintptr
 
 // RECT 構造体 (ウィンドウの座標情報)
 type RECT struct {
@@ -27,266 +32,183 @@ type RECT struct {
 	Bottom int32
 }
 
-// Windows API のインポート
-// これらは go.mod で golang.org/x/sys/windows を指定していれば利用可能
-var (
-	user32   = windows.NewLazySystemDLL("user32.dll")
-	gdi32    = windows.NewLazySystemDLL("gdi32.dll")
-	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
-
-	enumWindowsProc         = user32.NewProc("EnumWindows")
-	getWindowTextProc       = user32.NewProc("GetWindowTextW")
-	getWindowTextLengthProc = user32.NewProc("GetWindowTextLengthW")
-	isWindowVisibleProc     = user32.NewProc("IsWindowVisible")
-	getWindowRectProc       = user32.NewProc("GetWindowRect")
-	getWindowDCProc         = user32.NewProc("GetWindowDC")
-	releaseDCProc           = user32.NewProc("ReleaseDC")
-	printWindowProc         = user32.NewProc("PrintWindow")      // より信頼性の高いスクリーンショット取得方法
-	getDesktopWindowProc    = user32.NewProc("GetDesktopWindow") // デスクトップウィンドウのハンドルを取得
-
-	createCompatibleDCSingleProc = gdi32.NewProc("CreateCompatibleDC")
-	createCompatibleBitmapProc   = gdi32.NewProc("CreateCompatibleBitmap")
-	selectObjectProc             = gdi32.NewProc("SelectObject")
-	deleteObjectProc             = gdi32.NewProc("DeleteObject")
-	deleteDCProc                 = gdi32.NewProc("DeleteDC")
-	bitBltProc                   = gdi32.NewProc("BitBlt") // PrintWindowが使えない場合のフォールバック
-	getDIBitsProc                = gdi32.NewProc("GetDIBits")
-)
-
 // ウィンドウ情報を格納する構造体
 type WindowInfo struct {
-	HWND  HWND
-	Title string
+	HWND        HWND
+	Title       string
+	ClassName   string // ウィンドウクラス名 (X11 では WM_CLASS のクラス部分)
+	PID         uint32 // ウィンドウを所有するプロセスの ID (不明な場合は 0)
+	ProcessName string // プロセスの実行ファイル名 (例: notepad.exe)
+
+	Rect      image.Rectangle // 仮想デスクトップ座標でのウィンドウの位置とサイズ
+	Minimized bool            // 最小化されている
+	Maximized bool            // 最大化されている
+	Cloaked   bool            // 表示状態だが画面に描画されていない (別の仮想デスクトップ上など)
+	ZOrder    int             // 重なり順 (0 が最前面)
 }
 
-// EnumWindows のコールバック関数で使用するスライス
-var windowList []WindowInfo
-
-// EnumWindowsCallback は EnumWindows API のコールバック関数です。
-// 見つかったウィンドウのハンドルとタイトルを取得し、windowList に追加します。
-func EnumWindowsCallback(hwnd HWND, lParam uintptr) uintptr {
-	// ウィンドウが可視であるかチェック
-	ret, _, _ := isWindowVisibleProc.Call(uintptr(hwnd))
-	if ret == 0 { // IsWindowVisible は非表示のウィンドウでは0を返す
-		return 1 // true を返し、列挙を継続
-	}
-
-	// ウィンドウタイトルの長さを取得
-	textLen, _, _ := getWindowTextLengthProc.Call(uintptr(hwnd))
-	if textLen == 0 { // タイトルがないウィンドウはスキップ
-		return 1
-	}
-
-	// タイトルバッファの準備
-	buf := make([]uint16, textLen+1) // null終端のため+1
-
-	// ウィンドウタイトルを取得
-	getWindowTextProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(textLen+1))
-	title := syscall.UTF16ToString(buf)
-
-	// システムウィンドウやプログラムマネージャーなどを除外するための簡単なフィルタ
-	// 必要に応じてより厳密なフィルタリングを追加
-	if title == "Program Manager" || title == "Default IME" || title == "" {
-		return 1
-	}
-
-	windowList = append(windowList, WindowInfo{HWND: hwnd, Title: title})
-	return 1 // true を返し、列挙を継続
+// Capturer はウィンドウの列挙とスクリーンショット撮影を行うバックエンドのインターフェースです。
+// プラットフォームごとの実装 (Windows の GDI など) やテスト用のフェイクがこれを実装します。
+type Capturer interface {
+	// ListWindows は現在開いているウィンドウのリストを取得します。
+	ListWindows() ([]WindowInfo, error)
+	// WindowTitle は指定されたウィンドウのタイトルを取得します。
+	WindowTitle(hwnd HWND) (string, error)
+	// CaptureWindow は指定されたウィンドウのスクリーンショットを撮影します。
+	// 画像の Bounds はウィンドウの左上を原点とする座標です。ウィンドウの一部だけを撮影した場合
+	// (画面外にはみ出した部分を除いた場合など) は、Min がその部分のウィンドウ上の位置になります。
+	// 返された画像は、使い終わったら ReleaseImage に渡すとピクセルバッファが次の撮影で再利用されます。
+	// 渡さなかった画像も GC で回収されますが、バッファは再利用されません。渡した後の画像は参照しないでください。
+	CaptureWindow(hwnd HWND) (image.Image, error)
+	// ListMonitors は接続されているモニターとその位置・サイズを取得します。
+	ListMonitors() ([]MonitorInfo, error)
+	// CaptureRect は仮想デスクトップ座標で指定された画面の領域を撮影します。
+	// 返された画像の扱いは CaptureWindow と同じです (ReleaseImage に渡すとバッファが再利用されます)。
+	CaptureRect(rect image.Rectangle) (image.Image, error)
 }
 
-// GetWindowList は現在開いているウィンドウのリストを取得します。
-func GetWindowList() ([]WindowInfo, error) {
-	windowList = nil // リストをクリア
-	// EnumWindows 関数はコールバック関数を呼び出し、すべてのトップレベルウィンドウを列挙する
-	ret, _, err := enumWindowsProc.Call(syscall.NewCallback(EnumWindowsCallback), 0)
-	if ret == 0 {
-		return nil, fmt.Errorf("EnumWindows failed: %w", err)
-	}
-	return windowList, nil
+// WindowRecter はウィンドウの現在の位置を取得できるバックエンドが実装するインターフェースです。
+type WindowRecter interface {
+	// WindowRect は指定されたウィンドウの仮想デスクトップ座標での矩形を返します。
+	WindowRect(hwnd HWND) (image.Rectangle, error)
 }
 
-// GetWindowTitle は指定されたHWNDのタイトルを取得します。
-func GetWindowTitle(hwnd HWND) (string, error) {
-	textLen, _, _ := getWindowTextLengthProc.Call(uintptr(hwnd))
-	if textLen == 0 {
-		return "", nil // タイトルがない場合
-	}
-	buf := make([]uint16, textLen+1)
-	ret, _, err := getWindowTextProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(textLen+1))
-	if ret == 0 {
-		return "", fmt.Errorf("GetWindowTextW failed: %w", err)
-	}
-	return syscall.UTF16ToString(buf), nil
+// TokenRestorer は撮影許可の復元トークンを扱うバックエンドが実装するインターフェースです。
+// トークンを設定に保存しておくことで、再起動後やインターバル撮影のたびに許可を求められることを防ぎます。
+type TokenRestorer interface {
+	// RestoreToken は現在の復元トークンを返します。
+	RestoreToken() string
+	// SetRestoreToken は以前に保存した復元トークンを設定します。
+	SetRestoreToken(token string)
+	// OnRestoreToken は新しい復元トークンを受け取ったときに呼び出す関数を設定します。
+	// 復元トークンは一度しか使用できないため、受け取るたびに保存し直す必要があります。
+	OnRestoreToken(fn func(token string))
 }
 
-// CaptureWindow は指定されたウィンドウのスクリーンショットを撮影し、image.Imageとして返します。
-// PrintWindow API を優先的に使用します。
-func CaptureWindow(hwnd HWND) (image.Image, error) {
-	var rect RECT
-	ret, _, err := getWindowRectProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&rect)))
-	if ret == 0 {
-		return nil, fmt.Errorf("GetWindowRect failed: %w", err)
-	}
+// ErrUnsupportedPlatform は実行中のプラットフォームに利用可能なバックエンドがない場合に返されます。
+var ErrUnsupportedPlatform = errors.New("screenshot: no capture backend available on this platform")
 
-	width := int(rect.Right - rect.Left)
-	height := int(rect.Bottom - rect.Top)
+// ErrWindowMinimized は撮影対象のウィンドウが最小化されている (または描画領域の大きさが 0) ため撮影できない場合に返されます。
+// ウィンドウが元に戻れば再び撮影できます。
+var ErrWindowMinimized = errors.New("screenshot: window is minimized")
 
-	// ウィンドウのDC (Device Context) を取得
-	windowDC, _, err := getWindowDCProc.Call(uintptr(hwnd))
-	if windowDC == 0 {
-		return nil, fmt.Errorf("GetWindowDC failed: %w", err)
-	}
-	defer releaseDCProc.Call(uintptr(hwnd), windowDC) // 使用後に解放
+// ErrWindowGone は撮影対象のウィンドウが閉じられて存在しない場合に返されます。
+var ErrWindowGone = errors.New("screenshot: window no longer exists")
 
-	// 互換性のあるメモリDCを作成
-	memDC, _, err := createCompatibleDCSingleProc.Call(windowDC)
-	if memDC == 0 {
-		return nil, fmt.Errorf("CreateCompatibleDC failed: %w", err)
-	}
-	defer deleteDCProc.Call(memDC) // 使用後に解放
+// SaveScreenshotWithCounter は指定されたimage.Image、保存先ディレクトリ、およびシーケンスカウンターを元に画像を保存します。
+// ファイル名は screenshot_YYYY-MM-DD_HH-MM-SS_0000 形式になります。
+// 画像の形式とファイルの拡張子は enc で決まります (nil の場合は PNG)。
+func SaveScreenshotWithCounter(img image.Image, saveDir string, counter int, enc Encoder) (string, error) {
+	saved, err := SaveScreenshot(img, saveDir, DefaultFilenameTemplate, FrameInfo{Time: time.Now(), Counter: counter, Monitor: -1}, enc)
+	return saved.Path, err
+}
 
-	// 互換性のあるビットマップを作成
-	hBitmap, _, err := createCompatibleBitmapProc.Call(windowDC, uintptr(width), uintptr(height))
-	if hBitmap == 0 {
-		return nil, fmt.Errorf("CreateCompatibleBitmap failed: %w", err)
-	}
-	defer deleteObjectProc.Call(hBitmap) // 使用後に解放
+// maxNameCollisions は同じ名前のファイルが既に存在する場合に、番号を付けて試す最大回数です。
+const maxNameCollisions = 100
+
+// SavedFile は SaveScreenshot が保存したファイルの情報です。
+type SavedFile struct {
+	Path   string // 保存したファイルのパス
+	Format string // 保存形式 (拡張子から "." を除いたもの)
+	Width  int    // 画像の幅
+	Height int    // 画像の高さ
+	Bytes  int64  // ファイルのサイズ
+	SHA256 string // ファイルの内容の SHA-256 (16 進数)
+}
 
-	// ビットマップをメモリDCに選択
-	oldBitmap, _, err := selectObjectProc.Call(memDC, hBitmap)
-	if oldBitmap == 0 { // oldBitmapは以前選択されていたオブジェクトのハンドル、エラーではない
-		log.Printf("SelectObject returned 0, might be an issue. Error: %v", err)
+// SaveScreenshot はファイル名のテンプレートを frame の情報で展開し、保存先ディレクトリに画像を保存します。
+// テンプレートにディレクトリが含まれる場合は、必要なサブディレクトリを作成します。
+// 既存のファイルは上書きせず、同じ名前のファイルがある場合は "_1", "_2", ... を付けた名前で保存します。
+// 画像は一時ファイルに書き込んでから rename するため、書き込み途中でクラッシュしても途中までの画像は残りません。
+// 画像の形式とファイルの拡張子は enc で決まります (nil の場合は PNG)。
+// PNG と JPEG では、撮影時刻やウィンドウのタイトルなどの frame の情報を画像に埋め込みます (ReadMetadata で読み取れます)。
+func SaveScreenshot(img image.Image, saveDir, tmpl string, frame FrameInfo, enc Encoder) (SavedFile, error) {
+	if enc == nil {
+		enc = newPNGEncoder(png.DefaultCompression)
+	}
+	name, err := ExpandTemplate(tmpl, frame)
+	if err != nil {
+		return SavedFile{}, err
 	}
-	defer selectObjectProc.Call(memDC, oldBitmap) // 元のビットマップに戻す
+	base := filepath.Join(saveDir, name)
 
-	// PrintWindow API を使用してウィンドウの内容をメモリDCに描画
-	// PrintWindow は BitBlt よりも信頼性が高く、最小化されたウィンドウや重なったウィンドウも正しくキャプチャできる場合がある
-	// PRF_CLIENT | PRF_NONCLIENT はクライアント領域と非クライアント領域の両方を含むことを意味する
-	const PW_RENDERFULLWINDOW = 0x00000002 // PrintWindow flags (PRF_CLIENT | PRF_NONCLIENT | PRF_ERASEBKGND | PRF_CHILDREN)
-	// ret を result に変更し、初期化子 := を使用
-	result, _, _ := printWindowProc.Call(uintptr(hwnd), memDC, PW_RENDERFULLWINDOW)
-	if result == 0 { // 修正: ret を result に変更
-		// PrintWindow が失敗した場合、BitBlt でフォールバック (ただし、BitBltは一部のシナリオで問題がある)
-		log.Printf("PrintWindow failed for HWND %d. Falling back to BitBlt. Error: %v", hwnd, err)
-		// BitBlt (Source: windowDC, Dest: memDC)
-		const SRCCOPY = 0x00CC0020
-		bitBltProc.Call(memDC, 0, 0, uintptr(width), uintptr(height), windowDC, uintptr(rect.Left), uintptr(rect.Top), SRCCOPY)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return SavedFile{}, fmt.Errorf("failed to create save directory %s: %w", filepath.Dir(base), err)
 	}
 
-	// HBITMAP から Go の image.Image に変換
-	img, err := bitmapToImage(HBITMAP(hBitmap), width, height)
+	// 先に空のファイルを排他的に作成して名前を確保し、書き込みは一時ファイルに対して行う。
+	// この間にクラッシュした場合は空のファイルが残り、次回起動時に RecoverSaveDirectory が削除する。
+	reserved, filePath, err := createExclusive(base, enc.Extension())
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert bitmap to image: %w", err)
-	}
-
-	return img, nil
-}
-
-// SaveScreenshotWithCounter は指定されたimage.Image、保存先ディレクトリ、およびシーケンスカウンターを元にPNG形式で画像を保存します。
-func SaveScreenshotWithCounter(img image.Image, saveDir string, counter int) (string, error) {
-	if err := os.MkdirAll(saveDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create save directory %s: %w", saveDir, err)
+		return SavedFile{}, err
 	}
+	reserved.Close()
 
-	// タイムスタンプからミリ秒を除去
-	timestamp := time.Now().Format("2006-01-02_15-04-05") // 年月日_時-分-秒
-	// ファイル名を screenshot_YYYY-MM-DD_HH-MM-SS_0000.png 形式に変更
-	fileName := fmt.Sprintf("screenshot_%s_%04d.png", timestamp, counter)
-	filePath := filepath.Join(saveDir, fileName)
-
-	file, err := os.Create(filePath)
+	file, err := atomicfile.Create(filePath, 0644)
 	if err != nil {
-		return "", fmt.Errorf("failed to create screenshot file %s: %w", filePath, err)
+		os.Remove(filePath)
+		return SavedFile{}, err
 	}
-	defer file.Close()
+	defer file.Abort()
 
-	if err := png.Encode(file, img); err != nil {
-		return "", fmt.Errorf("failed to encode PNG image to file %s: %w", filePath, err)
+	// 一時ファイルへの細かい書き込みをまとめ、書き込みと同時にサイズとハッシュを計算する
+	digest := &digestWriter{hash: sha256.New()}
+	bw := bufio.NewWriterSize(io.MultiWriter(file, digest), 256*1024)
+	if menc, ok := enc.(MetadataEncoder); ok {
+		err = menc.EncodeWithMetadata(bw, img, NewImageMetadata(frame, img.Bounds().Size()))
+	} else {
+		err = enc.Encode(bw, img)
 	}
-
-	return filePath, nil
+	if err != nil {
+		os.Remove(filePath)
+		return SavedFile{}, fmt.Errorf("failed to encode image to file %s: %w", filePath, err)
+	}
+	if err := bw.Flush(); err != nil {
+		os.Remove(filePath)
+		return SavedFile{}, fmt.Errorf("failed to write image to file %s: %w", filePath, err)
+	}
+	if err := file.Commit(); err != nil {
+		os.Remove(filePath)
+		return SavedFile{}, err
+	}
+
+	return SavedFile{
+		Path:   filePath,
+		Format: strings.TrimPrefix(enc.Extension(), "."),
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Bytes:  digest.n,
+		SHA256: hex.EncodeToString(digest.hash.Sum(nil)),
+	}, nil
 }
 
-// bitmapToImage はHBITMAPをGoのimage.Imageに変換します。
-// この部分は、より複雑なWindows APIのBitBltやGetDIBitsを使った処理が含まれます。
-// Go 1.24.4 と golang.org/x/sys を使って直接ビットマップデータにアクセスする例を示します。
-type BITMAPINFOHEADER struct {
-	BiSize          uint32
-	BiWidth         int32
-	BiHeight        int32
-	BiPlanes        uint16
-	BiBitCount      uint16
-	BiCompression   uint32
-	BiSizeImage     uint32
-	BiXPelsPerMeter int32
-	BiYPelsPerMeter int32
-	BiClrUsed       uint32
-	BiClrImportant  uint32
+// digestWriter は書き込まれたバイト数とハッシュを計算する io.Writer です。
+type digestWriter struct {
+	hash hash.Hash
+	n    int64
 }
 
-type BITMAPINFO struct {
-	BmiHeader BITMAPINFOHEADER
-	BmiColors *uint32 // RGBQUAD array, or palette
+func (w *digestWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	w.n += int64(len(p))
+	return len(p), nil
 }
 
-type HBITMAP syscall.Handle
-
-func bitmapToImage(hBitmap HBITMAP, width, height int) (image.Image, error) {
-	// デスクトップDCを取得 (BitBlt時に必要)
-	desktopDC, _, err := getDesktopWindowProc.Call()
-	if desktopDC == 0 {
-		return nil, fmt.Errorf("GetDesktopWindow failed: %w", err)
-	}
-	desktopHDC, _, err := getWindowDCProc.Call(desktopDC)
-	if desktopHDC == 0 {
-		return nil, fmt.Errorf("GetWindowDC failed for desktop: %w", err)
-	}
-	defer releaseDCProc.Call(desktopDC, desktopHDC)
-
-	// BITMAPINFO構造体を準備
-	bmi := BITMAPINFO{
-		BmiHeader: BITMAPINFOHEADER{
-			BiSize:        uint32(unsafe.Sizeof(BITMAPINFOHEADER{})),
-			BiWidth:       int32(width),
-			BiHeight:      int32(-height), // 負の値でトップダウンDIBを指定
-			BiPlanes:      1,
-			BiBitCount:    32, // 32-bit (RGBA)
-			BiCompression: 0,  // BI_RGB (圧縮なし)
-		},
-	}
-
-	// ビットマップデータを格納するバッファ
-	pixelData := make([]byte, width*height*4) // 4 bytes per pixel (RGBA)
-
-	// GetDIBits を呼び出してビットマップデータを取得
-	// DIB_RGB_COLORS を指定し、ビットマップをピクセルデータに変換
-	result, _, err := getDIBitsProc.Call(
-		uintptr(desktopHDC),                    // HDC
-		uintptr(hBitmap),                       // HBITMAP
-		0,                                      // Start Scan Line
-		uintptr(height),                        // Number of Scan Lines
-		uintptr(unsafe.Pointer(&pixelData[0])), // lpBits
-		uintptr(unsafe.Pointer(&bmi)),          // lpBMI
-		0x00000000,                             // DIB_RGB_COLORS
-	)
-
-	if result == 0 { // 修正: ret を result に変更
-		return nil, fmt.Errorf("GetDIBits failed: %w", err)
-	}
-
-	// RGBA形式の画像を作成
-	// WindowsのDIBはBGRA形式で保存されることが多いので、RGBAに変換する必要がある
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			idx := (y*width + x) * 4
-			// BGRA to RGBA
-			img.Pix[idx] = pixelData[idx+2]   // R
-			img.Pix[idx+1] = pixelData[idx+1] // G
-			img.Pix[idx+2] = pixelData[idx]   // B
-			img.Pix[idx+3] = pixelData[idx+3] // A (アルファチャンネル)
+// createExclusive は base+ext のファイルを新規に作成します (O_EXCL のため既存のファイルを上書きしません)。
+// 既に存在する場合は base_1+ext, base_2+ext, ... の順に空いている名前を探します。
+func createExclusive(base, ext string) (*os.File, string, error) {
+	for i := 0; i < maxNameCollisions; i++ {
+		filePath := base + ext
+		if i > 0 {
+			filePath = fmt.Sprintf("%s_%d%s", base, i, ext)
+		}
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return file, filePath, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, "", fmt.Errorf("failed to create screenshot file %s: %w", filePath, err)
 		}
 	}
-
-	return img, nil
+	return nil, "", fmt.Errorf("failed to create screenshot file %s%s: too many files with the same name", base, ext)
 }
@@ -0,0 +1,38 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"log"
+	"os"
+)
+
+// NewCapturer は実行中のプラットフォームのデフォルトバックエンドを返します。
+// Wayland セッションでは xdg-desktop-portal を使用し、それ以外では環境変数 DISPLAY の X サーバーに接続します。
+// どちらのバックエンドもアルファを含まない画像を返すため、opts のアルファの設定は使用しません。
+func NewCapturer(opts CapturerOptions) (Capturer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if isWaylandSession() {
+		pc, err := NewPortalCapturer()
+		if err == nil {
+			return pc, nil
+		}
+		if os.Getenv("DISPLAY") == "" {
+			return nil, err
+		}
+		log.Printf("Failed to connect to xdg-desktop-portal, falling back to X11: %v", err)
+	}
+
+	c, err := NewX11Capturer(os.Getenv("DISPLAY"))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// isWaylandSession は現在のセッションが Wayland かどうかを判定します。
+func isWaylandSession() bool {
+	return os.Getenv("XDG_SESSION_TYPE") == "wayland" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
@@ -0,0 +1,383 @@
+//go:build windows
+
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows API のインポート
+// これらは go.mod で golang.org/x/sys/windows を指定していれば利用可能
+var (
+	user32   = windows.NewLazySystemDLL("user32.dll")
+	gdi32    = windows.NewLazySystemDLL("gdi32.dll")
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	dwmapi   = windows.NewLazySystemDLL("dwmapi.dll")
+
+	enumWindowsProc         = user32.NewProc("EnumWindows")
+	getWindowTextProc       = user32.NewProc("GetWindowTextW")
+	getWindowTextLengthProc = user32.NewProc("GetWindowTextLengthW")
+	isWindowVisibleProc     = user32.NewProc("IsWindowVisible")
+	getWindowRectProc       = user32.NewProc("GetWindowRect")
+	getWindowDCProc         = user32.NewProc("GetWindowDC")
+	releaseDCProc           = user32.NewProc("ReleaseDC")
+	printWindowProc         = user32.NewProc("PrintWindow")      // より信頼性の高いスクリーンショット取得方法
+	getDesktopWindowProc    = user32.NewProc("GetDesktopWindow") // デスクトップウィンドウのハンドルを取得
+	getClassNameProc        = user32.NewProc("GetClassNameW")
+	getWindowThreadProcProc = user32.NewProc("GetWindowThreadProcessId")
+	isIconicProc            = user32.NewProc("IsIconic") // 最小化されているか
+	isZoomedProc            = user32.NewProc("IsZoomed") // 最大化されているか
+	isWindowProc            = user32.NewProc("IsWindow") // ウィンドウが存在するか
+
+	dwmGetWindowAttributeProc = dwmapi.NewProc("DwmGetWindowAttribute")
+
+	openProcessProc               = kernel32.NewProc("OpenProcess")
+	closeHandleProc               = kernel32.NewProc("CloseHandle")
+	queryFullProcessImageNameProc = kernel32.NewProc("QueryFullProcessImageNameW")
+
+	createCompatibleDCSingleProc = gdi32.NewProc("CreateCompatibleDC")
+	createCompatibleBitmapProc   = gdi32.NewProc("CreateCompatibleBitmap")
+	selectObjectProc             = gdi32.NewProc("SelectObject")
+	deleteObjectProc             = gdi32.NewProc("DeleteObject")
+	deleteDCProc                 = gdi32.NewProc("DeleteDC")
+	bitBltProc                   = gdi32.NewProc("BitBlt") // PrintWindowが使えない場合のフォールバック
+	getDIBitsProc                = gdi32.NewProc("GetDIBits")
+)
+
+// GDICapturer は Windows の GDI (PrintWindow / BitBlt) を使用する Capturer の実装です。
+type GDICapturer struct {
+	alpha      AlphaPolicy // 撮影した画像のアルファの扱い
+	background color.Color // AlphaPremultiply の背景色
+}
+
+// NewGDICapturer は GDI バックエンドを作成します。
+// アルファの扱いは opts.Alpha (空の場合は AlphaOpaque) に従い、作成後は変更できません
+// (撮影中のゴルーチンから読み取るため)。
+func NewGDICapturer(opts CapturerOptions) (*GDICapturer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	c := &GDICapturer{alpha: AlphaOpaque, background: color.White}
+	if opts.Alpha != "" {
+		c.alpha = opts.Alpha
+	}
+	if opts.Background != nil {
+		c.background = opts.Background
+	}
+	return c, nil
+}
+
+// NewCapturer は実行中のプラットフォームのデフォルトバックエンドを返します。
+func NewCapturer(opts CapturerOptions) (Capturer, error) {
+	return NewGDICapturer(opts)
+}
+
+// EnumWindows のコールバックはパッケージ初期化時に一度だけ作成し、すべての呼び出しで共有する。
+// 呼び出しごとの結果は lParam に渡した ID で windowEnums から取り出す。
+var (
+	enumWindowsCallback = syscall.NewCallback(EnumWindowsCallback)
+	windowEnums         enumRegistry[[]WindowInfo]
+)
+
+// EnumWindowsCallback は EnumWindows API のコールバック関数です。
+// 見つかったウィンドウのハンドルとタイトルを取得し、lParam が示す呼び出しごとのリストに追加します。
+func EnumWindowsCallback(hwnd HWND, lParam uintptr) uintptr {
+	windowList := windowEnums.lookup(lParam)
+	if windowList == nil {
+		return 0 // 登録されていない呼び出しのため、列挙を中止
+	}
+
+	// ウィンドウが可視であるかチェック
+	ret, _, _ := isWindowVisibleProc.Call(uintptr(hwnd))
+	if ret == 0 { // IsWindowVisible は非表示のウィンドウでは0を返す
+		return 1 // true を返し、列挙を継続
+	}
+
+	// ウィンドウタイトルの長さを取得
+	textLen, _, _ := getWindowTextLengthProc.Call(uintptr(hwnd))
+	if textLen == 0 { // タイトルがないウィンドウはスキップ
+		return 1
+	}
+
+	// タイトルバッファの準備
+	buf := make([]uint16, textLen+1) // null終端のため+1
+
+	// ウィンドウタイトルを取得
+	getWindowTextProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(textLen+1))
+	title := syscall.UTF16ToString(buf)
+
+	if title == "" {
+		return 1
+	}
+	// システムウィンドウなどの除外は WindowFilter (DefaultWindowFilter) で行う
+
+	// EnumWindows は前面のウィンドウから順に列挙するため、追加順がそのまま重なり順になる
+	info := WindowInfo{HWND: hwnd, Title: title, ZOrder: len(*windowList)}
+	info.ClassName, info.PID, info.ProcessName = windowDetails(hwnd)
+	info.Rect, info.Minimized, info.Maximized, info.Cloaked = windowState(hwnd)
+	*windowList = append(*windowList, info)
+	return 1 // true を返し、列挙を継続
+}
+
+// windowState はウィンドウの位置とサイズ、最小化・最大化・クローク状態を取得します。
+func windowState(hwnd HWND) (rect image.Rectangle, minimized, maximized, cloaked bool) {
+	var r RECT
+	if ret, _, _ := getWindowRectProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&r))); ret != 0 {
+		rect = image.Rect(int(r.Left), int(r.Top), int(r.Right), int(r.Bottom))
+	}
+
+	ret, _, _ := isIconicProc.Call(uintptr(hwnd))
+	minimized = ret != 0
+	ret, _, _ = isZoomedProc.Call(uintptr(hwnd))
+	maximized = ret != 0
+
+	// DWMWA_CLOAKED: 別の仮想デスクトップ上のウィンドウや中断された UWP アプリは
+	// IsWindowVisible が真でも画面に描画されない
+	const DWMWA_CLOAKED = 14
+	var cloakedVal uint32
+	if dwmGetWindowAttributeProc.Find() == nil {
+		hr, _, _ := dwmGetWindowAttributeProc.Call(uintptr(hwnd), DWMWA_CLOAKED, uintptr(unsafe.Pointer(&cloakedVal)), unsafe.Sizeof(cloakedVal))
+		cloaked = hr == 0 && cloakedVal != 0
+	}
+	return rect, minimized, maximized, cloaked
+}
+
+// windowDetails はウィンドウのクラス名、所有プロセスの ID と実行ファイル名を取得します。
+// 取得できなかった項目は空 (0) のままになります。
+func windowDetails(hwnd HWND) (className string, pid uint32, processName string) {
+	classBuf := make([]uint16, 256)
+	n, _, _ := getClassNameProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&classBuf[0])), uintptr(len(classBuf)))
+	if n > 0 {
+		className = syscall.UTF16ToString(classBuf[:n])
+	}
+
+	getWindowThreadProcProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&pid)))
+	if pid == 0 {
+		return className, 0, ""
+	}
+
+	// 他のユーザーのプロセスでも実行ファイル名だけは取得できるよう、最小限の権限で開く
+	const PROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+	hProcess, _, _ := openProcessProc.Call(PROCESS_QUERY_LIMITED_INFORMATION, 0, uintptr(pid))
+	if hProcess == 0 {
+		return className, pid, ""
+	}
+	defer closeHandleProc.Call(hProcess)
+
+	pathBuf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(pathBuf))
+	ret, _, _ := queryFullProcessImageNameProc.Call(hProcess, 0, uintptr(unsafe.Pointer(&pathBuf[0])), uintptr(unsafe.Pointer(&size)))
+	if ret != 0 {
+		processName = filepath.Base(syscall.UTF16ToString(pathBuf[:size]))
+	}
+	return className, pid, processName
+}
+
+// ListWindows は現在開いているウィンドウのリストを取得します。
+// 結果は呼び出しごとに収集するため、複数の goroutine から同時に呼び出すことができます。
+func (c *GDICapturer) ListWindows() ([]WindowInfo, error) {
+	var windowList []WindowInfo
+	id := windowEnums.register(&windowList)
+	defer windowEnums.unregister(id)
+
+	// EnumWindows 関数はコールバック関数を呼び出し、すべてのトップレベルウィンドウを列挙する
+	ret, _, err := enumWindowsProc.Call(enumWindowsCallback, id)
+	if ret == 0 {
+		return nil, fmt.Errorf("EnumWindows failed: %w", err)
+	}
+	return windowList, nil
+}
+
+// WindowRect は指定されたウィンドウの現在の矩形を取得します。
+func (c *GDICapturer) WindowRect(hwnd HWND) (image.Rectangle, error) {
+	var rect RECT
+	ret, _, err := getWindowRectProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&rect)))
+	if ret == 0 {
+		return image.Rectangle{}, fmt.Errorf("GetWindowRect failed: %w", err)
+	}
+	return image.Rect(int(rect.Left), int(rect.Top), int(rect.Right), int(rect.Bottom)), nil
+}
+
+// WindowTitle は指定されたHWNDのタイトルを取得します。
+func (c *GDICapturer) WindowTitle(hwnd HWND) (string, error) {
+	textLen, _, _ := getWindowTextLengthProc.Call(uintptr(hwnd))
+	if textLen == 0 {
+		return "", nil // タイトルがない場合
+	}
+	buf := make([]uint16, textLen+1)
+	ret, _, err := getWindowTextProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(textLen+1))
+	if ret == 0 {
+		return "", fmt.Errorf("GetWindowTextW failed: %w", err)
+	}
+	return syscall.UTF16ToString(buf), nil
+}
+
+// CaptureWindow は指定されたウィンドウのスクリーンショットを撮影し、image.Imageとして返します。
+// PrintWindow API を優先的に使用します。
+func (c *GDICapturer) CaptureWindow(hwnd HWND) (image.Image, error) {
+	// 閉じられたウィンドウや最小化されたウィンドウは GetWindowRect が 0 以下の大きさを返すことがあるため、
+	// 撮影前に状態を確認して型付きのエラーを返す
+	if ret, _, _ := isWindowProc.Call(uintptr(hwnd)); ret == 0 {
+		return nil, fmt.Errorf("HWND %d: %w", hwnd, ErrWindowGone)
+	}
+	if ret, _, _ := isIconicProc.Call(uintptr(hwnd)); ret != 0 {
+		return nil, fmt.Errorf("HWND %d: %w", hwnd, ErrWindowMinimized)
+	}
+
+	var rect RECT
+	ret, _, err := getWindowRectProc.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&rect)))
+	if ret == 0 {
+		// 確認した直後に閉じられた場合
+		if ret, _, _ := isWindowProc.Call(uintptr(hwnd)); ret == 0 {
+			return nil, fmt.Errorf("HWND %d: %w", hwnd, ErrWindowGone)
+		}
+		return nil, fmt.Errorf("GetWindowRect failed: %w", err)
+	}
+
+	width := int(rect.Right - rect.Left)
+	height := int(rect.Bottom - rect.Top)
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("HWND %d has size %dx%d: %w", hwnd, width, height, ErrWindowMinimized)
+	}
+
+	// ウィンドウのDC (Device Context) を取得
+	windowDC, _, err := getWindowDCProc.Call(uintptr(hwnd))
+	if windowDC == 0 {
+		return nil, fmt.Errorf("GetWindowDC failed: %w", err)
+	}
+	defer releaseDCProc.Call(uintptr(hwnd), windowDC) // 使用後に解放
+
+	// 互換性のあるメモリDCを作成
+	memDC, _, err := createCompatibleDCSingleProc.Call(windowDC)
+	if memDC == 0 {
+		return nil, fmt.Errorf("CreateCompatibleDC failed: %w", err)
+	}
+	defer deleteDCProc.Call(memDC) // 使用後に解放
+
+	// 互換性のあるビットマップを作成
+	hBitmap, _, err := createCompatibleBitmapProc.Call(windowDC, uintptr(width), uintptr(height))
+	if hBitmap == 0 {
+		return nil, fmt.Errorf("CreateCompatibleBitmap failed: %w", err)
+	}
+	defer deleteObjectProc.Call(hBitmap) // 使用後に解放
+
+	// ビットマップをメモリDCに選択
+	oldBitmap, _, err := selectObjectProc.Call(memDC, hBitmap)
+	if oldBitmap == 0 { // oldBitmapは以前選択されていたオブジェクトのハンドル、エラーではない
+		log.Printf("SelectObject returned 0, might be an issue. Error: %v", err)
+	}
+	defer selectObjectProc.Call(memDC, oldBitmap) // 元のビットマップに戻す
+
+	// PrintWindow API を使用してウィンドウの内容をメモリDCに描画
+	// PrintWindow は BitBlt よりも信頼性が高く、最小化されたウィンドウや重なったウィンドウも正しくキャプチャできる場合がある
+	// PRF_CLIENT | PRF_NONCLIENT はクライアント領域と非クライアント領域の両方を含むことを意味する
+	const PW_RENDERFULLWINDOW = 0x00000002 // PrintWindow flags (PRF_CLIENT | PRF_NONCLIENT | PRF_ERASEBKGND | PRF_CHILDREN)
+	// ret を result に変更し、初期化子 := を使用
+	result, _, _ := printWindowProc.Call(uintptr(hwnd), memDC, PW_RENDERFULLWINDOW)
+	if result == 0 { // 修正: ret を result に変更
+		// PrintWindow が失敗した場合、BitBlt でフォールバック (ただし、BitBltは一部のシナリオで問題がある)
+		log.Printf("PrintWindow failed for HWND %d. Falling back to BitBlt. Error: %v", hwnd, err)
+		// BitBlt (Source: windowDC, Dest: memDC)
+		const SRCCOPY = 0x00CC0020
+		bitBltProc.Call(memDC, 0, 0, uintptr(width), uintptr(height), windowDC, uintptr(rect.Left), uintptr(rect.Top), SRCCOPY)
+	}
+
+	// HBITMAP から Go の image.Image に変換
+	img, err := c.bitmapToImage(HBITMAP(hBitmap), width, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert bitmap to image: %w", err)
+	}
+
+	return img, nil
+}
+
+// bitmapToImage はHBITMAPをGoのimage.Imageに変換します。
+// この部分は、より複雑なWindows APIのBitBltやGetDIBitsを使った処理が含まれます。
+// Go 1.24.4 と golang.org/x/sys を使って直接ビットマップデータにアクセスする例を示します。
+type BITMAPINFOHEADER struct {
+	BiSize          uint32
+	BiWidth         int32
+	BiHeight        int32
+	BiPlanes        uint16
+	BiBitCount      uint16
+	BiCompression   uint32
+	BiSizeImage     uint32
+	BiXPelsPerMeter int32
+	BiYPelsPerMeter int32
+	BiClrUsed       uint32
+	BiClrImportant  uint32
+}
+
+type BITMAPINFO struct {
+	BmiHeader BITMAPINFOHEADER
+	BmiColors *uint32 // RGBQUAD array, or palette
+}
+
+type HBITMAP syscall.Handle
+
+// bitmapToImage は HBITMAP のピクセルを image.RGBA にコピーし、アルファを作成時に設定された扱いに従って書き換えます。
+func (c *GDICapturer) bitmapToImage(hBitmap HBITMAP, width, height int) (image.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid bitmap size %dx%d", width, height)
+	}
+
+	// デスクトップDCを取得 (BitBlt時に必要)
+	desktopDC, _, err := getDesktopWindowProc.Call()
+	if desktopDC == 0 {
+		return nil, fmt.Errorf("GetDesktopWindow failed: %w", err)
+	}
+	desktopHDC, _, err := getWindowDCProc.Call(desktopDC)
+	if desktopHDC == 0 {
+		return nil, fmt.Errorf("GetWindowDC failed for desktop: %w", err)
+	}
+	defer releaseDCProc.Call(desktopDC, desktopHDC)
+
+	// BITMAPINFO構造体を準備
+	bmi := BITMAPINFO{
+		BmiHeader: BITMAPINFOHEADER{
+			BiSize:        uint32(unsafe.Sizeof(BITMAPINFOHEADER{})),
+			BiWidth:       int32(width),
+			BiHeight:      int32(-height), // 負の値でトップダウンDIBを指定
+			BiPlanes:      1,
+			BiBitCount:    32, // 32-bit (RGBA)
+			BiCompression: 0,  // BI_RGB (圧縮なし)
+		},
+	}
+
+	// ビットマップデータはプールのバッファに直接書き込み、その場で RGBA に並べ替える
+	img, err := bgraToImage(width, height, func(pix []byte) error {
+		// GetDIBits を呼び出してビットマップデータを取得
+		// DIB_RGB_COLORS を指定し、ビットマップをピクセルデータに変換
+		result, _, err := getDIBitsProc.Call(
+			uintptr(desktopHDC),              // HDC
+			uintptr(hBitmap),                 // HBITMAP
+			0,                                // Start Scan Line
+			uintptr(height),                  // Number of Scan Lines
+			uintptr(unsafe.Pointer(&pix[0])), // lpBits
+			uintptr(unsafe.Pointer(&bmi)),    // lpBMI
+			0x00000000,                       // DIB_RGB_COLORS
+		)
+		if result == 0 { // 修正: ret を result に変更
+			return fmt.Errorf("GetDIBits failed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// GDI はアルファを 0 のまま返すことが多いため、そのままでは透明な画像になる
+	ApplyAlphaPolicy(img, c.alpha, c.background)
+
+	return img, nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// MonitorInfo はバックエンドが列挙したモニターの情報を格納する構造体です。
+// Bounds は仮想デスクトップ座標 (プライマリモニターの左上が原点) で表されます。
+type MonitorInfo struct {
+	Index   int
+	Name    string
+	Bounds  image.Rectangle
+	Primary bool
+}
+
+// TargetKind は撮影対象の種類です。値は config.Config.CaptureTarget にそのまま保存されます。
+type TargetKind string
+
+const (
+	TargetWindow      TargetKind = "window"       // 選択されたウィンドウ
+	TargetAllMonitors TargetKind = "all_monitors" // すべてのモニターを合成した画面全体
+	TargetMonitor     TargetKind = "monitor"      // 指定された番号のモニター
+)
+
+// RegionAnchor は撮影領域の座標の基準です。
+type RegionAnchor string
+
+const (
+	AnchorScreen RegionAnchor = "screen" // 仮想デスクトップ座標
+	AnchorWindow RegionAnchor = "window" // 選択されたウィンドウの左上を原点とする座標 (ウィンドウの移動に追従する)
+)
+
+// Region は撮影対象の一部だけを切り出すための矩形です。
+type Region struct {
+	Anchor RegionAnchor
+	Rect   image.Rectangle
+}
+
+// Target は 1 回の撮影で何を撮るかを表します。
+type Target struct {
+	Kind    TargetKind
+	HWND    HWND    // Kind が TargetWindow の場合、または Region の基準がウィンドウの場合に使用
+	Monitor int     // Kind が TargetMonitor の場合に使用 (ListMonitors の Index)
+	Region  *Region // nil 以外の場合、この領域だけを撮影する
+}
+
+// Capture は指定された撮影対象のスクリーンショットを撮影します。
+// Region が指定されている場合は、エンコード前にその領域だけを切り出します。
+func Capture(c Capturer, t Target) (image.Image, error) {
+	if t.Region != nil {
+		return captureRegion(c, t.HWND, *t.Region)
+	}
+	switch t.Kind {
+	case TargetWindow, "":
+		return c.CaptureWindow(t.HWND)
+	case TargetAllMonitors:
+		return CaptureAllMonitors(c)
+	case TargetMonitor:
+		return CaptureMonitor(c, t.Monitor)
+	default:
+		return nil, fmt.Errorf("unknown capture target %q", t.Kind)
+	}
+}
+
+// CaptureAllMonitors はすべてのモニターを合成した画面全体を撮影します。
+func CaptureAllMonitors(c Capturer) (image.Image, error) {
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list monitors: %w", err)
+	}
+	var union image.Rectangle
+	for _, m := range monitors {
+		union = union.Union(m.Bounds)
+	}
+	return c.CaptureRect(union)
+}
+
+// CaptureMonitor は指定された番号のモニターを撮影します。
+func CaptureMonitor(c Capturer, index int) (image.Image, error) {
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list monitors: %w", err)
+	}
+	for _, m := range monitors {
+		if m.Index == index {
+			return c.CaptureRect(m.Bounds)
+		}
+	}
+	return nil, fmt.Errorf("monitor %d not found (%d monitors)", index, len(monitors))
+}
+
+// captureRegion は基準に応じて領域を撮影します。
+// 画面基準の場合はその領域だけを撮影し、ウィンドウ基準の場合はウィンドウを撮影してから切り出します。
+func captureRegion(c Capturer, hwnd HWND, r Region) (image.Image, error) {
+	if r.Rect.Empty() {
+		return nil, fmt.Errorf("invalid capture region %v", r.Rect)
+	}
+	switch r.Anchor {
+	case AnchorScreen, "":
+		return c.CaptureRect(r.Rect)
+	case AnchorWindow:
+		img, err := c.CaptureWindow(hwnd)
+		if err != nil {
+			return nil, err
+		}
+		// 切り出した後は元の画像を参照しないため、バッファを次の撮影に回す
+		defer ReleaseImage(img)
+		clip := r.Rect.Intersect(img.Bounds())
+		if clip.Empty() {
+			return nil, fmt.Errorf("capture region %v is outside the window %v", r.Rect, img.Bounds())
+		}
+		out := cropImage(img, clip)
+		// 領域の一部がウィンドウの撮影できた部分の外にある場合は、切り出した画像の領域上の位置を Bounds の Min で示す
+		out.Rect = out.Rect.Add(clip.Min.Sub(r.Rect.Min))
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown region anchor %q", r.Anchor)
+	}
+}
+
+// cropImage は画像の指定領域を原点 (0, 0) から始まる新しい image.RGBA にコピーします。
+func cropImage(img image.Image, r image.Rectangle) *image.RGBA {
+	r = r.Intersect(img.Bounds())
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
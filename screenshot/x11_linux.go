@@ -0,0 +1,608 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// X11 プロトコルのリクエストオペコード
+const (
+	x11OpGetWindowAttributes  = 3
+	x11OpGetGeometry          = 14
+	x11OpQueryTree            = 15
+	x11OpInternAtom           = 16
+	x11OpGetAtomName          = 17
+	x11OpGetProperty          = 20
+	x11OpTranslateCoordinates = 40
+	x11OpGetImage             = 73
+	x11OpQueryExtension       = 98
+)
+
+// RandR 拡張のマイナーオペコード
+const (
+	randrOpQueryVersion = 0
+	randrOpGetMonitors  = 42
+)
+
+// X11 のエラーコード (必要なもののみ)
+const (
+	x11ErrWindow   = 3
+	x11ErrMatch    = 8
+	x11ErrDrawable = 9
+)
+
+const (
+	x11MapStateViewable = 2
+
+	x11ImageFormatZPixmap = 2
+	x11LSBFirst           = 0
+)
+
+// x11Error は X サーバーから返されたエラーを表します。
+type x11Error struct {
+	Code     byte
+	Major    byte
+	BadValue uint32
+}
+
+func (e *x11Error) Error() string {
+	return fmt.Sprintf("X11 error code %d (request %d, value 0x%x)", e.Code, e.Major, e.BadValue)
+}
+
+// x11Visual は画面がサポートするビジュアル (ピクセルの色表現) の情報です。
+type x11Visual struct {
+	Depth     byte
+	RedMask   uint32
+	GreenMask uint32
+	BlueMask  uint32
+}
+
+// x11Screen は接続先ディスプレイのスクリーン情報です。
+type x11Screen struct {
+	Root    uint32
+	Width   uint16
+	Height  uint16
+	Visuals map[uint32]x11Visual
+}
+
+// x11Conn は X サーバーへの最小限のクライアント接続です。
+// ウィンドウの列挙と GetImage に必要なリクエストのみを実装しています。
+// すべてのリクエストは mu の下で送信と応答の受信を同期的に行います。
+type x11Conn struct {
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	seq  uint16
+
+	imageByteOrder byte
+	pixmapBPP      map[byte]byte // depth -> bits-per-pixel
+	scanlinePad    map[byte]byte // depth -> scanline-pad
+	screen         x11Screen
+	atoms          map[string]uint32
+	idBase, idMask uint32 // 新しいリソース (ウィンドウなど) の ID の割り当て範囲
+	randrOpcode    byte   // RandR 1.5 が利用可能な場合のメジャーオペコード (0 は未確認または利用不可)
+	randrChecked   bool
+}
+
+// dialX11 は DISPLAY で指定された X サーバーに接続し、コネクションセットアップを行います。
+func dialX11(display string) (*x11Conn, error) {
+	if display == "" {
+		return nil, errors.New("DISPLAY is not set")
+	}
+	network, address, displayNum, screenNum, err := parseX11Display(display)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server %s: %w", display, err)
+	}
+
+	c := &x11Conn{
+		conn:        conn,
+		r:           bufio.NewReaderSize(conn, 64*1024),
+		pixmapBPP:   make(map[byte]byte),
+		scanlinePad: make(map[byte]byte),
+		atoms:       make(map[string]uint32),
+	}
+
+	authName, authData := readXauthority(displayNum)
+	if err := c.setup(authName, authData, screenNum); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseX11Display は ":0", ":1.0", "unix:0", "host:0" 形式の DISPLAY を解析します。
+func parseX11Display(display string) (network, address, displayNum string, screenNum int, err error) {
+	// launchd などが設定するソケットパス形式 (/tmp/.X11-unix/X0 など)
+	if strings.HasPrefix(display, "/") {
+		base := filepath.Base(display)
+		if i := strings.LastIndex(base, ":"); i >= 0 {
+			base = base[i+1:]
+		}
+		return "unix", display, strings.TrimPrefix(base, "X"), 0, nil
+	}
+
+	colon := strings.LastIndex(display, ":")
+	if colon < 0 {
+		return "", "", "", 0, fmt.Errorf("invalid DISPLAY %q", display)
+	}
+	host := display[:colon]
+	displayNum = display[colon+1:]
+	if dot := strings.Index(displayNum, "."); dot >= 0 {
+		screenNum, err = strconv.Atoi(displayNum[dot+1:])
+		if err != nil {
+			return "", "", "", 0, fmt.Errorf("invalid screen number in DISPLAY %q", display)
+		}
+		displayNum = displayNum[:dot]
+	}
+	n, err := strconv.Atoi(displayNum)
+	if err != nil || n < 0 {
+		return "", "", "", 0, fmt.Errorf("invalid display number in DISPLAY %q", display)
+	}
+
+	if host == "" || host == "unix" {
+		return "unix", fmt.Sprintf("/tmp/.X11-unix/X%d", n), displayNum, screenNum, nil
+	}
+	return "tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)), displayNum, screenNum, nil
+}
+
+// readXauthority は Xauthority ファイルから該当ディスプレイの MIT-MAGIC-COOKIE-1 を探します。
+// 見つからない場合は空の認証情報を返します (xhost などで許可されている場合はそのまま接続できます)。
+func readXauthority(displayNum string) (name string, data []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".Xauthority")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil
+	}
+	defer f.Close()
+
+	hostname, _ := os.Hostname()
+	r := bufio.NewReader(f)
+	readField := func() ([]byte, error) {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+
+	const (
+		familyLocal = 256
+		familyWild  = 65535
+	)
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			return "", nil
+		}
+		addr, err := readField()
+		if err != nil {
+			return "", nil
+		}
+		num, err := readField()
+		if err != nil {
+			return "", nil
+		}
+		authName, err := readField()
+		if err != nil {
+			return "", nil
+		}
+		authData, err := readField()
+		if err != nil {
+			return "", nil
+		}
+
+		if family != familyWild && !(family == familyLocal && string(addr) == hostname) {
+			continue
+		}
+		if len(num) > 0 && string(num) != displayNum {
+			continue
+		}
+		if string(authName) == "MIT-MAGIC-COOKIE-1" {
+			return string(authName), authData
+		}
+	}
+}
+
+// pad4 は n を 4 バイト境界に揃えるためのパディング長を返します。
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+// setup は X11 のコネクションセットアップを行い、スクリーン情報を読み込みます。
+func (c *x11Conn) setup(authName string, authData []byte, screenNum int) error {
+	le := binary.LittleEndian
+	req := make([]byte, 12, 12+len(authName)+pad4(len(authName))+len(authData)+pad4(len(authData)))
+	req[0] = 'l' // リトルエンディアン
+	le.PutUint16(req[2:], 11)
+	le.PutUint16(req[4:], 0)
+	le.PutUint16(req[6:], uint16(len(authName)))
+	le.PutUint16(req[8:], uint16(len(authData)))
+	req = append(req, authName...)
+	req = append(req, make([]byte, pad4(len(authName)))...)
+	req = append(req, authData...)
+	req = append(req, make([]byte, pad4(len(authData)))...)
+	if _, err := c.conn.Write(req); err != nil {
+		return fmt.Errorf("failed to send X11 setup request: %w", err)
+	}
+
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(c.r, head); err != nil {
+		return fmt.Errorf("failed to read X11 setup reply: %w", err)
+	}
+	body := make([]byte, int(le.Uint16(head[6:]))*4)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return fmt.Errorf("failed to read X11 setup reply: %w", err)
+	}
+	switch head[0] {
+	case 1:
+		// 成功
+	case 0:
+		reason := body
+		if n := int(head[1]); n <= len(reason) {
+			reason = reason[:n]
+		}
+		return fmt.Errorf("X11 connection refused: %s", strings.TrimSpace(string(reason)))
+	default:
+		return errors.New("X11 connection requires further authentication")
+	}
+
+	if len(body) < 32 {
+		return errors.New("X11 setup reply too short")
+	}
+	c.idBase, c.idMask = le.Uint32(body[4:]), le.Uint32(body[8:])
+	vendorLen := int(le.Uint16(body[16:]))
+	numScreens := int(body[20])
+	numFormats := int(body[21])
+	c.imageByteOrder = body[22]
+
+	off := 32 + vendorLen + pad4(vendorLen)
+	for i := 0; i < numFormats; i++ {
+		if off+8 > len(body) {
+			return errors.New("X11 setup reply truncated (formats)")
+		}
+		c.pixmapBPP[body[off]] = body[off+1]
+		c.scanlinePad[body[off]] = body[off+2]
+		off += 8
+	}
+
+	if screenNum >= numScreens {
+		return fmt.Errorf("X11 screen %d does not exist (%d screens)", screenNum, numScreens)
+	}
+	for i := 0; i <= screenNum; i++ {
+		if off+40 > len(body) {
+			return errors.New("X11 setup reply truncated (screens)")
+		}
+		scr := x11Screen{
+			Root:    le.Uint32(body[off:]),
+			Width:   le.Uint16(body[off+20:]),
+			Height:  le.Uint16(body[off+22:]),
+			Visuals: make(map[uint32]x11Visual),
+		}
+		numDepths := int(body[off+39])
+		off += 40
+		for d := 0; d < numDepths; d++ {
+			if off+8 > len(body) {
+				return errors.New("X11 setup reply truncated (depths)")
+			}
+			depth := body[off]
+			numVisuals := int(le.Uint16(body[off+2:]))
+			off += 8
+			for v := 0; v < numVisuals; v++ {
+				if off+24 > len(body) {
+					return errors.New("X11 setup reply truncated (visuals)")
+				}
+				scr.Visuals[le.Uint32(body[off:])] = x11Visual{
+					Depth:     depth,
+					RedMask:   le.Uint32(body[off+8:]),
+					GreenMask: le.Uint32(body[off+12:]),
+					BlueMask:  le.Uint32(body[off+16:]),
+				}
+				off += 24
+			}
+		}
+		c.screen = scr
+	}
+	return nil
+}
+
+// Close は X サーバーとの接続を閉じます。
+func (c *x11Conn) Close() error {
+	return c.conn.Close()
+}
+
+// roundTrip はリクエストを送信し、対応する応答 (32 バイトのヘッダーと追加データ) を返します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) roundTrip(req []byte) ([]byte, error) {
+	le := binary.LittleEndian
+	le.PutUint16(req[2:], uint16(len(req)/4))
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, fmt.Errorf("failed to send X11 request %d: %w", req[0], err)
+	}
+	c.seq++
+
+	head := make([]byte, 32)
+	for {
+		if _, err := io.ReadFull(c.r, head); err != nil {
+			return nil, fmt.Errorf("failed to read X11 reply: %w", err)
+		}
+		switch head[0] {
+		case 0: // エラー
+			if le.Uint16(head[2:]) != c.seq {
+				continue
+			}
+			return nil, &x11Error{Code: head[1], Major: head[10], BadValue: le.Uint32(head[4:])}
+		case 1: // 応答 (GetImage の応答は大きいため、ヘッダーと追加データを一度に確保する)
+			reply := make([]byte, 32+int(le.Uint32(head[4:]))*4)
+			copy(reply, head)
+			if _, err := io.ReadFull(c.r, reply[32:]); err != nil {
+				return nil, fmt.Errorf("failed to read X11 reply: %w", err)
+			}
+			if le.Uint16(head[2:]) != c.seq {
+				continue
+			}
+			return reply, nil
+		case 35: // GenericEvent は追加データを持つ
+			if _, err := c.r.Discard(int(le.Uint32(head[4:])) * 4); err != nil {
+				return nil, fmt.Errorf("failed to read X11 event: %w", err)
+			}
+		default:
+			// イベントは選択していないが、届いた場合は読み捨てる
+		}
+	}
+}
+
+// internAtom は名前に対応する Atom を取得します (キャッシュ付き)。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) internAtom(name string) (uint32, error) {
+	if atom, ok := c.atoms[name]; ok {
+		return atom, nil
+	}
+	req := make([]byte, 8, 8+len(name)+pad4(len(name)))
+	req[0] = x11OpInternAtom
+	req[1] = 0 // only-if-exists = false
+	binary.LittleEndian.PutUint16(req[4:], uint16(len(name)))
+	req = append(req, name...)
+	req = append(req, make([]byte, pad4(len(name)))...)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return 0, fmt.Errorf("InternAtom %s failed: %w", name, err)
+	}
+	atom := binary.LittleEndian.Uint32(reply[8:])
+	c.atoms[name] = atom
+	return atom, nil
+}
+
+// getProperty はウィンドウのプロパティ値を取得します。プロパティが存在しない場合は nil を返します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) getProperty(window, property uint32) (value []byte, format byte, err error) {
+	le := binary.LittleEndian
+	req := make([]byte, 24)
+	req[0] = x11OpGetProperty
+	le.PutUint32(req[4:], window)
+	le.PutUint32(req[8:], property)
+	le.PutUint32(req[12:], 0)     // AnyPropertyType
+	le.PutUint32(req[16:], 0)     // long-offset
+	le.PutUint32(req[20:], 1<<24) // long-length (十分に大きな値)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	format = reply[1]
+	if le.Uint32(reply[8:]) == 0 { // type None: プロパティが存在しない
+		return nil, format, nil
+	}
+	n := int(le.Uint32(reply[16:])) * int(format) / 8
+	if 32+n > len(reply) {
+		return nil, format, errors.New("GetProperty reply truncated")
+	}
+	return reply[32 : 32+n], format, nil
+}
+
+// windowAttributes はウィンドウのビジュアルとマップ状態を取得します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) windowAttributes(window uint32) (visual uint32, mapState byte, err error) {
+	req := make([]byte, 8)
+	req[0] = x11OpGetWindowAttributes
+	binary.LittleEndian.PutUint32(req[4:], window)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	return binary.LittleEndian.Uint32(reply[8:]), reply[26], nil
+}
+
+// geometry はウィンドウのサイズと深度を取得します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) geometry(window uint32) (width, height int, depth byte, err error) {
+	req := make([]byte, 8)
+	req[0] = x11OpGetGeometry
+	binary.LittleEndian.PutUint32(req[4:], window)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	le := binary.LittleEndian
+	return int(le.Uint16(reply[16:])), int(le.Uint16(reply[18:])), reply[1], nil
+}
+
+// translateToRoot はウィンドウの原点をルートウィンドウ座標に変換します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) translateToRoot(window uint32) (x, y int, err error) {
+	le := binary.LittleEndian
+	req := make([]byte, 16)
+	req[0] = x11OpTranslateCoordinates
+	le.PutUint32(req[4:], window)
+	le.PutUint32(req[8:], c.screen.Root)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(int16(le.Uint16(reply[12:]))), int(int16(le.Uint16(reply[14:]))), nil
+}
+
+// queryTree はウィンドウの子ウィンドウ (重なり順で下から上) を返します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) queryTree(window uint32) ([]uint32, error) {
+	le := binary.LittleEndian
+	req := make([]byte, 8)
+	req[0] = x11OpQueryTree
+	le.PutUint32(req[4:], window)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	n := int(le.Uint16(reply[16:]))
+	if 32+n*4 > len(reply) {
+		return nil, errors.New("QueryTree reply truncated")
+	}
+	children := make([]uint32, n)
+	for i := range children {
+		children[i] = le.Uint32(reply[32+i*4:])
+	}
+	return children, nil
+}
+
+// getImage は描画可能オブジェクトの指定領域を ZPixmap 形式で取得します。
+// 戻り値はピクセルデータ、深度、ビジュアル ID です。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) getImage(drawable uint32, x, y, width, height int) (data []byte, depth byte, visual uint32, err error) {
+	le := binary.LittleEndian
+	req := make([]byte, 20)
+	req[0] = x11OpGetImage
+	req[1] = x11ImageFormatZPixmap
+	le.PutUint32(req[4:], drawable)
+	le.PutUint16(req[8:], uint16(int16(x)))
+	le.PutUint16(req[10:], uint16(int16(y)))
+	le.PutUint16(req[12:], uint16(width))
+	le.PutUint16(req[14:], uint16(height))
+	le.PutUint32(req[16:], 0xFFFFFFFF) // plane-mask: すべてのプレーン
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return reply[32:], reply[1], le.Uint32(reply[8:]), nil
+}
+
+// queryExtension は拡張が存在するか確認し、そのメジャーオペコードを返します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) queryExtension(name string) (opcode byte, present bool, err error) {
+	req := make([]byte, 8, 8+len(name)+pad4(len(name)))
+	req[0] = x11OpQueryExtension
+	binary.LittleEndian.PutUint16(req[4:], uint16(len(name)))
+	req = append(req, name...)
+	req = append(req, make([]byte, pad4(len(name)))...)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return 0, false, err
+	}
+	return reply[9], reply[8] != 0, nil
+}
+
+// randr は RandR 1.5 (モニター一覧の取得に必要) のメジャーオペコードを返します。
+// 利用できない場合は 0 を返します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) randr() (byte, error) {
+	if c.randrChecked {
+		return c.randrOpcode, nil
+	}
+	opcode, present, err := c.queryExtension("RANDR")
+	if err != nil {
+		return 0, err
+	}
+	c.randrChecked = true
+	if !present {
+		return 0, nil
+	}
+
+	// 新しいリクエストを使う前に、クライアントが対応するバージョンを通知する
+	le := binary.LittleEndian
+	req := make([]byte, 12)
+	req[0] = opcode
+	req[1] = randrOpQueryVersion
+	le.PutUint32(req[4:], 1)
+	le.PutUint32(req[8:], 5)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	major, minor := le.Uint32(reply[8:]), le.Uint32(reply[12:])
+	if major > 1 || (major == 1 && minor >= 5) {
+		c.randrOpcode = opcode
+	}
+	return c.randrOpcode, nil
+}
+
+// randrMonitors は RRGetMonitors でアクティブなモニターの位置とサイズを取得します。
+// 戻り値の名前は Atom のままです。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) randrMonitors(opcode byte) (names []uint32, rects []image.Rectangle, primary []bool, err error) {
+	le := binary.LittleEndian
+	req := make([]byte, 12)
+	req[0] = opcode
+	req[1] = randrOpGetMonitors
+	le.PutUint32(req[4:], c.screen.Root)
+	req[8] = 1 // get-active
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	n := int(le.Uint32(reply[12:]))
+	off := 32
+	for i := 0; i < n; i++ {
+		if off+24 > len(reply) {
+			return nil, nil, nil, errors.New("RRGetMonitors reply truncated")
+		}
+		x := int(int16(le.Uint16(reply[off+8:])))
+		y := int(int16(le.Uint16(reply[off+10:])))
+		w := int(le.Uint16(reply[off+12:]))
+		h := int(le.Uint16(reply[off+14:]))
+		names = append(names, le.Uint32(reply[off:]))
+		primary = append(primary, reply[off+4] != 0)
+		rects = append(rects, image.Rect(x, y, x+w, y+h))
+		off += 24 + int(le.Uint16(reply[off+6:]))*4
+	}
+	return names, rects, primary, nil
+}
+
+// atomName は Atom の名前を取得します。
+// 呼び出し側で mu を保持している必要があります。
+func (c *x11Conn) atomName(atom uint32) (string, error) {
+	req := make([]byte, 8)
+	req[0] = x11OpGetAtomName
+	binary.LittleEndian.PutUint32(req[4:], atom)
+	reply, err := c.roundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	n := int(binary.LittleEndian.Uint16(reply[8:]))
+	if 32+n > len(reply) {
+		return "", errors.New("GetAtomName reply truncated")
+	}
+	return string(reply[32 : 32+n]), nil
+}
@@ -0,0 +1,427 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// X11Capturer は X サーバーと直接通信してウィンドウを列挙・撮影する Capturer の実装です。
+// ウィンドウハンドル (HWND) には X のウィンドウ ID を使用します。
+type X11Capturer struct {
+	conn *x11Conn
+}
+
+// NewX11Capturer は display (空の場合は環境変数 DISPLAY) の X サーバーに接続します。
+func NewX11Capturer(display string) (*X11Capturer, error) {
+	conn, err := dialX11(display)
+	if err != nil {
+		return nil, err
+	}
+	return &X11Capturer{conn: conn}, nil
+}
+
+// Close は X サーバーとの接続を閉じます。
+func (c *X11Capturer) Close() error {
+	return c.conn.Close()
+}
+
+// ListWindows は現在開いているウィンドウのリストを、前面のウィンドウから順に取得します。
+// ウィンドウマネージャーが管理する _NET_CLIENT_LIST_STACKING (または _NET_CLIENT_LIST) を優先し、
+// ウィンドウマネージャーがない場合 (Xvfb など) はルートウィンドウの子を列挙します。
+func (c *X11Capturer) ListWindows() ([]WindowInfo, error) {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+
+	// _NET_CLIENT_LIST_STACKING は背面から前面の順に並んでいる
+	ids, managed, err := c.windowIDs("_NET_CLIENT_LIST_STACKING")
+	if err != nil {
+		return nil, err
+	}
+	if !managed {
+		ids, managed, err = c.windowIDs("_NET_CLIENT_LIST")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !managed {
+		// QueryTree も背面から前面の順に子ウィンドウを返す
+		ids, err = c.conn.queryTree(c.conn.screen.Root)
+		if err != nil {
+			return nil, fmt.Errorf("QueryTree failed: %w", err)
+		}
+	}
+
+	var list []WindowInfo
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		// 列挙中に閉じられたウィンドウはここで除外される
+		_, mapState, err := c.conn.windowAttributes(id)
+		if err != nil {
+			continue
+		}
+		viewable := mapState == x11MapStateViewable
+		// ウィンドウマネージャーがない場合、マップされていないウィンドウは内部用のものなので除外する
+		if !managed && !viewable {
+			continue
+		}
+
+		title, err := c.title(id)
+		if err != nil || title == "" { // タイトルがないウィンドウはスキップ
+			continue
+		}
+		info := WindowInfo{HWND: HWND(id), Title: title, ZOrder: len(list)}
+		info.ClassName, info.PID, info.ProcessName = c.details(id)
+		info.Minimized, info.Maximized = c.wmState(id)
+		// 最小化されていないのにマップされていないウィンドウは、別の仮想デスクトップ上にある
+		info.Cloaked = !viewable && !info.Minimized
+		if width, height, _, err := c.conn.geometry(id); err == nil {
+			if x, y, err := c.conn.translateToRoot(id); err == nil {
+				info.Rect = image.Rect(x, y, x+width, y+height)
+			}
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// windowIDs はルートウィンドウのウィンドウ ID リストのプロパティを読み込みます。
+// プロパティが存在しない場合は ok に false を返します。
+// 呼び出し側で conn.mu を保持している必要があります。
+func (c *X11Capturer) windowIDs(property string) (ids []uint32, ok bool, err error) {
+	atom, err := c.conn.internAtom(property)
+	if err != nil {
+		return nil, false, err
+	}
+	value, format, err := c.conn.getProperty(c.conn.screen.Root, atom)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get %s: %w", property, err)
+	}
+	if value == nil || format != 32 {
+		return nil, false, nil
+	}
+	for i := 0; i+4 <= len(value); i += 4 {
+		ids = append(ids, binary.LittleEndian.Uint32(value[i:]))
+	}
+	return ids, true, nil
+}
+
+// wmState は _NET_WM_STATE から最小化・最大化の状態を取得します。
+// 呼び出し側で conn.mu を保持している必要があります。
+func (c *X11Capturer) wmState(window uint32) (minimized, maximized bool) {
+	stateAtom, err := c.conn.internAtom("_NET_WM_STATE")
+	if err != nil {
+		return false, false
+	}
+	value, format, err := c.conn.getProperty(window, stateAtom)
+	if err != nil || format != 32 {
+		return false, false
+	}
+	hidden, _ := c.conn.internAtom("_NET_WM_STATE_HIDDEN")
+	maxVert, _ := c.conn.internAtom("_NET_WM_STATE_MAXIMIZED_VERT")
+	maxHorz, _ := c.conn.internAtom("_NET_WM_STATE_MAXIMIZED_HORZ")
+
+	var vert, horz bool
+	for i := 0; i+4 <= len(value); i += 4 {
+		switch binary.LittleEndian.Uint32(value[i:]) {
+		case hidden:
+			minimized = true
+		case maxVert:
+			vert = true
+		case maxHorz:
+			horz = true
+		}
+	}
+	return minimized, vert && horz
+}
+
+// details は WM_CLASS と _NET_WM_PID からクラス名とプロセスの情報を取得します。
+// 取得できなかった項目は空 (0) のままになります。
+// 呼び出し側で conn.mu を保持している必要があります。
+func (c *X11Capturer) details(window uint32) (className string, pid uint32, processName string) {
+	if atom, err := c.conn.internAtom("WM_CLASS"); err == nil {
+		// WM_CLASS は "インスタンス名\0クラス名\0" の形式
+		if value, _, err := c.conn.getProperty(window, atom); err == nil {
+			parts := strings.Split(strings.TrimRight(string(value), "\x00"), "\x00")
+			className = parts[len(parts)-1]
+		}
+	}
+	if atom, err := c.conn.internAtom("_NET_WM_PID"); err == nil {
+		if value, format, err := c.conn.getProperty(window, atom); err == nil && format == 32 && len(value) >= 4 {
+			pid = binary.LittleEndian.Uint32(value)
+		}
+	}
+	if pid != 0 {
+		// 同じホスト上のプロセスであれば /proc から実行ファイル名を取得できる
+		if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+			processName = filepath.Base(exe)
+		}
+	}
+	return className, pid, processName
+}
+
+// WindowRect は指定されたウィンドウの現在の矩形をルートウィンドウ座標で取得します。
+func (c *X11Capturer) WindowRect(hwnd HWND) (image.Rectangle, error) {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+
+	window := uint32(hwnd)
+	width, height, _, err := c.conn.geometry(window)
+	if err != nil {
+		return image.Rectangle{}, windowGoneOr(window, fmt.Errorf("GetGeometry failed: %w", err))
+	}
+	x, y, err := c.conn.translateToRoot(window)
+	if err != nil {
+		return image.Rectangle{}, windowGoneOr(window, fmt.Errorf("TranslateCoordinates failed: %w", err))
+	}
+	return image.Rect(x, y, x+width, y+height), nil
+}
+
+// WindowTitle は指定されたウィンドウのタイトルを取得します。
+func (c *X11Capturer) WindowTitle(hwnd HWND) (string, error) {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+	return c.title(uint32(hwnd))
+}
+
+// title は _NET_WM_NAME (UTF-8) を優先し、なければ WM_NAME からタイトルを取得します。
+// 呼び出し側で conn.mu を保持している必要があります。
+func (c *X11Capturer) title(window uint32) (string, error) {
+	for _, name := range []string{"_NET_WM_NAME", "WM_NAME"} {
+		atom, err := c.conn.internAtom(name)
+		if err != nil {
+			return "", err
+		}
+		value, _, err := c.conn.getProperty(window, atom)
+		if err != nil {
+			return "", fmt.Errorf("failed to get %s: %w", name, err)
+		}
+		if len(value) > 0 {
+			return string(value), nil
+		}
+	}
+	return "", nil
+}
+
+// CaptureWindow は指定されたウィンドウのスクリーンショットを GetImage で撮影し、image.Imageとして返します。
+// ウィンドウの一部が画面外にある場合は画面内の部分だけを返し、画像の Bounds の Min をウィンドウ上の位置にします。
+func (c *X11Capturer) CaptureWindow(hwnd HWND) (image.Image, error) {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+
+	window := uint32(hwnd)
+	// マップされていない (最小化された) ウィンドウに GetImage を送ると BadMatch になるため、先に状態を確認する
+	_, mapState, err := c.conn.windowAttributes(window)
+	if err != nil {
+		return nil, windowGoneOr(window, fmt.Errorf("GetWindowAttributes failed: %w", err))
+	}
+	if mapState != x11MapStateViewable {
+		return nil, fmt.Errorf("window 0x%x is not mapped: %w", window, ErrWindowMinimized)
+	}
+
+	width, height, _, err := c.conn.geometry(window)
+	if err != nil {
+		return nil, windowGoneOr(window, fmt.Errorf("GetGeometry failed: %w", err))
+	}
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("window 0x%x has zero size: %w", window, ErrWindowMinimized)
+	}
+
+	data, depth, visual, err := c.conn.getImage(window, 0, 0, width, height)
+	var offset image.Point // 画像の左上のウィンドウ上の位置
+	var xerr *x11Error
+	if errors.As(err, &xerr) && xerr.Code == x11ErrMatch {
+		// ウィンドウの一部が画面外にある場合、GetImage は BadMatch を返す。
+		// その場合はルートウィンドウから画面内に収まる部分を切り出す。
+		data, depth, visual, offset, width, height, err = c.captureFromRoot(window, width, height)
+	}
+	if err != nil {
+		return nil, windowGoneOr(window, fmt.Errorf("GetImage failed: %w", err))
+	}
+
+	img, err := c.conn.toImage(data, depth, visual, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert X image: %w", err)
+	}
+	// 切り出した場合もマスクなどがウィンドウ上の正しい位置に適用されるよう、座標をウィンドウに合わせる
+	img.Rect = img.Rect.Add(offset)
+	return img, nil
+}
+
+// windowGoneOr は err がウィンドウが存在しないことを示す X エラー (BadWindow / BadDrawable) であれば
+// ErrWindowGone を、それ以外の場合は err をそのまま返します。
+func windowGoneOr(window uint32, err error) error {
+	var xerr *x11Error
+	if errors.As(err, &xerr) && (xerr.Code == x11ErrWindow || xerr.Code == x11ErrDrawable) {
+		return fmt.Errorf("window 0x%x: %w", window, ErrWindowGone)
+	}
+	return err
+}
+
+// captureFromRoot はウィンドウの領域を画面内にクリップし、ルートウィンドウから取得します。
+// offset は取得した領域の左上のウィンドウ上の位置です (左端や上端が画面外の場合に (0, 0) でなくなります)。
+// 呼び出し側で conn.mu を保持している必要があります。
+func (c *X11Capturer) captureFromRoot(window uint32, width, height int) (data []byte, depth byte, visual uint32, offset image.Point, w, h int, err error) {
+	x, y, err := c.conn.translateToRoot(window)
+	if err != nil {
+		return nil, 0, 0, image.Point{}, 0, 0, err
+	}
+	r := image.Rect(x, y, x+width, y+height).Intersect(image.Rect(0, 0, int(c.conn.screen.Width), int(c.conn.screen.Height)))
+	if r.Empty() {
+		return nil, 0, 0, image.Point{}, 0, 0, fmt.Errorf("window 0x%x is entirely off screen", window)
+	}
+	data, depth, visual, err = c.conn.getImage(c.conn.screen.Root, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	return data, depth, visual, r.Min.Sub(image.Pt(x, y)), r.Dx(), r.Dy(), err
+}
+
+// ListMonitors は RandR でモニターの一覧を取得します。
+// RandR 1.5 が利用できない場合は、スクリーン全体を 1 つのモニターとして返します。
+func (c *X11Capturer) ListMonitors() ([]MonitorInfo, error) {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+
+	screen := image.Rect(0, 0, int(c.conn.screen.Width), int(c.conn.screen.Height))
+	opcode, err := c.conn.randr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query RandR: %w", err)
+	}
+	if opcode == 0 {
+		return []MonitorInfo{{Index: 0, Name: "Screen", Bounds: screen, Primary: true}}, nil
+	}
+
+	names, rects, primary, err := c.conn.randrMonitors(opcode)
+	if err != nil {
+		return nil, fmt.Errorf("RRGetMonitors failed: %w", err)
+	}
+	if len(rects) == 0 {
+		return []MonitorInfo{{Index: 0, Name: "Screen", Bounds: screen, Primary: true}}, nil
+	}
+	monitors := make([]MonitorInfo, len(rects))
+	for i := range rects {
+		name, err := c.conn.atomName(names[i])
+		if err != nil {
+			name = fmt.Sprintf("Monitor %d", i)
+		}
+		monitors[i] = MonitorInfo{Index: i, Name: name, Bounds: rects[i], Primary: primary[i]}
+	}
+	return monitors, nil
+}
+
+// CaptureRect はルートウィンドウから指定された領域を撮影します。
+// 領域はスクリーンの範囲内にクリップされます。
+func (c *X11Capturer) CaptureRect(rect image.Rectangle) (image.Image, error) {
+	c.conn.mu.Lock()
+	defer c.conn.mu.Unlock()
+
+	r := rect.Intersect(image.Rect(0, 0, int(c.conn.screen.Width), int(c.conn.screen.Height)))
+	if r.Empty() {
+		return nil, fmt.Errorf("capture rect %v is outside the screen", rect)
+	}
+	data, depth, visual, err := c.conn.getImage(c.conn.screen.Root, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	if err != nil {
+		return nil, fmt.Errorf("GetImage failed: %w", err)
+	}
+	img, err := c.conn.toImage(data, depth, visual, r.Dx(), r.Dy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert X image: %w", err)
+	}
+	return img, nil
+}
+
+// toImage は ZPixmap 形式のピクセルデータを image.RGBA に変換します。
+func (c *x11Conn) toImage(data []byte, depth byte, visual uint32, width, height int) (*image.RGBA, error) {
+	bpp := int(c.pixmapBPP[depth])
+	if bpp != 24 && bpp != 32 {
+		return nil, fmt.Errorf("unsupported pixmap format: depth %d, %d bits per pixel", depth, bpp)
+	}
+	pad := int(c.scanlinePad[depth])
+	if pad == 0 {
+		pad = 32
+	}
+	stride := (width*bpp + pad - 1) / pad * pad / 8
+	if len(data) < stride*height {
+		return nil, fmt.Errorf("image data too short: got %d bytes, want %d", len(data), stride*height)
+	}
+
+	v, ok := c.screen.Visuals[visual]
+	if !ok {
+		v = x11Visual{Depth: depth, RedMask: 0xFF0000, GreenMask: 0x00FF00, BlueMask: 0x0000FF}
+	}
+	alphaMask := uint32(0)
+	if depth == 32 {
+		alphaMask = ^(v.RedMask | v.GreenMask | v.BlueMask)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if c.imageByteOrder != x11LSBFirst {
+		order = binary.BigEndian
+	}
+	bytesPP := bpp / 8
+
+	img := newPooledRGBA(width, height)
+
+	// 一般的な 32 ビット BGRX 形式の場合は、行ごとにコピーしてから B と R をその場で入れ替える
+	if bytesPP == 4 && order == binary.LittleEndian &&
+		v.RedMask == 0xFF0000 && v.GreenMask == 0x00FF00 && v.BlueMask == 0x0000FF {
+		for y := 0; y < height; y++ {
+			dst := img.Pix[y*img.Stride : y*img.Stride+width*4]
+			copy(dst, data[y*stride:])
+			swapRedBlue(dst)
+			if alphaMask != 0xFF000000 {
+				for i := 3; i < len(dst); i += 4 {
+					dst[i] = 0xFF
+				}
+			}
+		}
+		return img, nil
+	}
+
+	for y := 0; y < height; y++ {
+		row := data[y*stride:]
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			var p uint32
+			if bytesPP == 4 {
+				p = order.Uint32(row[x*4:])
+			} else if order == binary.LittleEndian {
+				p = uint32(row[x*3]) | uint32(row[x*3+1])<<8 | uint32(row[x*3+2])<<16
+			} else {
+				p = uint32(row[x*3])<<16 | uint32(row[x*3+1])<<8 | uint32(row[x*3+2])
+			}
+			dst[x*4] = scaleChannel(p, v.RedMask)
+			dst[x*4+1] = scaleChannel(p, v.GreenMask)
+			dst[x*4+2] = scaleChannel(p, v.BlueMask)
+			if alphaMask != 0 {
+				dst[x*4+3] = scaleChannel(p, alphaMask)
+			} else {
+				dst[x*4+3] = 0xFF
+			}
+		}
+	}
+	return img, nil
+}
+
+// scaleChannel はマスクで指定されたチャンネルの値を取り出し、8 ビットに正規化します。
+func scaleChannel(p, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	width := bits.OnesCount32(mask)
+	v := (p & mask) >> shift
+	switch {
+	case width == 8:
+		return uint8(v)
+	case width > 8:
+		return uint8(v >> (width - 8))
+	default:
+		return uint8(v * 255 / (1<<width - 1))
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2025 SeeKT
+// This source code is licensed under the MIT license found in the LICENSE file in the root directory of this source tree.
+package screenshot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Xvfb のスクリーンの大きさ
+const (
+	xvfbWidth  = 320
+	xvfbHeight = 240
+)
+
+// startXvfb はテスト用の Xvfb を空いているディスプレイ番号で起動し、接続した X11Capturer を返します。
+// Xvfb がインストールされていない場合はテストをスキップします。
+func startXvfb(t *testing.T) *X11Capturer {
+	t.Helper()
+	xvfb, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb is not installed")
+	}
+	// 利用者の Xauthority のクッキーを送らないようにする (Xvfb は認証なしで起動する)
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "Xauthority"))
+
+	display := -1
+	for n := 90; n < 200; n++ {
+		if _, err := os.Stat(fmt.Sprintf("/tmp/.X11-unix/X%d", n)); os.IsNotExist(err) {
+			display = n
+			break
+		}
+	}
+	if display < 0 {
+		t.Skip("no free X display number")
+	}
+	cmd := exec.Command(xvfb, fmt.Sprintf(":%d", display), "-screen", "0", fmt.Sprintf("%dx%dx24", xvfbWidth, xvfbHeight), "-nolisten", "tcp")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start Xvfb: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	// ソケットが作成されるまで待つ
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		c, err := NewX11Capturer(fmt.Sprintf(":%d", display))
+		if err == nil {
+			t.Cleanup(func() { c.Close() })
+			return c
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("failed to connect to Xvfb: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// x11Send は応答のないリクエストを送信します。エラーは次の roundTrip で読み捨てられるため、
+// 送信後に応答のあるリクエストで結果を確認してください。
+func x11Send(t *testing.T, c *x11Conn, req []byte) {
+	t.Helper()
+	binary.LittleEndian.PutUint16(req[2:], uint16(len(req)/4))
+	if _, err := c.conn.Write(req); err != nil {
+		t.Fatalf("failed to send X11 request %d: %v", req[0], err)
+	}
+	c.seq++
+}
+
+// createTestWindow はルートウィンドウの子として背景色 pixel のウィンドウを作成し、タイトルを設定して表示します。
+func createTestWindow(t *testing.T, xc *X11Capturer, n uint32, title string, r image.Rectangle, pixel uint32) uint32 {
+	t.Helper()
+	c := xc.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	le := binary.LittleEndian
+	id := c.idBase | n&c.idMask
+
+	req := make([]byte, 36)
+	req[0] = 1 // CreateWindow (depth は親と同じ)
+	le.PutUint32(req[4:], id)
+	le.PutUint32(req[8:], c.screen.Root)
+	le.PutUint16(req[12:], uint16(int16(r.Min.X)))
+	le.PutUint16(req[14:], uint16(int16(r.Min.Y)))
+	le.PutUint16(req[16:], uint16(r.Dx()))
+	le.PutUint16(req[18:], uint16(r.Dy()))
+	le.PutUint16(req[22:], 1)   // InputOutput
+	le.PutUint32(req[28:], 0x2) // value-mask: background-pixel
+	le.PutUint32(req[32:], pixel)
+	x11Send(t, c, req)
+
+	wmName, err := c.internAtom("WM_NAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prop := make([]byte, 24, 24+len(title)+pad4(len(title)))
+	prop[0] = 18 // ChangeProperty (Replace)
+	le.PutUint32(prop[4:], id)
+	le.PutUint32(prop[8:], wmName)
+	le.PutUint32(prop[12:], 31) // STRING
+	prop[16] = 8
+	le.PutUint32(prop[20:], uint32(len(title)))
+	prop = append(prop, title...)
+	prop = append(prop, make([]byte, pad4(len(title)))...)
+	x11Send(t, c, prop)
+
+	mapReq := make([]byte, 8)
+	mapReq[0] = 8 // MapWindow
+	le.PutUint32(mapReq[4:], id)
+	x11Send(t, c, mapReq)
+
+	// 応答のあるリクエストで、ここまでのリクエストが処理されたことを確認する
+	if _, _, err := c.windowAttributes(id); err != nil {
+		t.Fatalf("failed to create window: %v", err)
+	}
+	return id
+}
+
+// moveTestWindow はウィンドウを指定した位置に移動します。
+func moveTestWindow(t *testing.T, xc *X11Capturer, id uint32, x, y int) {
+	t.Helper()
+	c := xc.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	le := binary.LittleEndian
+	req := make([]byte, 20)
+	req[0] = 12 // ConfigureWindow
+	le.PutUint32(req[4:], id)
+	le.PutUint16(req[8:], 0x1|0x2) // x, y
+	le.PutUint32(req[12:], uint32(int32(x)))
+	le.PutUint32(req[16:], uint32(int32(y)))
+	x11Send(t, c, req)
+	if _, _, err := c.windowAttributes(id); err != nil {
+		t.Fatalf("failed to move window: %v", err)
+	}
+}
+
+// assertFilled は画像のすべてのピクセルが want の色であることを確認します。
+func assertFilled(t *testing.T, img image.Image, want color.RGBA) {
+	t.Helper()
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got := color.RGBAModel.Convert(img.At(x, y)); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestX11CaptureWindow(t *testing.T) {
+	c := startXvfb(t)
+	id := createTestWindow(t, c, 1, "x11 test window", image.Rect(10, 20, 110, 70), 0xFF0000)
+
+	windows, err := c.ListWindows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *WindowInfo
+	for i := range windows {
+		if windows[i].HWND == HWND(id) {
+			found = &windows[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("ListWindows did not return the test window: %+v", windows)
+	}
+	if found.Title != "x11 test window" {
+		t.Errorf("title = %q", found.Title)
+	}
+	if want := image.Rect(10, 20, 110, 70); found.Rect != want {
+		t.Errorf("rect = %v, want %v", found.Rect, want)
+	}
+
+	img, err := c.CaptureWindow(HWND(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReleaseImage(img)
+	if got := img.Bounds(); got != image.Rect(0, 0, 100, 50) {
+		t.Fatalf("bounds = %v, want 100x50", got)
+	}
+	assertFilled(t, img, color.RGBA{R: 0xFF, A: 0xFF})
+}
+
+func TestX11CaptureWindowOffScreen(t *testing.T) {
+	c := startXvfb(t)
+	id := createTestWindow(t, c, 1, "off screen", image.Rect(0, 0, 100, 50), 0x00FF00)
+	// 右側の 60 ピクセルが画面外になる位置に移動する (GetImage が BadMatch を返す)
+	moveTestWindow(t, c, id, xvfbWidth-40, 10)
+
+	img, err := c.CaptureWindow(HWND(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReleaseImage(img)
+	if got := img.Bounds().Size(); got != image.Pt(40, 50) {
+		t.Fatalf("size = %v, want the on-screen part 40x50", got)
+	}
+	assertFilled(t, img, color.RGBA{G: 0xFF, A: 0xFF})
+	if got := img.Bounds().Min; got != (image.Point{}) {
+		t.Errorf("bounds min = %v, want (0, 0) for a window clipped on the right", got)
+	}
+
+	// 左側の 30 ピクセルが画面外の場合は、画像の Bounds がウィンドウ上の位置になる
+	moveTestWindow(t, c, id, -30, 10)
+	clipped, err := c.CaptureWindow(HWND(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReleaseImage(clipped)
+	if got, want := clipped.Bounds(), image.Rect(30, 0, 100, 50); got != want {
+		t.Fatalf("bounds = %v, want %v", got, want)
+	}
+	assertFilled(t, clipped, color.RGBA{G: 0xFF, A: 0xFF})
+
+	// 完全に画面外の場合はエラーになる
+	moveTestWindow(t, c, id, xvfbWidth+10, 10)
+	if img, err := c.CaptureWindow(HWND(id)); err == nil {
+		ReleaseImage(img)
+		t.Fatal("expected an error for a window entirely off screen")
+	}
+}
+
+func TestX11ListMonitors(t *testing.T) {
+	c := startXvfb(t)
+	monitors, err := c.ListMonitors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(monitors) == 0 {
+		t.Fatal("no monitors")
+	}
+	screen := image.Rect(0, 0, xvfbWidth, xvfbHeight)
+	var union image.Rectangle
+	for _, m := range monitors {
+		if m.Bounds.Empty() || !m.Bounds.In(screen) {
+			t.Errorf("monitor %d bounds %v outside the screen %v", m.Index, m.Bounds, screen)
+		}
+		union = union.Union(m.Bounds)
+	}
+	if union != screen {
+		t.Errorf("monitors cover %v, want %v", union, screen)
+	}
+
+	img, err := CaptureAllMonitors(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReleaseImage(img)
+	if got := img.Bounds().Size(); got != screen.Size() {
+		t.Errorf("CaptureAllMonitors size = %v, want %v", got, screen.Size())
+	}
+}
+
+func TestParseX11Display(t *testing.T) {
+	tests := []struct {
+		display, network, address, num string
+		screen                         int
+	}{
+		{":0", "unix", "/tmp/.X11-unix/X0", "0", 0},
+		{":1.2", "unix", "/tmp/.X11-unix/X1", "1", 2},
+		{"unix:3", "unix", "/tmp/.X11-unix/X3", "3", 0},
+		{"localhost:10.0", "tcp", "localhost:6010", "10", 0},
+		{"/private/tmp/com.apple.launchd.abc/org.xquartz:0", "unix", "/private/tmp/com.apple.launchd.abc/org.xquartz:0", "0", 0},
+	}
+	for _, tt := range tests {
+		network, address, num, screen, err := parseX11Display(tt.display)
+		if err != nil {
+			t.Errorf("%q: %v", tt.display, err)
+			continue
+		}
+		if network != tt.network || address != tt.address || num != tt.num || screen != tt.screen {
+			t.Errorf("%q = %s %s %s %d, want %s %s %s %d", tt.display, network, address, num, screen, tt.network, tt.address, tt.num, tt.screen)
+		}
+	}
+	for _, display := range []string{"", "0", ":x", ":0.x"} {
+		if _, _, _, _, err := parseX11Display(display); err == nil {
+			t.Errorf("%q: expected an error", display)
+		}
+	}
+}
+
+func TestX11ToImage(t *testing.T) {
+	c := &x11Conn{
+		pixmapBPP:   map[byte]byte{24: 32},
+		scanlinePad: map[byte]byte{24: 32},
+		screen:      x11Screen{Visuals: map[uint32]x11Visual{0x21: {Depth: 24, RedMask: 0xFF0000, GreenMask: 0x00FF00, BlueMask: 0x0000FF}}},
+	}
+	// 2x2 の BGRX 形式のピクセル (X の値は無視される)
+	data := []byte{
+		0x01, 0x02, 0x03, 0x00, 0x11, 0x12, 0x13, 0x55,
+		0x21, 0x22, 0x23, 0x00, 0x31, 0x32, 0x33, 0xAA,
+	}
+	img, err := c.toImage(data, 24, 0x21, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ReleaseImage(img)
+	want := []color.RGBA{{0x03, 0x02, 0x01, 0xFF}, {0x13, 0x12, 0x11, 0xFF}, {0x23, 0x22, 0x21, 0xFF}, {0x33, 0x32, 0x31, 0xFF}}
+	for i, w := range want {
+		if got := img.At(i%2, i/2); got != w {
+			t.Errorf("pixel %d = %v, want %v", i, got, w)
+		}
+	}
+
+	if _, err := c.toImage(data[:12], 24, 0x21, 2, 2); err == nil {
+		t.Error("expected an error for short image data")
+	}
+}